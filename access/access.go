@@ -0,0 +1,249 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package access decides which Remote API calls a user may make. It is shared by
+// the proxy, the gateway and the web admin so every frontend enforces the same
+// roles.
+package access
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"strings"
+)
+
+type Role string
+
+const (
+	RoleReadOnly  Role = "read-only" // may read everything
+	RoleModerator Role = "moderator" // may also kick players, stop entities, power grids and chat
+	RoleAdmin     Role = "admin"     // may do everything, including deleting, banning and stopping the server
+)
+
+var roleRanks = map[Role]int{
+	RoleReadOnly:  1,
+	RoleModerator: 2,
+	RoleAdmin:     3,
+}
+
+func ParseRole(text string) (Role, error) {
+	role := Role(strings.ToLower(strings.TrimSpace(text)))
+	if _, ok := roleRanks[role]; !ok {
+		return "", errors.New("unknown role: " + text)
+	}
+	return role, nil
+}
+
+// Includes reports whether role grants at least the rights of other
+func (role Role) Includes(other Role) bool {
+	rank, ok := roleRanks[role]
+	return ok && rank >= roleRanks[other]
+}
+
+// Allows reports whether role may call method on resource, resource is relative
+// to the base url like "session/grids/123"
+func (role Role) Allows(method string, resource string) bool {
+	return role.Includes(Lookup(method, resource).Role)
+}
+
+//--
+//-- Rules
+//--
+
+// Rule assigns the role required for an endpoint, * in Resource matches a single
+// path segment holding a numeric entity or steam id
+type Rule struct {
+	Method   string
+	Resource string
+	Role     Role
+	Action   string
+}
+
+var Rules = []Rule{
+	{"GET", "server", RoleReadOnly, "read server info"},
+	{"GET", "server/ping", RoleReadOnly, "ping"},
+	{"GET", "session/asteroids", RoleReadOnly, "list asteroids"},
+	{"GET", "session/characters", RoleReadOnly, "list characters"},
+	{"GET", "session/chat", RoleReadOnly, "read chat"},
+	{"GET", "session/floatingObjects", RoleReadOnly, "list floating objects"},
+	{"GET", "session/grids", RoleReadOnly, "list grids"},
+	{"GET", "session/planets", RoleReadOnly, "list planets"},
+	{"GET", "session/players", RoleReadOnly, "list players"},
+	{"GET", "admin/bannedPlayers", RoleReadOnly, "list banned players"},
+	{"GET", "admin/kickedPlayers", RoleReadOnly, "list kicked players"},
+
+	{"POST", "session/chat", RoleModerator, "send chat message"},
+	{"PATCH", "session/characters/*", RoleModerator, "stop character"},
+	{"PATCH", "session/floatingObjects/*", RoleModerator, "stop floating object"},
+	{"PATCH", "session/grids/*", RoleModerator, "stop grid"},
+	{"POST", "session/poweredGrids/*", RoleModerator, "power grid on"},
+	{"DELETE", "session/poweredGrids/*", RoleModerator, "power grid off"},
+	{"POST", "admin/kickedPlayers/*", RoleModerator, "kick player"},
+	{"DELETE", "admin/kickedPlayers/*", RoleModerator, "unkick player"},
+
+	{"PATCH", "session", RoleAdmin, "save world"},
+	{"DELETE", "server", RoleAdmin, "stop server"},
+	{"DELETE", "session/asteroids/*", RoleAdmin, "delete asteroid"},
+	{"DELETE", "session/floatingObjects/*", RoleAdmin, "delete floating object"},
+	{"DELETE", "session/grids/*", RoleAdmin, "delete grid"},
+	{"DELETE", "session/planets/*", RoleAdmin, "delete planet"},
+	{"POST", "admin/bannedPlayers/*", RoleAdmin, "ban player"},
+	{"DELETE", "admin/bannedPlayers/*", RoleAdmin, "unban player"},
+	{"POST", "admin/promotedPlayers/*", RoleAdmin, "promote player"},
+	{"DELETE", "admin/promotedPlayers/*", RoleAdmin, "demote player"},
+}
+
+// Lookup returns the rule for an endpoint. Endpoints without a rule and resources
+// failing CheckResource require the admin role, so calls added by future server
+// versions or paths a server may resolve differently are not opened up by accident.
+func Lookup(method string, resource string) Rule {
+	resource = strings.Trim(resource, "/")
+	if i := strings.IndexByte(resource, '?'); i >= 0 {
+		resource = resource[:i]
+	}
+	if CheckResource(resource) == nil {
+		for _, rule := range Rules {
+			if strings.EqualFold(rule.Method, method) && matchResource(rule.Resource, resource) {
+				return rule
+			}
+		}
+	}
+	return Rule{Method: method, Resource: resource, Role: RoleAdmin, Action: "unknown"}
+}
+
+// LookupPattern returns the rule written for method and a resource pattern like
+// "session/grids/*", frontends use it to find the role required by the calls
+// they make. Unknown patterns require the admin role.
+func LookupPattern(method string, pattern string) Rule {
+	for _, rule := range Rules {
+		if strings.EqualFold(rule.Method, method) && rule.Resource == pattern {
+			return rule
+		}
+	}
+	return Rule{Method: method, Resource: pattern, Role: RoleAdmin, Action: "unknown"}
+}
+
+// CheckResource rejects resources a server could map to another endpoint than
+// the one the rules were checked for: empty, "." and ".." segments, escapes and
+// backslashes
+func CheckResource(resource string) error {
+	if strings.ContainsAny(resource, `%\`) {
+		return errors.New("escaped characters in resource " + resource)
+	}
+	for _, part := range strings.Split(resource, "/") {
+		switch part {
+		case "", ".", "..":
+			return errors.New("invalid resource " + resource)
+		}
+	}
+	return nil
+}
+
+func matchResource(pattern string, resource string) bool {
+	patternParts := strings.Split(pattern, "/")
+	resourceParts := strings.Split(resource, "/")
+	if len(patternParts) != len(resourceParts) {
+		return false
+	}
+	for i, part := range patternParts {
+		if part == "*" {
+			if !isID(resourceParts[i]) {
+				return false
+			}
+		} else if part != resourceParts[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// isID reports whether part is a decimal entity or steam id
+func isID(part string) bool {
+	digits := strings.TrimPrefix(part, "-")
+	if digits == "" || len(digits) > 20 {
+		return false
+	}
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+//--
+//-- Users
+//--
+
+// User is a person allowed to use a frontend. Key is a base64 secret used to sign
+// requests the same way the Remote API key is used, Token is a bearer token.
+type User struct {
+	Name  string
+	Role  Role
+	Key   string `json:",omitempty"`
+	Token string `json:",omitempty"`
+}
+
+type Users []*User
+
+// ByToken returns the user with the bearer token or nil
+func (users Users) ByToken(token string) *User {
+	if token == "" {
+		return nil
+	}
+	for _, user := range users {
+		if user.Token != "" && subtle.ConstantTimeCompare([]byte(user.Token), []byte(token)) == 1 {
+			return user
+		}
+	}
+	return nil
+}
+
+func (users Users) ByName(name string) *User {
+	for _, user := range users {
+		if user.Name == name {
+			return user
+		}
+	}
+	return nil
+}
+
+// LoadUsers reads a JSON array of users like
+//
+//	[{"Name": "alice", "Role": "moderator", "Key": "c2VjcmV0"}]
+func LoadUsers(path string) (Users, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var users Users
+	err = json.Unmarshal(data, &users)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, user := range users {
+		if user.Name == "" {
+			return nil, errors.New("user without name in " + path)
+		}
+		if _, err := ParseRole(string(user.Role)); err != nil {
+			return nil, errors.New("user " + user.Name + ": " + err.Error())
+		}
+		user.Role = Role(strings.ToLower(string(user.Role)))
+	}
+	return users, nil
+}
@@ -0,0 +1,144 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package access
+
+import "testing"
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		method   string
+		resource string
+		role     Role
+		action   string
+	}{
+		{"GET", "server", RoleReadOnly, "read server info"},
+		{"get", "/session/grids/", RoleReadOnly, "list grids"},
+		{"GET", "session/grids?x=1", RoleReadOnly, "list grids"},
+		{"PATCH", "session/grids/123", RoleModerator, "stop grid"},
+		{"DELETE", "session/grids/-123", RoleAdmin, "delete grid"},
+		{"POST", "admin/kickedPlayers/76561198000000001", RoleModerator, "kick player"},
+		{"POST", "admin/bannedPlayers/76561198000000001", RoleAdmin, "ban player"},
+		{"POST", "session/chat", RoleModerator, "send chat message"},
+		{"DELETE", "server", RoleAdmin, "stop server"},
+
+		// * only matches numeric ids
+		{"PATCH", "session/grids/abc", RoleAdmin, "unknown"},
+		{"PATCH", "session/grids/1a", RoleAdmin, "unknown"},
+		{"PATCH", "session/grids/-", RoleAdmin, "unknown"},
+		{"PATCH", "session/grids/123456789012345678901", RoleAdmin, "unknown"},
+		{"POST", "admin/kickedPlayers/STEAM_0:1:1", RoleAdmin, "unknown"},
+		{"GET", "session/grids/123", RoleAdmin, "unknown"},
+		{"PATCH", "session/grids/1/2", RoleAdmin, "unknown"},
+
+		// unknown endpoints and paths a server may resolve differently
+		{"GET", "session/secret", RoleAdmin, "unknown"},
+		{"PUT", "session/chat", RoleAdmin, "unknown"},
+		{"PATCH", "session/grids/1/..", RoleAdmin, "unknown"},
+		{"GET", "session/grids/../../server", RoleAdmin, "unknown"},
+		{"PATCH", "session//grids/1", RoleAdmin, "unknown"},
+		{"PATCH", "session/grids/%31", RoleAdmin, "unknown"},
+		{"GET", `session\grids`, RoleAdmin, "unknown"},
+	}
+
+	for _, test := range tests {
+		rule := Lookup(test.method, test.resource)
+		if rule.Role != test.role || rule.Action != test.action {
+			t.Errorf("Lookup(%s, %s) = %s %q, want %s %q", test.method, test.resource, rule.Role, rule.Action, test.role, test.action)
+		}
+	}
+}
+
+func TestLookupPattern(t *testing.T) {
+	for _, rule := range Rules {
+		if got := LookupPattern(rule.Method, rule.Resource); got != rule {
+			t.Errorf("LookupPattern(%s, %s) = %v", rule.Method, rule.Resource, got)
+		}
+	}
+	if rule := LookupPattern("PATCH", "session/grids/1"); rule.Role != RoleAdmin || rule.Action != "unknown" {
+		t.Errorf("LookupPattern matched an id against a pattern: %v", rule)
+	}
+}
+
+func TestCheckResource(t *testing.T) {
+	tests := map[string]bool{
+		"server":                 true,
+		"session/grids/123":      true,
+		"":                       false,
+		"session/":               false,
+		"/session":               false,
+		"session//grids":         false,
+		"session/./grids":        false,
+		"session/grids/..":       false,
+		"session/%2e%2e/server":  false,
+		"session/grids%2f1":      false,
+		`session\..\server`:      false,
+		"session/grids/1/../../": false,
+	}
+	for resource, valid := range tests {
+		if err := CheckResource(resource); (err == nil) != valid {
+			t.Errorf("CheckResource(%q) = %v, want valid %t", resource, err, valid)
+		}
+	}
+}
+
+func TestRoleAllows(t *testing.T) {
+	tests := []struct {
+		role     Role
+		method   string
+		resource string
+		allowed  bool
+	}{
+		{RoleReadOnly, "GET", "session/players", true},
+		{RoleReadOnly, "POST", "session/chat", false},
+		{RoleModerator, "POST", "session/chat", true},
+		{RoleModerator, "POST", "admin/kickedPlayers/1", true},
+		{RoleModerator, "POST", "admin/bannedPlayers/1", false},
+		{RoleModerator, "PATCH", "session/grids/../../server", false},
+		{RoleModerator, "GET", "session/unknown", false},
+		{RoleAdmin, "DELETE", "server", true},
+		{RoleAdmin, "GET", "session/unknown", true},
+		{Role("root"), "GET", "server", false},
+		{Role(""), "GET", "server", false},
+	}
+	for _, test := range tests {
+		if got := test.role.Allows(test.method, test.resource); got != test.allowed {
+			t.Errorf("%q.Allows(%s, %s) = %t, want %t", test.role, test.method, test.resource, got, test.allowed)
+		}
+	}
+}
+
+func TestParseRole(t *testing.T) {
+	if role, err := ParseRole(" Moderator "); err != nil || role != RoleModerator {
+		t.Errorf("ParseRole() = %q, %v", role, err)
+	}
+	if _, err := ParseRole("root"); err == nil {
+		t.Error("ParseRole accepted an unknown role")
+	}
+}
+
+func TestUsersByToken(t *testing.T) {
+	users := Users{
+		{Name: "alice", Role: RoleAdmin, Token: "alice-token"},
+		{Name: "bob", Role: RoleReadOnly},
+	}
+	if user := users.ByToken("alice-token"); user == nil || user.Name != "alice" {
+		t.Errorf("ByToken() = %v", user)
+	}
+	for _, token := range []string{"", "alice", "alice-token "} {
+		if user := users.ByToken(token); user != nil {
+			t.Errorf("ByToken(%q) = %s", token, user.Name)
+		}
+	}
+}
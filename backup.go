@@ -0,0 +1,303 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package govrageremote
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// DefaultBackupNameTemplate produces names like "world-2026-10-16T12-00"
+const DefaultBackupNameTemplate = `world-{{.Time.Format "2006-01-02T15-04"}}`
+
+type VRageBackup struct {
+	Name string
+	Time time.Time
+}
+
+// VRageBackupNameData is passed to the name template of a VRageBackupManager
+type VRageBackupNameData struct {
+	Time     time.Time
+	Sequence int
+}
+
+// VRageBackupRetention keeps the newest backup of each of the last Hourly hours
+// and of each of the last Daily days. If both are zero nothing is ever pruned.
+type VRageBackupRetention struct {
+	Hourly int
+	Daily  int
+}
+
+// vrageBackupManifest is the file format of the manifest, older versions wrote
+// the bare list of backups
+type vrageBackupManifest struct {
+	Sequence int            `json:"sequence"`
+	Backups  []*VRageBackup `json:"backups"`
+}
+
+type VRageBackupManager struct {
+	client       *VRageRemoteClient
+	NameTemplate string
+	ManifestPath string
+	Retention    VRageBackupRetention
+	Backups      []*VRageBackup
+	sequence     int
+	mutex        sync.Mutex
+}
+
+// Backup saves the world under a name generated from the name template and records it in the manifest
+func (manager *VRageBackupManager) Backup() (*VRageBackup, error) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	now := time.Now()
+	name, err := manager.formatName(now)
+	if err != nil {
+		return nil, err
+	}
+
+	// a name may be taken after a restart with an old manifest, skip ahead to the
+	// next free sequence number instead of failing forever
+	for manager.nameInUse(name) {
+		manager.sequence++
+		next, err := manager.formatName(now)
+		if err != nil {
+			return nil, err
+		}
+		if next == name {
+			return nil, errors.New("backup name already in use: " + name)
+		}
+		name = next
+	}
+
+	err = manager.client.SaveAs(name)
+	if err != nil {
+		return nil, err
+	}
+
+	backup := &VRageBackup{Name: name, Time: now}
+	manager.Backups = append(manager.Backups, backup)
+	manager.sequence++
+
+	return backup, manager.writeManifest()
+}
+
+// Run creates a backup every interval until stop is closed. Errors are passed to
+// onError, which may be nil.
+func (manager *VRageBackupManager) Run(interval time.Duration, stop <-chan struct{}, onError func(err error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			_, err := manager.Backup()
+			if err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// Expired returns the backups which are not covered by the retention policy, oldest first
+func (manager *VRageBackupManager) Expired() []*VRageBackup {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	return manager.expired()
+}
+
+// Prune calls fnc for every expired backup and removes it from the manifest if fnc
+// succeeds. The Remote API has no way to delete saves, so removing the save
+// itself is up to fnc.
+func (manager *VRageBackupManager) Prune(fnc func(backup *VRageBackup) error) ([]*VRageBackup, error) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	var pruned []*VRageBackup
+	var firstErr error
+	for _, backup := range manager.expired() {
+		if fnc != nil {
+			if err := fnc(backup); err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+		}
+		manager.remove(backup)
+		pruned = append(pruned, backup)
+	}
+
+	if err := manager.writeManifest(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+
+	return pruned, firstErr
+}
+
+func (manager *VRageBackupManager) expired() []*VRageBackup {
+	if manager.Retention.Hourly <= 0 && manager.Retention.Daily <= 0 {
+		return nil
+	}
+
+	backups := make([]*VRageBackup, len(manager.Backups))
+	copy(backups, manager.Backups)
+	sort.SliceStable(backups, func(i, j int) bool {
+		return backups[i].Time.After(backups[j].Time)
+	})
+
+	keep := make(map[*VRageBackup]bool)
+	keepNewestPerBucket(backups, manager.Retention.Hourly, keep, func(t time.Time) string {
+		return t.Format("2006-01-02T15")
+	})
+	keepNewestPerBucket(backups, manager.Retention.Daily, keep, func(t time.Time) string {
+		return t.Format("2006-01-02")
+	})
+
+	var expired []*VRageBackup
+	for i := len(backups) - 1; i >= 0; i-- {
+		if !keep[backups[i]] {
+			expired = append(expired, backups[i])
+		}
+	}
+	return expired
+}
+
+// keepNewestPerBucket expects backups ordered newest first
+func keepNewestPerBucket(backups []*VRageBackup, count int, keep map[*VRageBackup]bool, bucket func(t time.Time) string) {
+	seen := make(map[string]bool)
+	for _, backup := range backups {
+		if len(seen) >= count {
+			return
+		}
+		key := bucket(backup.Time)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		keep[backup] = true
+	}
+}
+
+func (manager *VRageBackupManager) remove(backup *VRageBackup) {
+	for i, other := range manager.Backups {
+		if other == backup {
+			manager.Backups = append(manager.Backups[:i], manager.Backups[i+1:]...)
+			return
+		}
+	}
+}
+
+func (manager *VRageBackupManager) nameInUse(name string) bool {
+	for _, backup := range manager.Backups {
+		if backup.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (manager *VRageBackupManager) formatName(now time.Time) (string, error) {
+	text := manager.NameTemplate
+	if text == "" {
+		text = DefaultBackupNameTemplate
+	}
+
+	tmpl, err := template.New("backup").Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var buffer bytes.Buffer
+	err = tmpl.Execute(&buffer, &VRageBackupNameData{Time: now, Sequence: manager.sequence})
+	if err != nil {
+		return "", err
+	}
+	return buffer.String(), nil
+}
+
+func (manager *VRageBackupManager) readManifest() error {
+	if manager.ManifestPath == "" {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(manager.ManifestPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(data, &manager.Backups)
+		manager.sequence = len(manager.Backups)
+		return err
+	}
+
+	manifest := &vrageBackupManifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return err
+	}
+	manager.Backups = manifest.Backups
+	manager.sequence = manifest.Sequence
+	return nil
+}
+
+func (manager *VRageBackupManager) writeManifest() error {
+	if manager.ManifestPath == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(&vrageBackupManifest{Sequence: manager.sequence, Backups: manager.Backups}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	temp := manager.ManifestPath + ".tmp"
+	err = ioutil.WriteFile(temp, data, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(temp, manager.ManifestPath)
+}
+
+// NewVRageBackupManager creates a backup manager. If manifestPath is not empty the
+// list of created backups is loaded from and persisted to that file.
+func NewVRageBackupManager(client *VRageRemoteClient, manifestPath string, retention VRageBackupRetention) (*VRageBackupManager, error) {
+	manager := &VRageBackupManager{
+		client:       client,
+		NameTemplate: DefaultBackupNameTemplate,
+		ManifestPath: manifestPath,
+		Retention:    retention,
+	}
+
+	err := manager.readManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	return manager, nil
+}
@@ -0,0 +1,201 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package govrageremote
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newSaveServer accepts saves and records the names they were made under
+func newSaveServer(t *testing.T) (*VRageRemoteClient, func() []string) {
+	var mutex sync.Mutex
+	var names []string
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Method != "PATCH" || request.URL.Path != "/vrageremote/v1/session" {
+			t.Errorf("unexpected request %s %s", request.Method, request.URL)
+		}
+		mutex.Lock()
+		names = append(names, request.URL.Query().Get("savename"))
+		mutex.Unlock()
+		fmt.Fprint(writer, `{"meta":{"apiVersion":"1.0","queryTime":1}}`)
+	}))
+	t.Cleanup(server.Close)
+	return NewVRageRemoteClient(server.URL, "c2VjcmV0"), func() []string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return append([]string(nil), names...)
+	}
+}
+
+func backupNames(backups []*VRageBackup) []string {
+	names := make([]string, len(backups))
+	for i, backup := range backups {
+		names[i] = backup.Name
+	}
+	return names
+}
+
+func TestBackupSequenceSurvivesPruneAndRestart(t *testing.T) {
+	client, saved := newSaveServer(t)
+	manifest := filepath.Join(t.TempDir(), "backups.json")
+
+	manager, err := NewVRageBackupManager(client, manifest, VRageBackupRetention{Hourly: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager.NameTemplate = "backup-{{.Sequence}}"
+	for i := 0; i < 3; i++ {
+		if _, err := manager.Backup(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// all three are in the same hour, only the newest is kept
+	pruned, err := manager.Prune(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(backupNames(pruned)); got != "[backup-0 backup-1]" {
+		t.Errorf("pruned %s", got)
+	}
+
+	restarted, err := NewVRageBackupManager(client, manifest, VRageBackupRetention{Hourly: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	restarted.NameTemplate = "backup-{{.Sequence}}"
+	for i := 0; i < 2; i++ {
+		if _, err := restarted.Backup(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := fmt.Sprint(saved()); got != "[backup-0 backup-1 backup-2 backup-3 backup-4]" {
+		t.Errorf("saved %s", got)
+	}
+}
+
+func TestBackupLegacyManifest(t *testing.T) {
+	client, saved := newSaveServer(t)
+	manifest := filepath.Join(t.TempDir(), "backups.json")
+	// written before the sequence was persisted, backup-0 and backup-1 were pruned
+	legacy := `[{"Name":"backup-2","Time":"2026-01-01T00:00:00Z"},{"Name":"backup-3","Time":"2026-01-01T01:00:00Z"}]`
+	if err := ioutil.WriteFile(manifest, []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	manager, err := NewVRageBackupManager(client, manifest, VRageBackupRetention{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager.NameTemplate = "backup-{{.Sequence}}"
+	for i := 0; i < 2; i++ {
+		if _, err := manager.Backup(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := fmt.Sprint(saved()); got != "[backup-4 backup-5]" {
+		t.Errorf("saved %s", got)
+	}
+
+	reloaded, err := NewVRageBackupManager(client, manifest, VRageBackupRetention{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.sequence != 6 || len(reloaded.Backups) != 4 {
+		t.Errorf("reloaded sequence %d with %d backups", reloaded.sequence, len(reloaded.Backups))
+	}
+}
+
+func TestBackupNameCollision(t *testing.T) {
+	client, saved := newSaveServer(t)
+	manager, err := NewVRageBackupManager(client, "", VRageBackupRetention{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager.NameTemplate = "fixed"
+	if _, err := manager.Backup(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manager.Backup(); err == nil {
+		t.Error("a name without sequence was used twice")
+	}
+	if len(saved()) != 1 {
+		t.Errorf("saved %v", saved())
+	}
+}
+
+func TestBackupRetention(t *testing.T) {
+	base := time.Date(2026, 10, 16, 12, 30, 0, 0, time.UTC)
+	at := func(hours int, minutes int) *VRageBackup {
+		moment := base.Add(-time.Duration(hours)*time.Hour - time.Duration(minutes)*time.Minute)
+		return &VRageBackup{Name: moment.Format("01-02T15:04"), Time: moment}
+	}
+	backups := []*VRageBackup{
+		at(0, 0), at(0, 10), // this hour
+		at(1, 0),            // last hour
+		at(2, 0), at(2, 20), // two hours ago
+		at(24, 0), at(25, 0), // yesterday
+		at(48, 0), // two days ago
+		at(72, 0), // three days ago
+	}
+
+	tests := []struct {
+		retention VRageBackupRetention
+		expired   string
+	}{
+		{VRageBackupRetention{}, "[]"},
+		{VRageBackupRetention{Hourly: 1}, "[10-13T12:30 10-14T12:30 10-15T11:30 10-15T12:30 10-16T10:10 10-16T10:30 10-16T11:30 10-16T12:20]"},
+		{VRageBackupRetention{Hourly: 3}, "[10-13T12:30 10-14T12:30 10-15T11:30 10-15T12:30 10-16T10:10 10-16T12:20]"},
+		{VRageBackupRetention{Daily: 2}, "[10-13T12:30 10-14T12:30 10-15T11:30 10-16T10:10 10-16T10:30 10-16T11:30 10-16T12:20]"},
+		{VRageBackupRetention{Hourly: 2, Daily: 3}, "[10-13T12:30 10-15T11:30 10-16T10:10 10-16T10:30 10-16T12:20]"},
+		{VRageBackupRetention{Hourly: 100, Daily: 100}, "[10-16T10:10 10-16T12:20]"},
+	}
+
+	for _, test := range tests {
+		manager := &VRageBackupManager{Retention: test.retention, Backups: backups}
+		if got := fmt.Sprint(backupNames(manager.Expired())); got != test.expired {
+			t.Errorf("%+v expired %s, want %s", test.retention, got, test.expired)
+		}
+	}
+}
+
+func TestBackupPruneKeepsFailures(t *testing.T) {
+	old := &VRageBackup{Name: "old", Time: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	older := &VRageBackup{Name: "older", Time: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	newest := &VRageBackup{Name: "newest", Time: time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)}
+	manager := &VRageBackupManager{Retention: VRageBackupRetention{Daily: 1}, Backups: []*VRageBackup{older, old, newest}}
+
+	pruned, err := manager.Prune(func(backup *VRageBackup) error {
+		if backup == old {
+			return fmt.Errorf("could not delete %s", backup.Name)
+		}
+		return nil
+	})
+	if err == nil {
+		t.Error("the error of fnc was dropped")
+	}
+	if got := fmt.Sprint(backupNames(pruned)); got != "[older]" {
+		t.Errorf("pruned %s", got)
+	}
+	if got := fmt.Sprint(backupNames(manager.Backups)); got != "[old newest]" {
+		t.Errorf("kept %s", got)
+	}
+}
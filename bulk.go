@@ -0,0 +1,167 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package govrageremote
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+type VRageBulkOptions struct {
+	Concurrency int           // number of requests in flight, defaults to 4
+	Interval    time.Duration // minimum time between starting two requests
+}
+
+// VRageBulkResult is the outcome of the operation for a single entity or player,
+// only the id the operation was called with is set
+type VRageBulkResult struct {
+	EntityID EntityID
+	SteamID  SteamID
+	Err      error
+}
+
+func (result *VRageBulkResult) String() string {
+	if result.SteamID != 0 {
+		return result.SteamID.String()
+	}
+	return result.EntityID.String()
+}
+
+// VRageBulkError is returned if at least one operation of a bulk call failed,
+// operations not started before the context ended fail with its error
+type VRageBulkError struct {
+	Succeeded []*VRageBulkResult
+	Failed    []*VRageBulkResult
+}
+
+func (err *VRageBulkError) Error() string {
+	var failures []string
+	for _, result := range err.Failed {
+		failures = append(failures, fmt.Sprintf("%s: %s", result, result.Err))
+	}
+	return fmt.Sprintf("%d of %d operations failed: %s", len(err.Failed), len(err.Failed)+len(err.Succeeded), strings.Join(failures, "; "))
+}
+
+func (client *VRageRemoteClient) DeleteGrids(ctx context.Context, ids []EntityID, options *VRageBulkOptions) ([]*VRageBulkResult, error) {
+	return client.bulkEntities(ctx, "DELETE", "session/grids", ids, options)
+}
+func (client *VRageRemoteClient) StopGrids(ctx context.Context, ids []EntityID, options *VRageBulkOptions) ([]*VRageBulkResult, error) {
+	return client.bulkEntities(ctx, "PATCH", "session/grids", ids, options)
+}
+func (client *VRageRemoteClient) DeleteFloatingObjects(ctx context.Context, ids []EntityID, options *VRageBulkOptions) ([]*VRageBulkResult, error) {
+	return client.bulkEntities(ctx, "DELETE", "session/floatingObjects", ids, options)
+}
+func (client *VRageRemoteClient) StopFloatingObjects(ctx context.Context, ids []EntityID, options *VRageBulkOptions) ([]*VRageBulkResult, error) {
+	return client.bulkEntities(ctx, "PATCH", "session/floatingObjects", ids, options)
+}
+func (client *VRageRemoteClient) StopCharacters(ctx context.Context, ids []EntityID, options *VRageBulkOptions) ([]*VRageBulkResult, error) {
+	return client.bulkEntities(ctx, "PATCH", "session/characters", ids, options)
+}
+func (client *VRageRemoteClient) KickPlayers(ctx context.Context, ids []SteamID, options *VRageBulkOptions) ([]*VRageBulkResult, error) {
+	return client.bulkPlayers(ctx, "POST", "admin/kickedPlayers", ids, options)
+}
+func (client *VRageRemoteClient) BanPlayers(ctx context.Context, ids []SteamID, options *VRageBulkOptions) ([]*VRageBulkResult, error) {
+	return client.bulkPlayers(ctx, "POST", "admin/bannedPlayers", ids, options)
+}
+
+func (client *VRageRemoteClient) bulkEntities(ctx context.Context, method string, collection string, ids []EntityID, options *VRageBulkOptions) ([]*VRageBulkResult, error) {
+	results := make([]*VRageBulkResult, len(ids))
+	for i, id := range ids {
+		results[i] = &VRageBulkResult{EntityID: id}
+	}
+	return runBulk(ctx, results, options, func(ctx context.Context, result *VRageBulkResult) error {
+		_, _, err := client.Do(ctx, method, fmt.Sprintf("%s/%d", collection, result.EntityID), nil, nil, nil)
+		return err
+	})
+}
+
+func (client *VRageRemoteClient) bulkPlayers(ctx context.Context, method string, collection string, ids []SteamID, options *VRageBulkOptions) ([]*VRageBulkResult, error) {
+	results := make([]*VRageBulkResult, len(ids))
+	for i, id := range ids {
+		results[i] = &VRageBulkResult{SteamID: id}
+	}
+	return runBulk(ctx, results, options, func(ctx context.Context, result *VRageBulkResult) error {
+		_, _, err := client.Do(ctx, method, fmt.Sprintf("%s/%d", collection, result.SteamID), nil, nil, nil)
+		return err
+	})
+}
+
+// runBulk calls fnc for every result and sets its Err, the results keep their order
+func runBulk(ctx context.Context, results []*VRageBulkResult, options *VRageBulkOptions, fnc func(ctx context.Context, result *VRageBulkResult) error) ([]*VRageBulkResult, error) {
+	concurrency := 4
+	var interval time.Duration
+	if options != nil {
+		if options.Concurrency > 0 {
+			concurrency = options.Concurrency
+		}
+		interval = options.Interval
+	}
+
+	semaphore := make(chan struct{}, concurrency)
+	var wait sync.WaitGroup
+
+	var last time.Time
+start:
+	for i, result := range results {
+		select {
+		case semaphore <- struct{}{}:
+		case <-ctx.Done():
+			for _, skipped := range results[i:] {
+				skipped.Err = ctx.Err()
+			}
+			break start
+		}
+		// the interval counts from the start of the previous request, which may
+		// have waited for a free slot
+		if interval > 0 && !last.IsZero() {
+			timer := time.NewTimer(interval - time.Since(last))
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				<-semaphore
+				for _, skipped := range results[i:] {
+					skipped.Err = ctx.Err()
+				}
+				break start
+			}
+		}
+		last = time.Now()
+
+		wait.Add(1)
+		go func(result *VRageBulkResult) {
+			defer wait.Done()
+			defer func() { <-semaphore }()
+			result.Err = fnc(ctx, result)
+		}(result)
+	}
+	wait.Wait()
+
+	bulkErr := &VRageBulkError{}
+	for _, result := range results {
+		if result.Err != nil {
+			bulkErr.Failed = append(bulkErr.Failed, result)
+		} else {
+			bulkErr.Succeeded = append(bulkErr.Succeeded, result)
+		}
+	}
+	if len(bulkErr.Failed) > 0 {
+		return results, bulkErr
+	}
+	return results, nil
+}
@@ -0,0 +1,226 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package govrageremote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunBulk(t *testing.T) {
+	results := make([]*VRageBulkResult, 10)
+	for i := range results {
+		results[i] = &VRageBulkResult{EntityID: EntityID(i)}
+	}
+
+	var running, most int32
+	got, err := runBulk(context.Background(), results, &VRageBulkOptions{Concurrency: 3}, func(ctx context.Context, result *VRageBulkResult) error {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&most)
+			if n <= m || atomic.CompareAndSwapInt32(&most, m, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		if result.EntityID%3 == 0 {
+			return fmt.Errorf("failed %d", result.EntityID)
+		}
+		return nil
+	})
+
+	if most > 3 {
+		t.Errorf("%d operations ran at once, want at most 3", most)
+	}
+	for i, result := range got {
+		if result.EntityID != EntityID(i) || (result.Err != nil) != (i%3 == 0) {
+			t.Errorf("result %d = %+v", i, result)
+		}
+	}
+
+	var bulkErr *VRageBulkError
+	if !errors.As(err, &bulkErr) {
+		t.Fatalf("got %v, want a bulk error", err)
+	}
+	if len(bulkErr.Failed) != 4 || len(bulkErr.Succeeded) != 6 {
+		t.Errorf("%d failed and %d succeeded, want 4 and 6", len(bulkErr.Failed), len(bulkErr.Succeeded))
+	}
+	want := "4 of 10 operations failed: 0: failed 0; 3: failed 3; 6: failed 6; 9: failed 9"
+	if err.Error() != want {
+		t.Errorf("error %q, want %q", err, want)
+	}
+
+	// steam ids name the results
+	players := []*VRageBulkResult{{SteamID: gabe}}
+	_, err = runBulk(context.Background(), players, nil, func(ctx context.Context, result *VRageBulkResult) error {
+		return errors.New("not online")
+	})
+	if err == nil || err.Error() != "1 of 1 operations failed: 76561197960287930: not online" {
+		t.Errorf("got %v", err)
+	}
+
+	if _, err := runBulk(context.Background(), nil, nil, nil); err != nil {
+		t.Errorf("empty bulk call returned %v", err)
+	}
+}
+
+func TestRunBulkInterval(t *testing.T) {
+	const interval = 20 * time.Millisecond
+	results := make([]*VRageBulkResult, 4)
+	for i := range results {
+		results[i] = &VRageBulkResult{EntityID: EntityID(i)}
+	}
+
+	// the first two operations end at the same time, the next two must still
+	// start an interval apart
+	durations := []time.Duration{100 * time.Millisecond, 80 * time.Millisecond, 0, 0}
+	starts := make([]time.Time, len(results))
+	runBulk(context.Background(), results, &VRageBulkOptions{Concurrency: 2, Interval: interval}, func(ctx context.Context, result *VRageBulkResult) error {
+		starts[result.EntityID] = time.Now()
+		time.Sleep(durations[result.EntityID])
+		return nil
+	})
+
+	for i := 1; i < len(starts); i++ {
+		if gap := starts[i].Sub(starts[i-1]); gap < interval-2*time.Millisecond {
+			t.Errorf("operation %d started %s after the previous one, want at least %s", i, gap, interval)
+		}
+	}
+}
+
+func TestRunBulkCancel(t *testing.T) {
+	results := make([]*VRageBulkResult, 5)
+	for i := range results {
+		results[i] = &VRageBulkResult{EntityID: EntityID(i)}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var calls int32
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := runBulk(ctx, results, &VRageBulkOptions{Concurrency: 1, Interval: time.Hour}, func(ctx context.Context, result *VRageBulkResult) error {
+			atomic.AddInt32(&calls, 1)
+			return nil
+		})
+		var bulkErr *VRageBulkError
+		if !errors.As(err, &bulkErr) || len(bulkErr.Succeeded) != 1 || len(bulkErr.Failed) != 4 {
+			t.Errorf("got %v", err)
+		}
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("bulk call did not stop")
+	}
+
+	if calls != 1 {
+		t.Errorf("%d operations ran, want 1", calls)
+	}
+	for _, result := range results[1:] {
+		if !errors.Is(result.Err, context.Canceled) {
+			t.Errorf("skipped operation %s failed with %v", result, result.Err)
+		}
+	}
+}
+
+// TestBulkClient runs bulk calls through a client shared by many goroutines, the
+// client has no global lock and requests run in parallel
+func TestBulkClient(t *testing.T) {
+	var mutex sync.Mutex
+	var requests []string
+	var running, most int32
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&most)
+			if n <= m || atomic.CompareAndSwapInt32(&most, m, n) {
+				break
+			}
+		}
+		mutex.Lock()
+		requests = append(requests, request.Method+" "+request.URL.Path)
+		mutex.Unlock()
+		time.Sleep(5 * time.Millisecond)
+
+		if strings.HasSuffix(request.URL.Path, "/13") {
+			writer.WriteHeader(http.StatusNotFound)
+			writer.Write([]byte(`{"error":{"message":"grid not found"},"meta":{"apiVersion":"1.0","queryTime":1}}`))
+			return
+		}
+		writer.Write([]byte(`{"meta":{"apiVersion":"1.0","queryTime":1}}`))
+	}))
+	defer server.Close()
+	client := NewVRageRemoteClient(server.URL, "c2VjcmV0")
+
+	ids := make([]EntityID, 20)
+	for i := range ids {
+		ids[i] = EntityID(i)
+	}
+
+	var wait sync.WaitGroup
+	for _, call := range []func(context.Context, []EntityID, *VRageBulkOptions) ([]*VRageBulkResult, error){client.DeleteGrids, client.StopFloatingObjects, client.StopCharacters} {
+		wait.Add(1)
+		go func(call func(context.Context, []EntityID, *VRageBulkOptions) ([]*VRageBulkResult, error)) {
+			defer wait.Done()
+			results, err := call(context.Background(), ids, &VRageBulkOptions{Concurrency: 4})
+			var bulkErr *VRageBulkError
+			if !errors.As(err, &bulkErr) || len(bulkErr.Failed) != 1 || bulkErr.Failed[0].EntityID != 13 {
+				t.Errorf("got %v", err)
+			}
+			var statusErr *VRageStatusError
+			if !errors.As(results[13].Err, &statusErr) || statusErr.StatusCode != http.StatusNotFound || statusErr.Message != "grid not found" {
+				t.Errorf("result 13 failed with %v", results[13].Err)
+			}
+		}(call)
+	}
+	wait.Add(1)
+	go func() {
+		defer wait.Done()
+		if _, err := client.KickPlayers(context.Background(), []SteamID{gabe, gabe + 1}, nil); err != nil {
+			t.Error(err)
+		}
+	}()
+	wait.Wait()
+
+	if len(requests) != 62 {
+		t.Errorf("server got %d requests, want 62", len(requests))
+	}
+	for _, want := range []string{"DELETE /vrageremote/v1/session/grids/7", "PATCH /vrageremote/v1/session/floatingObjects/7", "PATCH /vrageremote/v1/session/characters/7", "POST /vrageremote/v1/admin/kickedPlayers/76561197960287931"} {
+		found := false
+		for _, request := range requests {
+			found = found || request == want
+		}
+		if !found {
+			t.Errorf("server did not get %s", want)
+		}
+	}
+	if most <= 4 {
+		t.Errorf("at most %d requests ran at once, the client serializes its callers", most)
+	}
+}
@@ -0,0 +1,223 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package govrageremote
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cacheInvalidations lists the cached resources changed by mutating a collection
+// in addition to the collection itself
+var cacheInvalidations = map[string][]string{
+	"session/poweredGrids":  {"session/grids"},
+	"session/grids":         {"session/characters"},
+	"admin/bannedPlayers":   {"session/players", "session/characters"},
+	"admin/kickedPlayers":   {"session/players", "session/characters"},
+	"admin/promotedPlayers": {"session/players"},
+}
+
+type vrageCacheEntry struct {
+	resource string
+	response *VRageRawResponse
+	expires  time.Time
+}
+
+type vrageCacheCall struct {
+	resource string
+	done     chan struct{}
+	response *VRageRawResponse
+	err      error
+	stale    bool // invalidated while running, the response is not stored
+	canceled bool // the context of the request making the call ended, waiters try again
+}
+
+// VRageResponseCache caches the raw responses of GET requests for a per resource
+// TTL and merges concurrent identical GET requests into one. Mutating requests
+// drop the cached responses of the resources they change.
+type VRageResponseCache struct {
+	DefaultTTL time.Duration
+	ttls       map[string]time.Duration
+	entries    map[string]*vrageCacheEntry
+	calls      map[string]*vrageCacheCall
+	mutex      sync.Mutex
+}
+
+// SetTTL sets how long responses of a resource like "session/grids" are cached,
+// a TTL of zero only merges concurrent requests
+func (cache *VRageResponseCache) SetTTL(resource string, ttl time.Duration) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	cache.ttls[resource] = ttl
+}
+
+// Invalidate drops the cached responses affected by a change of resource
+func (cache *VRageResponseCache) Invalidate(resource string) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	switch resource {
+	case "server":
+		// stopping the server invalidates everything
+		cache.clear()
+		return
+	case "session":
+		// saving does not change anything observable
+		return
+	}
+
+	collection := cacheCollection(resource)
+	affected := append([]string{collection}, cacheInvalidations[collection]...)
+	matches := func(resource string) bool {
+		for _, other := range affected {
+			if resource == other || strings.HasPrefix(resource, other+"/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	for key, entry := range cache.entries {
+		if matches(entry.resource) {
+			delete(cache.entries, key)
+		}
+	}
+	// a GET started before the change may still return the old state
+	for key, call := range cache.calls {
+		if matches(call.resource) {
+			call.stale = true
+			delete(cache.calls, key)
+		}
+	}
+}
+
+// Clear drops all cached responses
+func (cache *VRageResponseCache) Clear() {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	cache.clear()
+}
+
+// clear expects the lock to be held
+func (cache *VRageResponseCache) clear() {
+	cache.entries = make(map[string]*vrageCacheEntry)
+	for key, call := range cache.calls {
+		call.stale = true
+		delete(cache.calls, key)
+	}
+}
+
+// get returns the cached response or calls send, sharing the result with all
+// concurrent callers asking for the same resource. Every caller waits only as
+// long as its own context allows.
+func (cache *VRageResponseCache) get(request *VRageRequest, send func(request *VRageRequest) (*VRageRawResponse, error)) (*VRageRawResponse, error) {
+	key := request.Resource
+	if len(request.Query) > 0 {
+		key += "?" + request.Query.Encode()
+	}
+	ctx := request.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	for {
+		cache.mutex.Lock()
+		if entry, ok := cache.entries[key]; ok {
+			if time.Now().Before(entry.expires) {
+				cache.mutex.Unlock()
+				return entry.response.cached(), nil
+			}
+			delete(cache.entries, key)
+		}
+		call, ok := cache.calls[key]
+		if !ok {
+			break
+		}
+		cache.mutex.Unlock()
+
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if call.canceled {
+			continue // the cancellation belongs to the caller who made the call
+		}
+		if call.err != nil {
+			return nil, call.err
+		}
+		return call.response.cached(), nil
+	}
+
+	call := &vrageCacheCall{resource: request.Resource, done: make(chan struct{})}
+	cache.calls[key] = call
+	cache.mutex.Unlock()
+
+	call.response, call.err = send(request)
+	call.canceled = call.err != nil && ctx.Err() != nil
+
+	cache.mutex.Lock()
+	if cache.calls[key] == call {
+		delete(cache.calls, key)
+	}
+	if ttl := cache.ttl(request.Resource); !call.stale && call.err == nil && ttl > 0 && !isErrorResponse(call.response.Body) {
+		cache.entries[key] = &vrageCacheEntry{resource: request.Resource, response: call.response.cached(), expires: time.Now().Add(ttl)}
+	}
+	cache.mutex.Unlock()
+	close(call.done)
+
+	return call.response, call.err
+}
+
+func (cache *VRageResponseCache) ttl(resource string) time.Duration {
+	if ttl, ok := cache.ttls[resource]; ok {
+		return ttl
+	}
+	return cache.DefaultTTL
+}
+
+// cacheCollection strips a trailing entity or steam id, session/grids/123 becomes session/grids
+func cacheCollection(resource string) string {
+	i := strings.LastIndex(resource, "/")
+	if i < 0 {
+		return resource
+	}
+	if _, err := ParseEntityID(resource[i+1:]); err == nil {
+		return resource[:i]
+	}
+	return resource
+}
+
+func isErrorResponse(body []byte) bool {
+	var response VRageRemoteResponse
+	return json.Unmarshal(body, &response) != nil || response.Error != nil
+}
+
+// NewVRageResponseCache creates a cache keeping GET responses for defaultTTL. The
+// server info and ping are never cached so health checks always see the server.
+func NewVRageResponseCache(defaultTTL time.Duration) *VRageResponseCache {
+	return &VRageResponseCache{
+		DefaultTTL: defaultTTL,
+		ttls: map[string]time.Duration{
+			"server":      0,
+			"server/ping": 0,
+		},
+		entries: make(map[string]*vrageCacheEntry),
+		calls:   make(map[string]*vrageCacheCall),
+	}
+}
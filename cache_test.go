@@ -0,0 +1,254 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package govrageremote
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// cacheSender stands in for the server, every call answers with the number of
+// calls made so far. Calls block while release is open.
+type cacheSender struct {
+	calls   int32
+	started chan struct{}
+	release chan struct{}
+}
+
+func newCacheSender() *cacheSender {
+	return &cacheSender{started: make(chan struct{}, 100), release: make(chan struct{})}
+}
+
+func (sender *cacheSender) send(request *VRageRequest) (*VRageRawResponse, error) {
+	n := atomic.AddInt32(&sender.calls, 1)
+	sender.started <- struct{}{}
+	ctx := request.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	select {
+	case <-sender.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return &VRageRawResponse{StatusCode: 200, Body: []byte{'{', '"', 'n', '"', ':', byte('0' + n), '}'}}, nil
+}
+
+func (sender *cacheSender) count() int {
+	return int(atomic.LoadInt32(&sender.calls))
+}
+
+func getRequest(ctx context.Context, resource string) *VRageRequest {
+	return &VRageRequest{Context: ctx, Method: "GET", Resource: resource}
+}
+
+func TestCacheMergesConcurrentRequests(t *testing.T) {
+	cache := NewVRageResponseCache(time.Minute)
+	sender := newCacheSender()
+
+	const callers = 5
+	responses := make([]*VRageRawResponse, callers)
+	var wait sync.WaitGroup
+	wait.Add(1)
+	go func() {
+		defer wait.Done()
+		responses[0], _ = cache.get(getRequest(nil, "session/grids"), sender.send)
+	}()
+	<-sender.started
+	for i := 1; i < callers; i++ {
+		wait.Add(1)
+		go func(i int) {
+			defer wait.Done()
+			responses[i], _ = cache.get(getRequest(nil, "session/grids"), sender.send)
+		}(i)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(sender.release)
+	wait.Wait()
+
+	if sender.count() != 1 {
+		t.Errorf("sent %d requests, want 1", sender.count())
+	}
+	if responses[0] == nil || responses[0].Cached {
+		t.Errorf("first caller got %+v, want an uncached response", responses[0])
+	}
+	for i, response := range responses[1:] {
+		if response == nil || !response.Cached || string(response.Body) != `{"n":1}` {
+			t.Errorf("caller %d got %+v", i+1, response)
+		}
+	}
+}
+
+func TestCacheCopiesBody(t *testing.T) {
+	cache := NewVRageResponseCache(time.Minute)
+	sender := newCacheSender()
+	close(sender.release)
+
+	first, err := cache.get(getRequest(nil, "session/grids"), sender.send)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.Body[len(first.Body)-2] = 'x'
+
+	second, _ := cache.get(getRequest(nil, "session/grids"), sender.send)
+	second.Body[0] = 'x'
+	third, _ := cache.get(getRequest(nil, "session/grids"), sender.send)
+
+	if string(third.Body) != `{"n":1}` || !third.Cached {
+		t.Errorf("cached body changed to %s", third.Body)
+	}
+	if sender.count() != 1 {
+		t.Errorf("sent %d requests, want 1", sender.count())
+	}
+}
+
+func TestCacheWaiterContext(t *testing.T) {
+	cache := NewVRageResponseCache(time.Minute)
+	sender := newCacheSender()
+
+	// the first caller blocks, a waiter gives up when its own context ends
+	done := make(chan error, 1)
+	go func() {
+		_, err := cache.get(getRequest(nil, "session/grids"), sender.send)
+		done <- err
+	}()
+	<-sender.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := cache.get(getRequest(ctx, "session/grids"), sender.send)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("waiter got %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	close(sender.release)
+	if err := <-done; err != nil {
+		t.Errorf("first caller got %v", err)
+	}
+}
+
+func TestCacheCallerCanceled(t *testing.T) {
+	cache := NewVRageResponseCache(time.Minute)
+	sender := newCacheSender()
+
+	// the first caller is canceled, the waiter does not share the error
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := cache.get(getRequest(ctx, "session/grids"), sender.send)
+		done <- err
+	}()
+	<-sender.started
+
+	waiter := make(chan *VRageRawResponse, 1)
+	go func() {
+		response, err := cache.get(getRequest(nil, "session/grids"), sender.send)
+		if err != nil {
+			t.Errorf("waiter got %v", err)
+		}
+		waiter <- response
+	}()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("first caller got %v, want %v", err, context.Canceled)
+	}
+
+	<-sender.started
+	close(sender.release)
+	if response := <-waiter; response == nil || string(response.Body) != `{"n":2}` {
+		t.Errorf("waiter got %+v", response)
+	}
+}
+
+func TestCacheInvalidation(t *testing.T) {
+	tests := []struct {
+		get     string
+		changed string
+		dropped bool
+	}{
+		{"session/grids", "session/grids/5", true},
+		{"session/grids", "session/poweredGrids/5", true},
+		{"session/characters", "session/grids/5", true},
+		{"session/players", "admin/kickedPlayers/76561198000000001", true},
+		{"session/grids", "admin/promotedPlayers/76561198000000001", false},
+		{"session/grids", "session", false},
+		{"session/grids", "server", true},
+		{"session/planets", "session/asteroids/5", false},
+	}
+	for _, test := range tests {
+		cache := NewVRageResponseCache(time.Minute)
+		sender := newCacheSender()
+		close(sender.release)
+
+		cache.get(getRequest(nil, test.get), sender.send)
+		cache.Invalidate(test.changed)
+		response, _ := cache.get(getRequest(nil, test.get), sender.send)
+		if response.Cached == test.dropped {
+			t.Errorf("changing %s: %s cached = %t, want %t", test.changed, test.get, response.Cached, !test.dropped)
+		}
+	}
+}
+
+func TestCacheStaleCall(t *testing.T) {
+	cache := NewVRageResponseCache(time.Minute)
+	sender := newCacheSender()
+
+	// a GET running while the grid is deleted must not be stored
+	done := make(chan struct{})
+	go func() {
+		cache.get(getRequest(nil, "session/grids"), sender.send)
+		close(done)
+	}()
+	<-sender.started
+	cache.Invalidate("session/grids/5")
+	close(sender.release)
+	<-done
+
+	response, err := cache.get(getRequest(nil, "session/grids"), sender.send)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Cached || string(response.Body) != `{"n":2}` {
+		t.Errorf("got %+v with body %s, want a fresh response", response, response.Body)
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	cache := NewVRageResponseCache(time.Minute)
+	cache.SetTTL("session/chat", 10*time.Millisecond)
+	sender := newCacheSender()
+	close(sender.release)
+
+	for _, resource := range []string{"server", "server/ping"} {
+		cache.get(getRequest(nil, resource), sender.send)
+		if response, _ := cache.get(getRequest(nil, resource), sender.send); response.Cached {
+			t.Errorf("%s was cached", resource)
+		}
+	}
+
+	cache.get(getRequest(nil, "session/chat"), sender.send)
+	if response, _ := cache.get(getRequest(nil, "session/chat"), sender.send); !response.Cached {
+		t.Error("session/chat was not cached")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if response, _ := cache.get(getRequest(nil, "session/chat"), sender.send); response.Cached {
+		t.Error("session/chat was cached past its TTL")
+	}
+}
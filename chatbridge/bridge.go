@@ -0,0 +1,197 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package chatbridge relays chat between a Space Engineers server and an external channel.
+package chatbridge
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"gopkg.in/uranoxyd/govrageremote.v2"
+)
+
+// DefaultMaxLength is the longest message the game accepts in its chat
+const DefaultMaxLength = 200
+
+type Message struct {
+	SteamID govrageremote.SteamID
+	Author  string
+	Content string
+	Time    time.Time
+}
+
+// Sink receives the in-game chat messages relayed by a Bridge
+type Sink interface {
+	Send(message *Message) error
+}
+
+type SinkFunc func(message *Message) error
+
+func (fnc SinkFunc) Send(message *Message) error {
+	return fnc(message)
+}
+
+type Bridge struct {
+	client       *govrageremote.VRageRemoteClient
+	watcher      *govrageremote.VRageChatWatcher
+	Sink         Sink
+	AuthorFormat string        // fmt format for the author prefix of relayed external messages
+	MaxLength    int           // messages longer than this are split
+	EchoTimeout  time.Duration // how long sent messages are remembered to drop their echo
+	OnError      func(err error)
+	sent         map[string]time.Time
+	mutex        sync.Mutex
+}
+
+// Relay sends a message of an external author into the game chat
+func (bridge *Bridge) Relay(author string, content string) error {
+	prefix := fmt.Sprintf(bridge.AuthorFormat, author)
+
+	for _, part := range Split(content, bridge.MaxLength-len([]rune(prefix))) {
+		text := prefix + part
+
+		bridge.mutex.Lock()
+		bridge.sent[text] = time.Now()
+		bridge.mutex.Unlock()
+
+		if err := bridge.client.SendChat(text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PollError lists the messages the sink failed to take and why, the other
+// messages of the poll were relayed
+type PollError struct {
+	Failed []*Message
+	Errors []error
+}
+
+func (err *PollError) Error() string {
+	if len(err.Errors) == 1 {
+		return "could not relay a message: " + err.Errors[0].Error()
+	}
+	return fmt.Sprintf("could not relay %d messages, first error: %v", len(err.Errors), err.Errors[0])
+}
+
+// Poll relays new in-game messages to the sink, skipping the echo of messages
+// sent by Relay. The watcher does not return a message twice, so a failing
+// message does not stop the rest, they are all tried and the failures are
+// returned as a *PollError.
+func (bridge *Bridge) Poll() error {
+	messages, err := bridge.watcher.Poll()
+	if err != nil {
+		return err
+	}
+
+	var pollErr *PollError
+	for _, message := range messages {
+		if bridge.isEcho(message.Content) {
+			continue
+		}
+		relayed := &Message{
+			SteamID: message.SteamID,
+			Author:  message.DisplayName,
+			Content: message.Content,
+			Time:    message.Time(),
+		}
+		if err := bridge.Sink.Send(relayed); err != nil {
+			if pollErr == nil {
+				pollErr = &PollError{}
+			}
+			pollErr.Failed = append(pollErr.Failed, relayed)
+			pollErr.Errors = append(pollErr.Errors, err)
+		}
+	}
+	if pollErr != nil {
+		return pollErr
+	}
+	return nil
+}
+
+// Run polls the game chat every interval until stop is closed
+func (bridge *Bridge) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := bridge.Poll(); err != nil && bridge.OnError != nil {
+				bridge.OnError(err)
+			}
+		}
+	}
+}
+
+func (bridge *Bridge) isEcho(content string) bool {
+	bridge.mutex.Lock()
+	defer bridge.mutex.Unlock()
+
+	for text, sent := range bridge.sent {
+		if time.Since(sent) > bridge.EchoTimeout {
+			delete(bridge.sent, text)
+		}
+	}
+
+	if _, ok := bridge.sent[content]; ok {
+		delete(bridge.sent, content)
+		return true
+	}
+	return false
+}
+
+// Split breaks content into parts of at most maxLength runes, preferring to break at whitespace
+func Split(content string, maxLength int) []string {
+	if maxLength < 1 {
+		maxLength = 1
+	}
+
+	var parts []string
+	runes := []rune(strings.TrimSpace(content))
+	for len(runes) > maxLength {
+		cut := maxLength
+		for i := maxLength; i > maxLength/2; i-- {
+			if unicode.IsSpace(runes[i]) {
+				cut = i
+				break
+			}
+		}
+		parts = append(parts, strings.TrimSpace(string(runes[:cut])))
+		runes = []rune(strings.TrimLeftFunc(string(runes[cut:]), unicode.IsSpace))
+	}
+	if len(runes) > 0 {
+		parts = append(parts, string(runes))
+	}
+	return parts
+}
+
+func NewBridge(client *govrageremote.VRageRemoteClient, sink Sink) *Bridge {
+	return &Bridge{
+		client:       client,
+		watcher:      govrageremote.NewVRageChatWatcher(client),
+		Sink:         sink,
+		AuthorFormat: "[%s] ",
+		MaxLength:    DefaultMaxLength,
+		EchoTimeout:  time.Minute,
+		sent:         make(map[string]time.Time),
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package chatbridge
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"unicode/utf8"
+
+	"gopkg.in/uranoxyd/govrageremote.v2"
+)
+
+// chatServer serves the chat history in messages and appends what is sent to it
+type chatServer struct {
+	mutex    sync.Mutex
+	messages []map[string]interface{}
+	sent     []string
+	ticks    int64
+}
+
+func newChatServer(t *testing.T) (*chatServer, *govrageremote.VRageRemoteClient) {
+	chat := &chatServer{ticks: 637450560000000000}
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		chat.mutex.Lock()
+		defer chat.mutex.Unlock()
+
+		switch request.Method {
+		case "GET":
+			data, _ := json.Marshal(map[string]interface{}{"Messages": chat.messages})
+			fmt.Fprintf(writer, `{"data":%s,"meta":{"apiVersion":"1.0","queryTime":1}}`, data)
+		case "POST":
+			body, _ := ioutil.ReadAll(request.Body)
+			var text string
+			json.Unmarshal(body, &text)
+			chat.sent = append(chat.sent, text)
+			fmt.Fprint(writer, `{"meta":{"apiVersion":"1.0","queryTime":1}}`)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return chat, govrageremote.NewVRageRemoteClient(server.URL, "c2VjcmV0")
+}
+
+func (chat *chatServer) say(author string, content string) {
+	chat.mutex.Lock()
+	defer chat.mutex.Unlock()
+	chat.ticks += 10000000
+	chat.messages = append(chat.messages, map[string]interface{}{
+		"SteamID": "76561198000000001", "DisplayName": author, "Content": content, "Timestamp": chat.ticks,
+	})
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		content   string
+		maxLength int
+		want      []string
+	}{
+		{"hello", 10, []string{"hello"}},
+		{"  hello  ", 10, []string{"hello"}},
+		{"", 10, nil},
+		{"   ", 10, nil},
+		{"hello world", 5, []string{"hello", "world"}},
+		{"hello world foo", 11, []string{"hello world", "foo"}},
+		{"one two three four", 9, []string{"one two", "three", "four"}},
+		{"abcdefghij", 4, []string{"abcd", "efgh", "ij"}},
+		{"abc defghij", 4, []string{"abc", "defg", "hij"}},
+		{"ab cdefghij", 4, []string{"ab c", "defg", "hij"}}, // only spaces in the second half are used
+		{"äöü äöü", 3, []string{"äöü", "äöü"}},
+		{"abc", 0, []string{"a", "b", "c"}},
+	}
+
+	for _, test := range tests {
+		got := Split(test.content, test.maxLength)
+		if fmt.Sprintf("%q", got) != fmt.Sprintf("%q", test.want) {
+			t.Errorf("Split(%q, %d) = %q, want %q", test.content, test.maxLength, got, test.want)
+		}
+		for _, part := range got {
+			if max := test.maxLength; max > 0 && utf8.RuneCountInString(part) > max {
+				t.Errorf("Split(%q, %d) part %q is too long", test.content, test.maxLength, part)
+			}
+		}
+	}
+}
+
+func TestRelaySplitsWithPrefix(t *testing.T) {
+	chat, client := newChatServer(t)
+	bridge := NewBridge(client, nil)
+	bridge.MaxLength = 20
+
+	if err := bridge.Relay("bob", "the quick brown fox jumps over the lazy dog"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"[bob] the quick", "[bob] brown fox", "[bob] jumps over the", "[bob] lazy dog"}
+	if fmt.Sprintf("%q", chat.sent) != fmt.Sprintf("%q", want) {
+		t.Errorf("sent %q, want %q", chat.sent, want)
+	}
+	for _, text := range chat.sent {
+		if utf8.RuneCountInString(text) > bridge.MaxLength {
+			t.Errorf("%q is longer than %d", text, bridge.MaxLength)
+		}
+	}
+}
+
+func TestPollSkipsEcho(t *testing.T) {
+	chat, client := newChatServer(t)
+	var relayed []string
+	bridge := NewBridge(client, SinkFunc(func(message *Message) error {
+		relayed = append(relayed, message.Author+": "+message.Content)
+		return nil
+	}))
+
+	chat.say("alice", "before the bridge")
+	if err := bridge.Poll(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := bridge.Relay("bob", "hi"); err != nil {
+		t.Fatal(err)
+	}
+	chat.say("Server", "[bob] hi") // the echo of the relayed message
+	chat.say("alice", "hello bob")
+	chat.say("mallory", "[bob] hi") // looks the same but the echo was already dropped
+	if err := bridge.Poll(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"alice: hello bob", "mallory: [bob] hi"}
+	if fmt.Sprintf("%q", relayed) != fmt.Sprintf("%q", want) {
+		t.Errorf("relayed %q, want %q", relayed, want)
+	}
+}
+
+func TestPollContinuesAfterSinkError(t *testing.T) {
+	chat, client := newChatServer(t)
+	var relayed []string
+	bridge := NewBridge(client, SinkFunc(func(message *Message) error {
+		if strings.HasPrefix(message.Content, "fail") {
+			return errors.New("sink down")
+		}
+		relayed = append(relayed, message.Content)
+		return nil
+	}))
+	if err := bridge.Poll(); err != nil {
+		t.Fatal(err)
+	}
+
+	chat.say("alice", "one")
+	chat.say("alice", "fail two")
+	chat.say("alice", "three")
+	chat.say("alice", "fail four")
+
+	err := bridge.Poll()
+	var pollErr *PollError
+	if !errors.As(err, &pollErr) {
+		t.Fatalf("Poll() error = %v, want a *PollError", err)
+	}
+	if len(pollErr.Failed) != 2 || pollErr.Failed[0].Content != "fail two" || pollErr.Failed[1].Content != "fail four" {
+		t.Errorf("failed = %v", pollErr.Failed)
+	}
+	if !strings.Contains(err.Error(), "2 messages") {
+		t.Errorf("error = %q", err)
+	}
+	if fmt.Sprint(relayed) != "[one three]" {
+		t.Errorf("relayed %v, want [one three]", relayed)
+	}
+}
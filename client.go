@@ -16,6 +16,7 @@ package govrageremote
 
 import (
 	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/sha1"
 	"encoding/base64"
@@ -28,32 +29,35 @@ import (
 	"net/http"
 	"net/url"
 	"sort"
-	"strconv"
 	"sync"
 	"time"
 )
 
-var requestMutex sync.Mutex
-
-//-- https://stackoverflow.com/questions/33144967/what-is-the-c-sharp-datetimeoffset-equivalent-in-go/33161703#33161703
-//-- This feels just not right, I'm looking in your direction Keen Software House :)
-func timeFromTicks(ticks int64) time.Time {
-	return time.Unix(ticks/10e6-62135596800, ticks%10e6)
-}
-func ticksFromTime(value time.Time) int64 {
-	return int64(((float64(value.UnixNano()) / 1e9) + 62135596800) * 10e6)
-}
-
 type VRagePositionable interface {
 	GetPosition() VRagePosition
 }
 
 type VRageRemoteClient struct {
-	BaseURL       string
-	RemoteAddress string
-	Key           string
-	httpClient    *http.Client
-	nonce         int64
+	BaseURL         string
+	RemoteAddress   string
+	Key             string
+	ReadLimiter     *VRageRateLimiter
+	WriteLimiter    *VRageRateLimiter
+	Throttle        *VRageAdaptiveThrottle
+	Cache           *VRageResponseCache
+	Retry           *VRageRetryPolicy
+	logger          VRageLogger
+	slowThreshold   time.Duration
+	VersionPolicy   VRageVersionPolicy
+	StrictDecoding  VRageStrictMode
+	OnSchemaDrift   func(err *VRageSchemaError)
+	apiVersion      string
+	versionMutex    sync.Mutex
+	middlewares     []VRageMiddleware
+	middlewareMutex sync.RWMutex
+	httpClient      *http.Client
+	nonce           int64
+	nonceMutex      sync.Mutex
 }
 
 type VRagePosition struct {
@@ -95,10 +99,11 @@ type VRageRemoteCharacterList struct {
 type VRageRemoteCharacter struct {
 	client      *VRageRemoteClient
 	DisplayName string
-	EntityID    int64 `json:"EntityId"`
+	EntityID    EntityID `json:"EntityId"`
 	Mass        float64
 	Position    VRagePosition
 	LinearSpeed float64
+	Extra       map[string]json.RawMessage `json:"-"`
 }
 
 func (char *VRageRemoteCharacter) GetPosition() VRagePosition {
@@ -127,9 +132,10 @@ type VRageRemotePlayer struct {
 	FactionTag   string
 	PromoteLevel int
 	Ping         float64
-	SteamID      int64
+	SteamID      SteamID
 	DisplayName  string
 	FactionName  string
+	Extra        map[string]json.RawMessage `json:"-"`
 }
 
 func (player *VRageRemotePlayer) Kick() error {
@@ -153,8 +159,9 @@ type VRageRemoteAsteroidsList struct {
 type VRageRemoteAsteroid struct {
 	client      *VRageRemoteClient
 	DisplayName string
-	EntityID    int64
+	EntityID    EntityID
 	Position    VRagePosition
+	Extra       map[string]json.RawMessage `json:"-"`
 }
 
 func (roid *VRageRemoteAsteroid) GetPosition() VRagePosition {
@@ -181,12 +188,13 @@ type VRageRemoteFloatingObjectList struct {
 type VRageRemoteFloatingObject struct {
 	client           *VRageRemoteClient
 	DisplayName      string
-	EntityID         int64 `json:"EntityId"`
+	EntityID         EntityID `json:"EntityId"`
 	Kind             string
 	Mass             float64
 	Position         VRagePosition
 	LinearSpeed      float64
 	DistanceToPlayer float64
+	Extra            map[string]json.RawMessage `json:"-"`
 }
 
 func (object *VRageRemoteFloatingObject) GetPosition() VRagePosition {
@@ -242,17 +250,18 @@ type VRageRemoteGridList struct {
 type VRageRemoteGrid struct {
 	client           *VRageRemoteClient
 	DisplayName      string
-	EntityID         int64 `json:"EntityId"`
+	EntityID         EntityID `json:"EntityId"`
 	GridSize         string
 	BlocksCount      int64
 	Mass             float64
 	Position         VRagePosition
 	LinearSpeed      float64
 	DistanceToPlayer float64
-	OwnerSteamID     int64 `json:"OwnerSteamId"`
+	OwnerSteamID     SteamID `json:"OwnerSteamId"`
 	OwnerDisplayName string
 	IsPowered        bool
 	PCU              int64
+	Extra            map[string]json.RawMessage `json:"-"`
 }
 
 func (grid *VRageRemoteGrid) GetPosition() VRagePosition {
@@ -288,8 +297,9 @@ type VRageRemotePlanetList struct {
 type VRagePlanet struct {
 	client      *VRageRemoteClient
 	DisplayName string
-	EntityID    int64 `json:"EntityId"`
+	EntityID    EntityID `json:"EntityId"`
 	Position    VRagePosition
+	Extra       map[string]json.RawMessage `json:"-"`
 }
 
 func (planet *VRagePlanet) GetPosition() VRagePosition {
@@ -314,15 +324,23 @@ type VRageRemoteChatMessageList struct {
 	Messages []*VRageChatMessage
 }
 type VRageChatMessage struct {
-	SteamID     int64
+	SteamID     SteamID
 	DisplayName string
 	Content     string
-	Timestamp   string
+	Timestamp   DotNetTicks
+	Extra       map[string]json.RawMessage `json:"-"`
 }
 
+// Time returns when the message was sent
+func (message *VRageChatMessage) Time() time.Time {
+	return message.Timestamp.Time()
+}
+
+// GetRealTimestamp returns when the message was sent.
+//
+// Deprecated: use Time.
 func (message *VRageChatMessage) GetRealTimestamp() time.Time {
-	csTimestamp, _ := strconv.ParseInt(message.Timestamp, 10, 64)
-	return timeFromTicks(csTimestamp)
+	return message.Timestamp.Time()
 }
 
 //--
@@ -337,7 +355,7 @@ type VRageRemoteServerInfo struct {
 	Game              string
 	IsReady           bool
 	Players           int64
-	ServerID          int64 `json:"ServerId"`
+	ServerID          SteamID `json:"ServerId"`
 	ServerName        string
 	SimSpeed          float64
 	SimulationCPULoad float64 `json:"SimulationCpuLoad"`
@@ -346,6 +364,7 @@ type VRageRemoteServerInfo struct {
 	UsedPCU           int64
 	Version           string
 	WorldName         string
+	Extra             map[string]json.RawMessage `json:"-"`
 }
 
 //--
@@ -360,8 +379,9 @@ type VRageRemoteBannedPlayersList struct {
 	BannedPlayers []*VRageBannedPlayer
 }
 type VRageBannedPlayer struct {
-	SteamID     int64
+	SteamID     SteamID
 	DisplayName string
+	Extra       map[string]json.RawMessage `json:"-"`
 }
 
 //--
@@ -376,9 +396,16 @@ type VRageRemoteKickedPlayersList struct {
 	KickedPlayers []*VRageKickedPlayer
 }
 type VRageKickedPlayer struct {
-	SteamID     int64
+	SteamID     SteamID
 	DisplayName string
-	Time        int64
+	Time        DotNetTicks
+	Extra       map[string]json.RawMessage `json:"-"`
+}
+
+// KickTime returns the Time field as a time.Time, a method named Time would clash
+// with the field
+func (player *VRageKickedPlayer) KickTime() time.Time {
+	return player.Time.Time()
 }
 
 //--
@@ -438,7 +465,7 @@ func (client *VRageRemoteClient) GetCharacters() (*VRageRemoteCharacterListRespo
 
 	return response, nil
 }
-func (client *VRageRemoteClient) StopCharacter(entityID int64) error {
+func (client *VRageRemoteClient) StopCharacter(entityID EntityID) error {
 	response := &VRageRemoteResponse{}
 	err := client.scanResponse("PATCH", fmt.Sprintf("session/characters/%d", entityID), nil, nil, response)
 	if err != nil {
@@ -483,7 +510,7 @@ func (client *VRageRemoteClient) GetAsteroids() (*VRageRemoteAsteroidsListRespon
 
 	return response, nil
 }
-func (client *VRageRemoteClient) DeleteAsteroid(entityID int64) error {
+func (client *VRageRemoteClient) DeleteAsteroid(entityID EntityID) error {
 	response := &VRageRemoteResponse{}
 	err := client.scanResponse("DELETE", fmt.Sprintf("session/asteroids/%d", entityID), nil, nil, response)
 	if err != nil {
@@ -511,7 +538,7 @@ func (client *VRageRemoteClient) GetFloatingObjects() (*VRageRemoteFloatingObjec
 
 	return response, nil
 }
-func (client *VRageRemoteClient) DeleteFloatingObject(entityID int64) error {
+func (client *VRageRemoteClient) DeleteFloatingObject(entityID EntityID) error {
 	response := &VRageRemoteResponse{}
 	err := client.scanResponse("DELETE", fmt.Sprintf("session/floatingObjects/%d", entityID), nil, nil, response)
 	if err != nil {
@@ -522,7 +549,7 @@ func (client *VRageRemoteClient) DeleteFloatingObject(entityID int64) error {
 	}
 	return nil
 }
-func (client *VRageRemoteClient) StopFloatingObject(entityID int64) error {
+func (client *VRageRemoteClient) StopFloatingObject(entityID EntityID) error {
 	response := &VRageRemoteResponse{}
 	err := client.scanResponse("PATCH", fmt.Sprintf("session/floatingObjects/%d", entityID), nil, nil, response)
 	if err != nil {
@@ -550,7 +577,7 @@ func (client *VRageRemoteClient) GetGrids() (*VRageRemoteGridListResponse, error
 
 	return response, nil
 }
-func (client *VRageRemoteClient) DeleteGrid(entityID int64) error {
+func (client *VRageRemoteClient) DeleteGrid(entityID EntityID) error {
 	response := &VRageRemoteResponse{}
 	err := client.scanResponse("DELETE", fmt.Sprintf("session/grids/%d", entityID), nil, nil, response)
 	if err != nil {
@@ -561,7 +588,7 @@ func (client *VRageRemoteClient) DeleteGrid(entityID int64) error {
 	}
 	return nil
 }
-func (client *VRageRemoteClient) StopGrid(entityID int64) error {
+func (client *VRageRemoteClient) StopGrid(entityID EntityID) error {
 	response := &VRageRemoteResponse{}
 	err := client.scanResponse("PATCH", fmt.Sprintf("session/grids/%d", entityID), nil, nil, response)
 	if err != nil {
@@ -572,7 +599,7 @@ func (client *VRageRemoteClient) StopGrid(entityID int64) error {
 	}
 	return nil
 }
-func (client *VRageRemoteClient) PowerUpGrid(entityID int64) error {
+func (client *VRageRemoteClient) PowerUpGrid(entityID EntityID) error {
 	response := &VRageRemoteResponse{}
 	err := client.scanResponse("POST", fmt.Sprintf("session/poweredGrids/%d", entityID), nil, nil, response)
 	if err != nil {
@@ -583,7 +610,7 @@ func (client *VRageRemoteClient) PowerUpGrid(entityID int64) error {
 	}
 	return nil
 }
-func (client *VRageRemoteClient) PowerDownGrid(entityID int64) error {
+func (client *VRageRemoteClient) PowerDownGrid(entityID EntityID) error {
 	response := &VRageRemoteResponse{}
 	err := client.scanResponse("DELETE", fmt.Sprintf("session/poweredGrids/%d", entityID), nil, nil, response)
 	if err != nil {
@@ -611,7 +638,7 @@ func (client *VRageRemoteClient) GetPlanets() (*VRageRemotePlanetListResponse, e
 
 	return response, nil
 }
-func (client *VRageRemoteClient) DeletePlanet(entityID int64) error {
+func (client *VRageRemoteClient) DeletePlanet(entityID EntityID) error {
 	response := &VRageRemoteResponse{}
 	err := client.scanResponse("DELETE", fmt.Sprintf("session/planets/%d", entityID), nil, nil, response)
 	if err != nil {
@@ -670,7 +697,7 @@ func (client *VRageRemoteClient) Ping() (time.Duration, error) {
 	return time.Since(start), err
 }
 
-func (client *VRageRemoteClient) PromotePlayer(steamID int64) error {
+func (client *VRageRemoteClient) PromotePlayer(steamID SteamID) error {
 	response := &VRageRemoteResponse{}
 	err := client.scanResponse("POST", fmt.Sprintf("admin/promotedPlayers/%d", steamID), nil, nil, response)
 	if err != nil {
@@ -681,7 +708,7 @@ func (client *VRageRemoteClient) PromotePlayer(steamID int64) error {
 	}
 	return nil
 }
-func (client *VRageRemoteClient) DemotePlayer(steamID int64) error {
+func (client *VRageRemoteClient) DemotePlayer(steamID SteamID) error {
 	response := &VRageRemoteResponse{}
 	err := client.scanResponse("DELETE", fmt.Sprintf("admin/promotedPlayers/%d", steamID), nil, nil, response)
 	if err != nil {
@@ -704,7 +731,7 @@ func (client *VRageRemoteClient) GetBannedPlayers() (*VRageRemoteBannedPlayersLi
 	}
 	return response, nil
 }
-func (client *VRageRemoteClient) BanPlayer(steamID int64) error {
+func (client *VRageRemoteClient) BanPlayer(steamID SteamID) error {
 	response := &VRageRemoteResponse{}
 	err := client.scanResponse("POST", fmt.Sprintf("admin/bannedPlayers/%d", steamID), nil, nil, response)
 	if err != nil {
@@ -715,7 +742,7 @@ func (client *VRageRemoteClient) BanPlayer(steamID int64) error {
 	}
 	return nil
 }
-func (client *VRageRemoteClient) UnbanPlayer(steamID int64) error {
+func (client *VRageRemoteClient) UnbanPlayer(steamID SteamID) error {
 	response := &VRageRemoteResponse{}
 	err := client.scanResponse("DELETE", fmt.Sprintf("admin/bannedPlayers/%d", steamID), nil, nil, response)
 	if err != nil {
@@ -738,7 +765,7 @@ func (client *VRageRemoteClient) GetKickedPlayers() (*VRageRemoteKickedPlayersLi
 	}
 	return response, nil
 }
-func (client *VRageRemoteClient) KickPlayer(steamID int64) error {
+func (client *VRageRemoteClient) KickPlayer(steamID SteamID) error {
 	response := &VRageRemoteResponse{}
 	err := client.scanResponse("POST", fmt.Sprintf("admin/kickedPlayers/%d", steamID), nil, nil, response)
 	if err != nil {
@@ -749,7 +776,7 @@ func (client *VRageRemoteClient) KickPlayer(steamID int64) error {
 	}
 	return nil
 }
-func (client *VRageRemoteClient) UnkickPlayer(steamID int64) error {
+func (client *VRageRemoteClient) UnkickPlayer(steamID SteamID) error {
 	response := &VRageRemoteResponse{}
 	err := client.scanResponse("DELETE", fmt.Sprintf("admin/kickedPlayers/%d", steamID), nil, nil, response)
 	if err != nil {
@@ -762,65 +789,175 @@ func (client *VRageRemoteClient) UnkickPlayer(steamID int64) error {
 }
 
 func (client *VRageRemoteClient) scanResponse(method string, resource string, query url.Values, body interface{}, responseStruct interface{}) error {
-	requestMutex.Lock()
-	defer requestMutex.Unlock()
+	_, err := client.scanResponseContext(context.Background(), method, resource, query, body, responseStruct)
+	return err
+}
+
+func (client *VRageRemoteClient) scanResponseContext(ctx context.Context, method string, resource string, query url.Values, body interface{}, responseStruct interface{}) (*VRageRawResponse, error) {
+	response, err := client.doer().Do(&VRageRequest{
+		Context:  ctx,
+		Method:   method,
+		Resource: resource,
+		Query:    query,
+		Body:     body,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(response.Body, responseStruct)
+	if err != nil {
+		client.log().Error("could not decode remote api response", "method", method, "resource", resource, "status", response.StatusCode, "error", err.Error())
+		if _, ok := err.(*json.UnmarshalTypeError); ok {
+			client.inspectResponse(resource, response.Body, responseStruct) // let OnSchemaDrift see the full list of mismatches
+		}
+		return response, err
+	}
+
+	err = client.inspectResponse(resource, response.Body, responseStruct)
+	if err != nil {
+		return response, err
+	}
+
+	return response, nil
+}
+
+// do is the innermost VRageDoer, it serves from the cache or sends the request
+func (client *VRageRemoteClient) do(request *VRageRequest) (*VRageRawResponse, error) {
+	// under VRageVersionFail a write must not reach a server whose version is
+	// unknown, it would take effect before the response tells it is unsupported
+	if client.VersionPolicy == VRageVersionFail && request.Method != "GET" && client.APIVersion() == "" {
+		if _, err := client.NegotiateAPIVersion(request.Context); err != nil {
+			return nil, err
+		}
+	}
+	if err := client.checkAPIVersion(); err != nil {
+		return nil, err
+	}
+
+	response, err := client.retry(request, func(request *VRageRequest) (*VRageRawResponse, error) {
+		return client.logRequest(request, client.cachedSend)
+	})
+	if err != nil {
+		return response, err
+	}
+	return response, client.discoverAPIVersion(response)
+}
 
-	methodURL := client.BaseURL + "/" + resource
+func (client *VRageRemoteClient) cachedSend(request *VRageRequest) (*VRageRawResponse, error) {
+	if client.Cache != nil && request.Method == "GET" {
+		return client.Cache.get(request, client.send)
+	}
+
+	response, err := client.send(request)
+	if client.Cache != nil && err == nil {
+		client.Cache.Invalidate(request.Resource)
+	}
+	return response, err
+}
+
+// SignVRageRequest computes the signature the Remote API expects in the
+// Authorization header as "nonce:signature". methodURL is the request path
+// including the query, key is the base64 encoded Remote API key.
+func SignVRageRequest(key string, methodURL string, nonce string, date string) (string, error) {
+	keyDecoded, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return "", errors.New("error decoding client key")
+	}
+	mac := hmac.New(sha1.New, keyDecoded)
+	mac.Write([]byte(methodURL + "\r\n" + nonce + "\r\n" + date + "\r\n"))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil)), nil
+}
 
-	if query != nil && len(query) > 0 {
-		methodURL += "?" + query.Encode()
+// VerifyVRageRequest checks a signature made by SignVRageRequest in constant time
+func VerifyVRageRequest(key string, methodURL string, nonce string, date string, signature string) bool {
+	expected, err := SignVRageRequest(key, methodURL, nonce, date)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// SetTransport replaces the http.RoundTripper used to talk to the server, nil
+// restores http.DefaultTransport
+func (client *VRageRemoteClient) SetTransport(transport http.RoundTripper) {
+	client.httpClient.Transport = transport
+}
+
+func (client *VRageRemoteClient) send(request *VRageRequest) (*VRageRawResponse, error) {
+	methodURL := client.BaseURL + "/" + request.Resource
+
+	if request.Query != nil && len(request.Query) > 0 {
+		methodURL += "?" + request.Query.Encode()
 	}
 
 	var bodyReader io.Reader
-	if body != nil {
-		requestBodyBytes, err := json.Marshal(body)
+	if request.Body != nil {
+		requestBodyBytes, err := json.Marshal(request.Body)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		bodyReader = bytes.NewBuffer(requestBodyBytes)
 	}
 
-	request, err := http.NewRequest(method, client.RemoteAddress+methodURL, bodyReader)
+	ctx := request.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	httpRequest, err := http.NewRequestWithContext(ctx, request.Method, client.RemoteAddress+methodURL, bodyReader)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	if limiter := client.limiterFor(request.Method); limiter != nil {
+		if err := limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
 	}
 
 	date := time.Now().UTC().Format(time.RFC1123Z)
+	client.nonceMutex.Lock()
 	nounce := fmt.Sprint(client.nonce)
 	client.nonce++
+	client.nonceMutex.Unlock()
 
-	keyDecoded, err := base64.StdEncoding.DecodeString(client.Key)
+	encodedHash, err := SignVRageRequest(client.Key, methodURL, nounce, date)
 	if err != nil {
-		return errors.New("error decoding client key")
+		return nil, err
 	}
-	mac := hmac.New(sha1.New, keyDecoded)
-	mac.Write([]byte(methodURL + "\r\n" + nounce + "\r\n" + date + "\r\n"))
-	hash := mac.Sum(nil)
-	encodedHash := base64.StdEncoding.EncodeToString(hash)
 
-	if body != nil {
-		request.Header.Add("Content-Type", "application/json")
+	if request.Body != nil {
+		httpRequest.Header.Add("Content-Type", "application/json")
 	}
-	request.Header.Add("Authorization", fmt.Sprintf("%s:%s", nounce, encodedHash))
-	request.Header.Add("Date", date)
+	httpRequest.Header.Add("Authorization", fmt.Sprintf("%s:%s", nounce, encodedHash))
+	httpRequest.Header.Add("Date", date)
 
-	response, err := client.httpClient.Do(request)
+	httpResponse, err := client.httpClient.Do(httpRequest)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	bodyBytes, err := ioutil.ReadAll(response.Body)
+	bodyBytes, err := ioutil.ReadAll(httpResponse.Body)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer response.Body.Close()
+	defer httpResponse.Body.Close()
 
-	err = json.Unmarshal(bodyBytes, responseStruct)
-	if err != nil {
-		return err
+	response := &VRageRawResponse{
+		StatusCode: httpResponse.StatusCode,
+		Header:     httpResponse.Header,
+		Body:       bodyBytes,
 	}
 
-	return nil
+	// the meta is decoded on its own so middlewares see it for every response
+	meta := &VRageRemoteResponse{}
+	if json.Unmarshal(bodyBytes, meta) == nil {
+		response.Meta = meta.Meta
+	}
+
+	client.throttle(request, response)
+
+	return response, nil
 }
 
 func NewVRageRemoteClient(remoteAddress string, key string) *VRageRemoteClient {
@@ -828,6 +965,7 @@ func NewVRageRemoteClient(remoteAddress string, key string) *VRageRemoteClient {
 		BaseURL:       "/vrageremote/v1",
 		RemoteAddress: remoteAddress,
 		Key:           key,
+		VersionPolicy: VRageVersionWarn,
 		httpClient:    &http.Client{},
 		nonce:         time.Now().UnixNano(),
 	}
@@ -0,0 +1,91 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Command vrage-events serves the live events of a server to dashboards as
+// Server-Sent Events and WebSocket messages
+//
+//	vrage-events -listen :8083 -profile main -users users.json
+//
+// Connect with new EventSource("/events?topics=chat,players&token=...") or a
+// WebSocket to the same url. Without -users everyone may connect.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/uranoxyd/govrageremote.v2"
+	"gopkg.in/uranoxyd/govrageremote.v2/access"
+	"gopkg.in/uranoxyd/govrageremote.v2/config"
+	"gopkg.in/uranoxyd/govrageremote.v2/eventfeed"
+)
+
+func main() {
+	listen := flag.String("listen", ":8083", "address to listen on")
+	connection := config.AddFlags(flag.CommandLine)
+	usersPath := flag.String("users", "", "file listing the users and their tokens, empty allows everyone")
+	interval := flag.Duration("interval", 5*time.Second, "how often the server is polled")
+	replay := flag.Int("replay", 100, "number of recent events replayed to new connections")
+	allowOrigin := flag.String("allow-origin", "", "origin allowed to connect from a browser, * for any")
+	flag.Parse()
+
+	logger := log.New(os.Stdout, "", log.LstdFlags)
+
+	client, profile, err := connection.Client()
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	feed := eventfeed.New()
+	feed.ReplaySize = *replay
+
+	handler := eventfeed.NewHandler(feed)
+	handler.AllowOrigin = *allowOrigin
+	if *usersPath != "" {
+		users, err := access.LoadUsers(*usersPath)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		// EventSource can not send headers, so the token may be passed in the query as well
+		handler.Authorize = func(request *http.Request) bool {
+			token := strings.TrimPrefix(request.Header.Get("Authorization"), "Bearer ")
+			if token == "" {
+				token = request.URL.Query().Get("token")
+			}
+			return users.ByToken(token) != nil
+		}
+	}
+
+	stop := make(chan struct{})
+
+	poller := eventfeed.NewPoller(feed, client)
+	poller.OnError = func(err error) {
+		logger.Println("poll failed:", err)
+	}
+	go poller.Run(*interval, stop)
+
+	watchdog := govrageremote.NewVRageWatchdog(client, govrageremote.DefaultVRageWatchdogConfig(), feed)
+	watchdog.OnError = func(err error) {
+		logger.Println("watchdog failed:", err)
+	}
+	go watchdog.Run(stop)
+
+	http.Handle("/events", handler)
+	logger.Printf("serving events of %s on %s/events", profile.Address, *listen)
+	logger.Fatal(http.ListenAndServe(*listen, nil))
+}
@@ -0,0 +1,142 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Command vrage-export writes the entities of a server as CSV, JSON Lines or a
+// GeoJSON like feature collection
+//
+//	vrage-export -kind grids -format csv -columns DisplayName,OwnerDisplayName,PCU,NearestPlayerDistance -filter "PCU > 1000" > grids.csv
+//
+// Without -columns every field is exported. Besides the fields of the entity the
+// computed columns NearestPlayerDistance and NearestPlayer are available.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"gopkg.in/uranoxyd/govrageremote.v2/config"
+	"gopkg.in/uranoxyd/govrageremote.v2/export"
+	"gopkg.in/uranoxyd/govrageremote.v2/query"
+)
+
+func main() {
+	connection := config.AddFlags(flag.CommandLine)
+	kind := flag.String("kind", "grids", "entities to export: grids, floating, characters or players")
+	formatName := flag.String("format", "csv", "output format: csv, jsonl or geojson")
+	columnSpec := flag.String("columns", "", "comma separated columns, empty for all fields")
+	filterSource := flag.String("filter", "", "only export entities matching this query expression")
+	output := flag.String("output", "", "file to write to, stdout if empty")
+	flag.Parse()
+
+	format, err := export.ParseFormat(*formatName)
+	if err != nil {
+		fail(err)
+	}
+
+	client, _, err := connection.Client()
+	if err != nil {
+		fail(err)
+	}
+
+	var filter *query.Filter
+	if *filterSource != "" {
+		filter, err = query.Compile(*filterSource, query.NewClientResolver(client))
+		if err != nil {
+			fail(err)
+		}
+	}
+
+	// characters stand in for the players when computing distances
+	characters, err := client.GetCharacters()
+	if err != nil {
+		fail(err)
+	}
+	computed := export.PlayerColumns(characters.Data.Characters)
+
+	var entities interface{}
+	switch *kind {
+	case "grids":
+		response, err := client.GetGrids()
+		if err != nil {
+			fail(err)
+		}
+		grids := response.Data.Grids
+		if filter != nil {
+			if grids, err = filter.Grids(grids); err != nil {
+				fail(err)
+			}
+		}
+		entities = grids
+	case "floating":
+		response, err := client.GetFloatingObjects()
+		if err != nil {
+			fail(err)
+		}
+		objects := response.Data.FloatingObjects
+		if filter != nil {
+			if objects, err = filter.FloatingObjects(objects); err != nil {
+				fail(err)
+			}
+		}
+		entities = objects
+	case "characters":
+		list := characters.Data.Characters
+		if filter != nil {
+			if list, err = filter.Characters(list); err != nil {
+				fail(err)
+			}
+		}
+		entities = list
+	case "players":
+		response, err := client.GetPlayers()
+		if err != nil {
+			fail(err)
+		}
+		players := response.Data.Players
+		if filter != nil {
+			if players, err = filter.Players(players); err != nil {
+				fail(err)
+			}
+		}
+		entities = players
+	default:
+		fail(fmt.Errorf("unknown kind %q", *kind))
+	}
+
+	columns, err := export.ParseColumns(*columnSpec, entities, computed)
+	if err != nil {
+		fail(err)
+	}
+
+	var writer io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			fail(err)
+		}
+		defer file.Close()
+		writer = file
+	}
+
+	if err := export.Write(writer, format, columns, entities); err != nil {
+		fail(err)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "error:", err)
+	os.Exit(1)
+}
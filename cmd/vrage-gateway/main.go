@@ -0,0 +1,62 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Command vrage-gateway serves the Remote API as a plain JSON REST API with
+// bearer tokens, see package gateway for the format.
+//
+//	vrage-gateway -listen :8082 -profile main -users users.json
+//
+// users.json lists the users, their roles and tokens:
+//
+//	[{"Name": "panel", "Role": "moderator", "Token": "f0c5f9e2a1d84e7b"}]
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"os"
+
+	"gopkg.in/uranoxyd/govrageremote.v2/access"
+	"gopkg.in/uranoxyd/govrageremote.v2/config"
+	"gopkg.in/uranoxyd/govrageremote.v2/gateway"
+)
+
+func main() {
+	listen := flag.String("listen", ":8082", "address to listen on")
+	connection := config.AddFlags(flag.CommandLine)
+	usersPath := flag.String("users", "users.json", "file listing the users, their roles and tokens")
+	prefix := flag.String("prefix", "/api", "path the api is served under")
+	allowOrigin := flag.String("allow-origin", "", "origin allowed to call the api from a browser, * for any")
+	flag.Parse()
+
+	logger := log.New(os.Stdout, "", log.LstdFlags)
+
+	client, profile, err := connection.Client()
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	users, err := access.LoadUsers(*usersPath)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	api := gateway.New(client, users, *prefix)
+	api.AllowOrigin = *allowOrigin
+	api.Logger = logger
+
+	logger.Printf("serving %s on %s%s", profile.Address, *listen, *prefix)
+	logger.Fatal(http.ListenAndServe(*listen, api))
+}
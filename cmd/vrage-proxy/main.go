@@ -0,0 +1,85 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Command vrage-proxy lets moderators use the Remote API without knowing its key.
+// Every user signs requests with their own key exactly like the Remote API
+// expects, so any Remote API client works against the proxy. The proxy checks the
+// signature and the role of the user, signs the request again with the real key
+// and logs every call.
+//
+//	vrage-proxy -listen :8081 -profile main -users users.json
+//
+// users.json lists the users and their roles:
+//
+//	[
+//	  {"Name": "alice", "Role": "moderator", "Key": "bW9kZXJhdG9yLWtleQ=="},
+//	  {"Name": "bob", "Role": "read-only", "Key": "cmVhZC1vbmx5LWtleQ=="}
+//	]
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"gopkg.in/uranoxyd/govrageremote.v2/access"
+	"gopkg.in/uranoxyd/govrageremote.v2/config"
+)
+
+func main() {
+	listen := flag.String("listen", ":8081", "address to listen on")
+	connection := config.AddFlags(flag.CommandLine)
+	usersPath := flag.String("users", "users.json", "file listing the users and their roles")
+	maxSkew := flag.Duration("max-skew", 5*time.Minute, "how far the Date header of a request may be off")
+	flag.Parse()
+
+	logger := log.New(os.Stdout, "", log.LstdFlags)
+
+	profile, err := connection.Resolve()
+	if err != nil {
+		logger.Fatal(err)
+	}
+	key, err := profile.ReadKey()
+	if err != nil {
+		logger.Fatal(err)
+	}
+	if key == "" {
+		logger.Fatal("no remote api key, set one in the profile or use -key or -key-file")
+	}
+	baseURL := profile.BaseURL
+	if baseURL == "" {
+		baseURL = "/vrageremote/v1"
+	}
+
+	users, err := access.LoadUsers(*usersPath)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	proxy := newProxy(profile.Address, baseURL, key, users, logger)
+	proxy.maxSkew = *maxSkew
+
+	logger.Printf("proxying %s%s on %s for %d users", profile.Address, baseURL, *listen, len(users))
+	server := &http.Server{
+		Addr:              *listen,
+		Handler:           proxy,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      90 * time.Second, // longer than the 60s the server may take to answer
+		IdleTimeout:       2 * time.Minute,
+	}
+	logger.Fatal(server.ListenAndServe())
+}
@@ -0,0 +1,235 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/uranoxyd/govrageremote.v2"
+	"gopkg.in/uranoxyd/govrageremote.v2/access"
+)
+
+// the largest request body passed on, the Remote API only takes short chat messages
+const maxBodySize = 1 << 20
+
+// maxNonces bounds the nonces remembered within 2*maxSkew, requests beyond it
+// are refused until old ones expire, forgetting a nonce early would allow a replay
+const maxNonces = 100000
+
+var errTooManyNonces = errors.New("too many requests, try again later")
+
+type proxy struct {
+	remoteAddress string
+	baseURL       string
+	key           string
+	users         access.Users
+	maxSkew       time.Duration
+	httpClient    *http.Client
+	logger        *log.Logger
+
+	seen      map[string]time.Time // nonces already used per user, kept for maxSkew
+	nonce     int64
+	seenMutex sync.Mutex
+}
+
+func (proxy *proxy) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	start := time.Now()
+
+	user, err := proxy.authenticate(request)
+	if err != nil {
+		proxy.logger.Printf("denied %s %s from %s: %s", request.Method, request.RequestURI, request.RemoteAddr, err)
+		status := http.StatusUnauthorized
+		if err == errTooManyNonces {
+			status = http.StatusTooManyRequests
+		}
+		writeError(writer, status, err.Error())
+		return
+	}
+
+	// the path the server sees has to be the one the rules are checked for, so
+	// anything it could decode or resolve differently is refused
+	rawPath := request.RequestURI
+	if i := strings.IndexByte(rawPath, '?'); i >= 0 {
+		rawPath = rawPath[:i]
+	}
+	if rawPath != request.URL.Path {
+		writeError(writer, http.StatusBadRequest, "escaped or non canonical path")
+		return
+	}
+	resource := strings.TrimPrefix(request.URL.Path, proxy.baseURL+"/")
+	if resource == request.URL.Path {
+		writeError(writer, http.StatusNotFound, "not found")
+		return
+	}
+	if err := access.CheckResource(resource); err != nil {
+		writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rule := access.Lookup(request.Method, resource)
+	if !user.Role.Includes(rule.Role) {
+		proxy.logger.Printf("denied %s (%s) %s: %s %s requires %s", user.Name, user.Role, rule.Action, request.Method, request.RequestURI, rule.Role)
+		writeError(writer, http.StatusForbidden, fmt.Sprintf("%s requires the %s role", rule.Action, rule.Role))
+		return
+	}
+
+	status, err := proxy.forward(writer, request, resource)
+	if err != nil {
+		proxy.logger.Printf("failed %s (%s) %s %s: %s", user.Name, user.Role, request.Method, request.RequestURI, err)
+		writeError(writer, http.StatusBadGateway, err.Error())
+		return
+	}
+	proxy.logger.Printf("%s (%s) %s: %s %s -> %d in %s", user.Name, user.Role, rule.Action, request.Method, request.RequestURI, status, time.Since(start).Round(time.Millisecond))
+}
+
+// authenticate finds the user whose key signed the request
+func (proxy *proxy) authenticate(request *http.Request) (*access.User, error) {
+	authorization := request.Header.Get("Authorization")
+	separator := strings.IndexByte(authorization, ':')
+	if separator < 0 {
+		return nil, fmt.Errorf("missing or malformed authorization header")
+	}
+	nonce, signature := authorization[:separator], authorization[separator+1:]
+
+	dateHeader := request.Header.Get("Date")
+	date, err := time.Parse(time.RFC1123Z, dateHeader)
+	if err != nil {
+		return nil, fmt.Errorf("missing or malformed date header")
+	}
+	if skew := time.Since(date); skew > proxy.maxSkew || skew < -proxy.maxSkew {
+		return nil, fmt.Errorf("date header is off by %s", skew.Round(time.Second))
+	}
+
+	for _, user := range proxy.users {
+		if user.Key == "" {
+			continue
+		}
+		if govrageremote.VerifyVRageRequest(user.Key, request.RequestURI, nonce, dateHeader, signature) {
+			if err := proxy.useNonce(user.Name + ":" + nonce); err != nil {
+				return nil, err
+			}
+			return user, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid signature")
+}
+
+// useNonce records a nonce and fails if it was used before, so captured
+// requests can not be sent again
+func (proxy *proxy) useNonce(key string) error {
+	proxy.seenMutex.Lock()
+	defer proxy.seenMutex.Unlock()
+
+	now := time.Now()
+	for seenKey, seenTime := range proxy.seen {
+		if now.Sub(seenTime) > 2*proxy.maxSkew {
+			delete(proxy.seen, seenKey)
+		}
+	}
+
+	if _, ok := proxy.seen[key]; ok {
+		return fmt.Errorf("nonce %s was already used", key)
+	}
+	if len(proxy.seen) >= maxNonces {
+		return errTooManyNonces
+	}
+	proxy.seen[key] = now
+	return nil
+}
+
+// forward signs the authorized resource with the real key, sends it to the
+// server and copies the response back
+func (proxy *proxy) forward(writer http.ResponseWriter, request *http.Request, resource string) (int, error) {
+	body, err := ioutil.ReadAll(io.LimitReader(request.Body, maxBodySize))
+	if err != nil {
+		return 0, err
+	}
+
+	methodURL := proxy.baseURL + "/" + resource
+	if request.URL.RawQuery != "" {
+		methodURL += "?" + request.URL.RawQuery
+	}
+	upstream, err := http.NewRequestWithContext(request.Context(), request.Method, proxy.remoteAddress+methodURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	if contentType := request.Header.Get("Content-Type"); contentType != "" {
+		upstream.Header.Set("Content-Type", contentType)
+	}
+
+	date := time.Now().UTC().Format(time.RFC1123Z)
+	proxy.seenMutex.Lock()
+	nonce := fmt.Sprint(proxy.nonce)
+	proxy.nonce++
+	proxy.seenMutex.Unlock()
+
+	signature, err := govrageremote.SignVRageRequest(proxy.key, methodURL, nonce, date)
+	if err != nil {
+		return 0, err
+	}
+	upstream.Header.Set("Authorization", nonce+":"+signature)
+	upstream.Header.Set("Date", date)
+
+	response, err := proxy.httpClient.Do(upstream)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	for _, name := range []string{"Content-Type", "Content-Length"} {
+		if value := response.Header.Get(name); value != "" {
+			writer.Header().Set(name, value)
+		}
+	}
+	writer.WriteHeader(response.StatusCode)
+	_, err = io.Copy(writer, response.Body)
+	if err != nil {
+		proxy.logger.Printf("could not copy response: %s", err)
+	}
+	return response.StatusCode, nil
+}
+
+// writeError answers in the format of the Remote API so clients report the message
+func writeError(writer http.ResponseWriter, status int, message string) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	json.NewEncoder(writer).Encode(&govrageremote.VRageRemoteResponse{
+		Error: &govrageremote.VRageRemoteResponseError{Message: message},
+	})
+}
+
+func newProxy(remoteAddress string, baseURL string, key string, users access.Users, logger *log.Logger) *proxy {
+	return &proxy{
+		remoteAddress: strings.TrimRight(remoteAddress, "/"),
+		baseURL:       strings.TrimRight(baseURL, "/"),
+		key:           key,
+		users:         users,
+		maxSkew:       5 * time.Minute,
+		httpClient:    &http.Client{Timeout: 60 * time.Second},
+		logger:        logger,
+		seen:          make(map[string]time.Time),
+		nonce:         time.Now().UnixNano(),
+	}
+}
@@ -0,0 +1,224 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/uranoxyd/govrageremote.v2"
+	"gopkg.in/uranoxyd/govrageremote.v2/access"
+)
+
+const (
+	serverKey    = "c2VydmVyLWtleQ=="
+	moderatorKey = "bW9kZXJhdG9yLWtleQ=="
+	readOnlyKey  = "cmVhZC1vbmx5LWtleQ=="
+)
+
+// newTestProxy returns a proxy in front of a server checking the signature made
+// with the real key, the server records the requests it got
+func newTestProxy(t *testing.T) (*proxy, func() []string) {
+	var mutex sync.Mutex
+	var forwarded []string
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		authorization := strings.SplitN(request.Header.Get("Authorization"), ":", 2)
+		if len(authorization) != 2 || !govrageremote.VerifyVRageRequest(serverKey, request.RequestURI, authorization[0], request.Header.Get("Date"), authorization[1]) {
+			t.Errorf("server got a badly signed request for %s", request.RequestURI)
+		}
+		body, _ := ioutil.ReadAll(request.Body)
+		mutex.Lock()
+		forwarded = append(forwarded, strings.TrimSpace(request.Method+" "+request.RequestURI+" "+string(body)))
+		mutex.Unlock()
+		writer.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(writer, `{"meta":{"apiVersion":"1.0","queryTime":1}}`)
+	}))
+	t.Cleanup(server.Close)
+
+	users := access.Users{
+		{Name: "alice", Role: access.RoleModerator, Key: moderatorKey},
+		{Name: "bob", Role: access.RoleReadOnly, Key: readOnlyKey},
+	}
+	proxy := newProxy(server.URL, "/vrageremote/v1", serverKey, users, log.New(ioutil.Discard, "", 0))
+	return proxy, func() []string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return append([]string(nil), forwarded...)
+	}
+}
+
+// signedRequest builds a request to target signed with key like the client does
+func signedRequest(t *testing.T, method string, target string, key string, nonce string, date time.Time) *http.Request {
+	request := httptest.NewRequest(method, target, strings.NewReader(""))
+	dateHeader := date.UTC().Format(time.RFC1123Z)
+	signature, err := govrageremote.SignVRageRequest(key, target, nonce, dateHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("Authorization", nonce+":"+signature)
+	request.Header.Set("Date", dateHeader)
+	return request
+}
+
+func serve(proxy *proxy, request *http.Request) int {
+	recorder := httptest.NewRecorder()
+	proxy.ServeHTTP(recorder, request)
+	return recorder.Code
+}
+
+func TestProxyAuthentication(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		request func() *http.Request
+		status  int
+	}{
+		{"valid", func() *http.Request {
+			return signedRequest(t, "GET", "/vrageremote/v1/server", readOnlyKey, "1", now)
+		}, http.StatusOK},
+		{"unknown key", func() *http.Request {
+			return signedRequest(t, "GET", "/vrageremote/v1/server", "b3RoZXI=", "1", now)
+		}, http.StatusUnauthorized},
+		{"server key is not a user key", func() *http.Request {
+			return signedRequest(t, "GET", "/vrageremote/v1/server", serverKey, "1", now)
+		}, http.StatusUnauthorized},
+		{"signature for another path", func() *http.Request {
+			request := signedRequest(t, "GET", "/vrageremote/v1/server", readOnlyKey, "1", now)
+			other := httptest.NewRequest("GET", "/vrageremote/v1/session/players", nil)
+			other.Header = request.Header
+			return other
+		}, http.StatusUnauthorized},
+		{"missing authorization", func() *http.Request {
+			request := signedRequest(t, "GET", "/vrageremote/v1/server", readOnlyKey, "1", now)
+			request.Header.Del("Authorization")
+			return request
+		}, http.StatusUnauthorized},
+		{"malformed date", func() *http.Request {
+			request := signedRequest(t, "GET", "/vrageremote/v1/server", readOnlyKey, "1", now)
+			request.Header.Set("Date", "yesterday")
+			return request
+		}, http.StatusUnauthorized},
+		{"old date", func() *http.Request {
+			return signedRequest(t, "GET", "/vrageremote/v1/server", readOnlyKey, "1", now.Add(-time.Hour))
+		}, http.StatusUnauthorized},
+		{"future date", func() *http.Request {
+			return signedRequest(t, "GET", "/vrageremote/v1/server", readOnlyKey, "1", now.Add(time.Hour))
+		}, http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			proxy, _ := newTestProxy(t)
+			if status := serve(proxy, test.request()); status != test.status {
+				t.Errorf("status = %d, want %d", status, test.status)
+			}
+		})
+	}
+}
+
+func TestProxyNonceReplay(t *testing.T) {
+	proxy, forwarded := newTestProxy(t)
+	now := time.Now()
+
+	if status := serve(proxy, signedRequest(t, "GET", "/vrageremote/v1/server", readOnlyKey, "42", now)); status != http.StatusOK {
+		t.Fatalf("first request: status %d", status)
+	}
+	if status := serve(proxy, signedRequest(t, "GET", "/vrageremote/v1/server", readOnlyKey, "42", now)); status != http.StatusUnauthorized {
+		t.Errorf("replayed request: status %d, want 401", status)
+	}
+	// nonces are per user
+	if status := serve(proxy, signedRequest(t, "GET", "/vrageremote/v1/server", moderatorKey, "42", now)); status != http.StatusOK {
+		t.Errorf("same nonce of another user: status %d", status)
+	}
+	if got := len(forwarded()); got != 2 {
+		t.Errorf("server got %d requests, want 2", got)
+	}
+}
+
+func TestProxyNonceLimit(t *testing.T) {
+	proxy, _ := newTestProxy(t)
+	for i := 0; i < maxNonces; i++ {
+		proxy.seen[fmt.Sprint("filler:", i)] = time.Now()
+	}
+	if status := serve(proxy, signedRequest(t, "GET", "/vrageremote/v1/server", readOnlyKey, "1", time.Now())); status != http.StatusTooManyRequests {
+		t.Errorf("status = %d, want 429", status)
+	}
+
+	// expired nonces make room again
+	for key := range proxy.seen {
+		proxy.seen[key] = time.Now().Add(-3 * proxy.maxSkew)
+	}
+	if status := serve(proxy, signedRequest(t, "GET", "/vrageremote/v1/server", readOnlyKey, "1", time.Now())); status != http.StatusOK {
+		t.Errorf("status = %d after expiry, want 200", status)
+	}
+	if len(proxy.seen) != 1 {
+		t.Errorf("%d nonces kept, want 1", len(proxy.seen))
+	}
+}
+
+func TestProxyPaths(t *testing.T) {
+	tests := []struct {
+		method    string
+		target    string
+		key       string
+		status    int
+		forwarded string
+	}{
+		{"GET", "/vrageremote/v1/session/grids", readOnlyKey, http.StatusOK, "GET /vrageremote/v1/session/grids"},
+		{"GET", "/vrageremote/v1/session/grids?x=1", readOnlyKey, http.StatusOK, "GET /vrageremote/v1/session/grids?x=1"},
+		{"PATCH", "/vrageremote/v1/session/grids/5", moderatorKey, http.StatusOK, "PATCH /vrageremote/v1/session/grids/5"},
+		{"POST", "/vrageremote/v1/admin/kickedPlayers/76561198000000001", moderatorKey, http.StatusOK, "POST /vrageremote/v1/admin/kickedPlayers/76561198000000001"},
+
+		// roles
+		{"PATCH", "/vrageremote/v1/session/grids/5", readOnlyKey, http.StatusForbidden, ""},
+		{"DELETE", "/vrageremote/v1/session/grids/5", moderatorKey, http.StatusForbidden, ""},
+		{"POST", "/vrageremote/v1/admin/bannedPlayers/1", moderatorKey, http.StatusForbidden, ""},
+		{"DELETE", "/vrageremote/v1/server", moderatorKey, http.StatusForbidden, ""},
+		{"GET", "/vrageremote/v1/session/secret", readOnlyKey, http.StatusForbidden, ""},
+
+		// * only matches ids, so this is not "stop grid"
+		{"PATCH", "/vrageremote/v1/session/grids/abc", moderatorKey, http.StatusForbidden, ""},
+
+		// the raw path has to be the one the rules were checked for
+		{"PATCH", "/vrageremote/v1/session/grids/%35", moderatorKey, http.StatusBadRequest, ""},
+		{"PATCH", "/vrageremote/v1/session/grids/1%2f..%2f..%2fserver", moderatorKey, http.StatusBadRequest, ""},
+		{"PATCH", "/vrageremote/v1/session/grids/5/..", moderatorKey, http.StatusBadRequest, ""},
+		{"PATCH", "/vrageremote/v1/session/grids/5/%2e%2e", moderatorKey, http.StatusBadRequest, ""},
+		{"PATCH", "/vrageremote/v1/session//grids/5", moderatorKey, http.StatusBadRequest, ""},
+		{"GET", "/vrageremote/v1/../v1/server", readOnlyKey, http.StatusBadRequest, ""},
+		{"GET", "/other/server", readOnlyKey, http.StatusNotFound, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.method+" "+test.target, func(t *testing.T) {
+			proxy, forwarded := newTestProxy(t)
+			request := signedRequest(t, test.method, test.target, test.key, "1", time.Now())
+			if status := serve(proxy, request); status != test.status {
+				t.Errorf("status = %d, want %d", status, test.status)
+			}
+			got := strings.Join(forwarded(), "\n")
+			if got != test.forwarded {
+				t.Errorf("forwarded %q, want %q", got, test.forwarded)
+			}
+		})
+	}
+}
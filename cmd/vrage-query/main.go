@@ -0,0 +1,106 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Command vrage-query prints the entities of a server which match a filter expression
+//
+//	vrage-query -kind grids "PCU > 5000 && !IsPowered && OwnerDisplayName == ''"
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"gopkg.in/uranoxyd/govrageremote.v2/config"
+	"gopkg.in/uranoxyd/govrageremote.v2/query"
+)
+
+func main() {
+	connection := config.AddFlags(flag.CommandLine)
+	kind := flag.String("kind", "grids", "entities to query: grids, floating, characters or players")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] <filter>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	source := "true"
+	if flag.NArg() > 0 {
+		source = flag.Arg(0)
+	}
+
+	client, _, err := connection.Client()
+	if err != nil {
+		fail(err)
+	}
+
+	filter, err := query.Compile(source, query.NewClientResolver(client))
+	if err != nil {
+		fail(err)
+	}
+
+	var matches interface{}
+	switch *kind {
+	case "grids":
+		response, err := client.GetGrids()
+		if err != nil {
+			fail(err)
+		}
+		matches, err = filter.Grids(response.Data.Grids)
+		if err != nil {
+			fail(err)
+		}
+	case "floating":
+		response, err := client.GetFloatingObjects()
+		if err != nil {
+			fail(err)
+		}
+		matches, err = filter.FloatingObjects(response.Data.FloatingObjects)
+		if err != nil {
+			fail(err)
+		}
+	case "characters":
+		response, err := client.GetCharacters()
+		if err != nil {
+			fail(err)
+		}
+		matches, err = filter.Characters(response.Data.Characters)
+		if err != nil {
+			fail(err)
+		}
+	case "players":
+		response, err := client.GetPlayers()
+		if err != nil {
+			fail(err)
+		}
+		matches, err = filter.Players(response.Data.Players)
+		if err != nil {
+			fail(err)
+		}
+	default:
+		fail(fmt.Errorf("unknown kind %q", *kind))
+	}
+
+	data, err := json.MarshalIndent(matches, "", "  ")
+	if err != nil {
+		fail(err)
+	}
+	fmt.Println(string(data))
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "error:", err)
+	os.Exit(1)
+}
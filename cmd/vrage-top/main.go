@@ -0,0 +1,233 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Command vrage-top shows the live state of a server in the terminal: server
+// health, online players, the largest grids and the recent chat.
+//
+//	vrage-top -profile main
+//
+// Tab switches between the player and grid lists, the arrow keys select an
+// entry. K kicks and B bans the selected player, S stops and D deletes the
+// selected grid, O toggles sorting grids by PCU or mass, R refreshes and Q quits.
+// Kicks, bans and deletes ask for confirmation.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/uranoxyd/govrageremote.v2"
+	"gopkg.in/uranoxyd/govrageremote.v2/config"
+)
+
+type snapshot struct {
+	info    *govrageremote.VRageRemoteServerInfo
+	latency time.Duration
+	players []*govrageremote.VRageRemotePlayer
+	grids   []*govrageremote.VRageRemoteGrid
+	chat    []*govrageremote.VRageChatMessage
+	err     error
+	time    time.Time
+}
+
+// fetch collects everything shown on screen, the first error is kept but the
+// remaining calls are still made
+func fetch(client *govrageremote.VRageRemoteClient) *snapshot {
+	snap := &snapshot{time: time.Now()}
+	keep := func(err error) {
+		if err != nil && snap.err == nil {
+			snap.err = err
+		}
+	}
+
+	latency, err := client.Ping()
+	keep(err)
+	snap.latency = latency
+
+	if response, err := client.GetServerInfo(); err == nil {
+		snap.info = response.Data
+	} else {
+		keep(err)
+	}
+	if response, err := client.GetPlayers(); err == nil && response.Data != nil {
+		snap.players = response.Data.Players
+	} else {
+		keep(err)
+	}
+	if response, err := client.GetGrids(); err == nil && response.Data != nil {
+		snap.grids = response.Data.Grids
+	} else {
+		keep(err)
+	}
+	if response, err := client.GetChat(); err == nil && response.Data != nil {
+		snap.chat = response.Data.Messages
+	} else {
+		keep(err)
+	}
+
+	sort.Slice(snap.players, func(i, j int) bool {
+		return strings.ToLower(snap.players[i].DisplayName) < strings.ToLower(snap.players[j].DisplayName)
+	})
+	return snap
+}
+
+// pendingAction waits for the user to confirm
+type pendingAction struct {
+	prompt string
+	run    func() error
+}
+
+type actionResult struct {
+	message string
+	err     error
+}
+
+func main() {
+	connection := config.AddFlags(flag.CommandLine)
+	interval := flag.Duration("interval", 2*time.Second, "refresh interval")
+	flag.Parse()
+
+	client, _, err := connection.Client()
+	if err != nil {
+		fail(err)
+	}
+
+	term, err := openTerminal()
+	if err != nil {
+		fail(err)
+	}
+	defer term.restore()
+
+	keys := make(chan string)
+	go readKeys(keys)
+
+	resized := make(chan os.Signal, 1)
+	notifyResize(resized)
+
+	snapshots := make(chan *snapshot, 1)
+	results := make(chan actionResult, 1)
+	refresh := func() {
+		go func() { snapshots <- fetch(client) }()
+	}
+
+	view := &view{}
+	var pending *pendingAction
+
+	// act runs an action in the background and refreshes once it is done
+	act := func(message string, run func() error) {
+		view.status = message + "..."
+		go func() {
+			results <- actionResult{message: message, err: run()}
+		}()
+	}
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	refresh()
+
+	for {
+		rows, cols := term.size()
+		fmt.Print(view.render(rows, cols, pending))
+
+		select {
+		case snap := <-snapshots:
+			view.update(snap)
+
+		case <-resized:
+			term.updateSize()
+
+		case <-ticker.C:
+			refresh()
+
+		case result := <-results:
+			if result.err != nil {
+				view.status = result.message + " failed: " + result.err.Error()
+			} else {
+				view.status = result.message + " done"
+			}
+			refresh()
+
+		case key, ok := <-keys:
+			if !ok {
+				return
+			}
+
+			if pending != nil {
+				if key == "y" || key == "Y" {
+					action := pending
+					act(action.prompt, action.run)
+				} else {
+					view.status = "cancelled"
+				}
+				pending = nil
+				continue
+			}
+
+			switch key {
+			case "q", "Q", "ctrl-c":
+				return
+			case "tab":
+				view.gridsFocused = !view.gridsFocused
+			case "up", "k":
+				view.move(-1)
+			case "down", "j":
+				view.move(1)
+			case "pgup":
+				view.move(-10)
+			case "pgdown":
+				view.move(10)
+			case "o", "O":
+				view.sortByMass = !view.sortByMass
+				view.sortGrids()
+			case "r", "R":
+				refresh()
+
+			case "K":
+				if player := view.selectedPlayer(); player != nil {
+					pending = &pendingAction{
+						prompt: "kick " + player.DisplayName,
+						run:    func() error { return client.KickPlayer(player.SteamID) },
+					}
+				}
+			case "B":
+				if player := view.selectedPlayer(); player != nil {
+					pending = &pendingAction{
+						prompt: "ban " + player.DisplayName,
+						run:    func() error { return client.BanPlayer(player.SteamID) },
+					}
+				}
+			case "S":
+				if grid := view.selectedGrid(); grid != nil {
+					act("stop "+grid.DisplayName, func() error { return client.StopGrid(grid.EntityID) })
+				}
+			case "D":
+				if grid := view.selectedGrid(); grid != nil {
+					pending = &pendingAction{
+						prompt: "delete " + grid.DisplayName,
+						run:    func() error { return client.DeleteGrid(grid.EntityID) },
+					}
+				}
+			}
+		}
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "error:", err)
+	os.Exit(1)
+}
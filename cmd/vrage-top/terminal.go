@@ -0,0 +1,108 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// the terminal is switched to raw mode with stty so no terminal library is needed
+
+type terminal struct {
+	saved string
+	rows  int
+	cols  int
+}
+
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+func openTerminal() (*terminal, error) {
+	saved, err := stty("-g")
+	if err != nil {
+		return nil, fmt.Errorf("stdin is not a terminal: %v", err)
+	}
+	if _, err := stty("raw", "-echo"); err != nil {
+		return nil, err
+	}
+	// alternate screen, hidden cursor
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	term := &terminal{saved: saved}
+	term.updateSize()
+	return term, nil
+}
+
+func (term *terminal) restore() {
+	fmt.Print("\x1b[?25h\x1b[?1049l")
+	stty(term.saved)
+}
+
+// size returns the rows and columns of the terminal
+func (term *terminal) size() (int, int) {
+	return term.rows, term.cols
+}
+
+// updateSize asks stty for the size, it is called once and on every SIGWINCH.
+// 24x80 is assumed if the size is unknown.
+func (term *terminal) updateSize() {
+	term.rows, term.cols = 24, 80
+	out, err := stty("size")
+	if err != nil {
+		return
+	}
+	var rows, cols int
+	if _, err := fmt.Sscan(out, &rows, &cols); err != nil || rows <= 0 || cols <= 0 {
+		return
+	}
+	term.rows, term.cols = rows, cols
+}
+
+// readKeys sends the keys typed on stdin, arrow keys are reported as "up" and "down"
+func readKeys(keys chan<- string) {
+	buffer := make([]byte, 16)
+	for {
+		n, err := os.Stdin.Read(buffer)
+		if err != nil {
+			close(keys)
+			return
+		}
+		input := string(buffer[:n])
+		switch input {
+		case "\x1b[A", "\x1bOA":
+			keys <- "up"
+		case "\x1b[B", "\x1bOB":
+			keys <- "down"
+		case "\x1b[5~":
+			keys <- "pgup"
+		case "\x1b[6~":
+			keys <- "pgdown"
+		case "\t":
+			keys <- "tab"
+		case "\x03":
+			keys <- "ctrl-c"
+		default:
+			for _, r := range input {
+				keys <- string(r)
+			}
+		}
+	}
+}
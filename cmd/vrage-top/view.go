@@ -0,0 +1,257 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gopkg.in/uranoxyd/govrageremote.v2"
+)
+
+const (
+	reverse = "\x1b[7m"
+	bold    = "\x1b[1m"
+	red     = "\x1b[31m"
+	reset   = "\x1b[0m"
+)
+
+type view struct {
+	snap         *snapshot
+	gridsFocused bool
+	sortByMass   bool
+	playerIndex  int
+	gridIndex    int
+	status       string
+}
+
+func (view *view) update(snap *snapshot) {
+	// keep the selection on the same entity across refreshes
+	selectedPlayer := view.selectedPlayer()
+	selectedGrid := view.selectedGrid()
+
+	view.snap = snap
+	view.sortGrids()
+
+	if selectedPlayer != nil {
+		for i, player := range snap.players {
+			if player.SteamID == selectedPlayer.SteamID {
+				view.playerIndex = i
+			}
+		}
+	}
+	if selectedGrid != nil {
+		for i, grid := range snap.grids {
+			if grid.EntityID == selectedGrid.EntityID {
+				view.gridIndex = i
+			}
+		}
+	}
+	view.move(0)
+}
+
+func (view *view) sortGrids() {
+	if view.snap == nil {
+		return
+	}
+	grids := view.snap.grids
+	sort.SliceStable(grids, func(i, j int) bool {
+		if view.sortByMass {
+			return grids[i].Mass > grids[j].Mass
+		}
+		return grids[i].PCU > grids[j].PCU
+	})
+}
+
+func (view *view) move(delta int) {
+	if view.snap == nil {
+		return
+	}
+	if view.gridsFocused {
+		view.gridIndex = clamp(view.gridIndex+delta, len(view.snap.grids))
+	} else {
+		view.playerIndex = clamp(view.playerIndex+delta, len(view.snap.players))
+	}
+}
+
+func clamp(index int, length int) int {
+	if index >= length {
+		index = length - 1
+	}
+	if index < 0 {
+		index = 0
+	}
+	return index
+}
+
+func (view *view) selectedPlayer() *govrageremote.VRageRemotePlayer {
+	if view.snap == nil || view.gridsFocused || view.playerIndex >= len(view.snap.players) {
+		return nil
+	}
+	return view.snap.players[view.playerIndex]
+}
+
+func (view *view) selectedGrid() *govrageremote.VRageRemoteGrid {
+	if view.snap == nil || !view.gridsFocused || view.gridIndex >= len(view.snap.grids) {
+		return nil
+	}
+	return view.snap.grids[view.gridIndex]
+}
+
+// render draws the whole screen, lines are separated by \r\n because the
+// terminal is in raw mode
+func (view *view) render(rows int, cols int, pending *pendingAction) string {
+	var lines []string
+	add := func(style string, text string) {
+		line := fit(text, cols)
+		if style != "" {
+			line = style + line + reset
+		}
+		lines = append(lines, line)
+	}
+
+	snap := view.snap
+	if snap == nil {
+		add(bold, "connecting...")
+		return "\x1b[H" + strings.Join(lines, "\r\n") + "\x1b[J"
+	}
+
+	// header
+	if info := snap.info; info != nil {
+		add(bold, fmt.Sprintf("%s  %s  %s  ready: %t", info.ServerName, info.WorldName, info.Version, info.IsReady))
+		add("", fmt.Sprintf("SimSpeed %.2f   CPU %.1f%%   PCU %d (pirates %d)   players %d   ping %s",
+			info.SimSpeed, info.SimulationCPULoad, info.UsedPCU, info.PirateUsedPCU, info.Players, snap.latency.Round(time.Millisecond)))
+	} else {
+		add(bold, "no server info")
+		add("", "")
+	}
+	if snap.err != nil {
+		add(red, "error: "+snap.err.Error())
+	} else {
+		add("", "updated "+snap.time.Format("15:04:05"))
+	}
+
+	// the lists share the space left by header and footer
+	space := rows - len(lines) - 2
+	playerRows := space / 3
+	chatRows := space / 4
+	gridRows := space - playerRows - chatRows
+
+	add(panelStyle(!view.gridsFocused), fmt.Sprintf("%-24s %-8s %8s  %s", fmt.Sprintf("PLAYERS (%d)", len(snap.players)), "FACTION", "PING", "STEAM ID"))
+	players := make([]string, len(snap.players))
+	for i, player := range snap.players {
+		players[i] = fmt.Sprintf("%-24s %-8s %8.0f  %s", cut(player.DisplayName, 24), cut(player.FactionTag, 8), player.Ping, player.SteamID)
+	}
+	lines = append(lines, list(players, view.playerIndex, !view.gridsFocused, playerRows-1, cols)...)
+
+	order := "PCU"
+	if view.sortByMass {
+		order = "mass"
+	}
+	add(panelStyle(view.gridsFocused), fmt.Sprintf("%-32s %8s %12s %7s %-7s  %s", fmt.Sprintf("GRIDS (%d) by %s", len(snap.grids), order), "PCU", "MASS", "BLOCKS", "POWER", "OWNER"))
+	grids := make([]string, len(snap.grids))
+	for i, grid := range snap.grids {
+		power := "off"
+		if grid.IsPowered {
+			power = "on"
+		}
+		grids[i] = fmt.Sprintf("%-32s %8d %12.0f %7d %-7s  %s", cut(grid.DisplayName, 32), grid.PCU, grid.Mass, grid.BlocksCount, power, grid.OwnerDisplayName)
+	}
+	lines = append(lines, list(grids, view.gridIndex, view.gridsFocused, gridRows-1, cols)...)
+
+	add(bold, "CHAT")
+	chat := snap.chat
+	if len(chat) > chatRows-1 && chatRows > 1 {
+		chat = chat[len(chat)-(chatRows-1):]
+	}
+	for i := 0; i < chatRows-1; i++ {
+		if i < len(chat) {
+			message := chat[i]
+			add("", fmt.Sprintf("%s %s: %s", message.Timestamp.Time().Local().Format("15:04"), message.DisplayName, message.Content))
+		} else {
+			add("", "")
+		}
+	}
+
+	// footer
+	if pending != nil {
+		add(reverse, pending.prompt+"? (y/n)")
+	} else {
+		add("", view.status)
+	}
+	add(reverse, "Tab switch  ↑↓ select  K kick  B ban  S stop  D delete  O sort  R refresh  Q quit")
+
+	return "\x1b[H" + strings.Join(lines, "\r\n") + "\x1b[J"
+}
+
+func panelStyle(focused bool) string {
+	if focused {
+		return reverse + bold
+	}
+	return bold
+}
+
+// list renders height entries scrolled so that the selected one is visible
+func list(entries []string, selected int, focused bool, height int, cols int) []string {
+	if height <= 0 {
+		return nil
+	}
+	offset := 0
+	if selected >= height {
+		offset = selected - height + 1
+	}
+
+	lines := make([]string, height)
+	for i := range lines {
+		index := offset + i
+		if index >= len(entries) {
+			lines[i] = fit("", cols)
+			continue
+		}
+		line := fit(entries[index], cols)
+		if focused && index == selected {
+			line = reverse + line + reset
+		}
+		lines[i] = line
+	}
+	return lines
+}
+
+// fit pads or cuts text to exactly cols characters
+func fit(text string, cols int) string {
+	// control characters, C1 ones like CSI (0x9b) included, would be run by the terminal
+	text = strings.Map(func(r rune) rune {
+		if r < ' ' || (r >= 0x7f && r <= 0x9f) {
+			return ' '
+		}
+		return r
+	}, text)
+	length := utf8.RuneCountInString(text)
+	if length > cols {
+		return cut(text, cols)
+	}
+	return text + strings.Repeat(" ", cols-length)
+}
+
+func cut(text string, length int) string {
+	if utf8.RuneCountInString(text) <= length {
+		return text
+	}
+	runes := []rune(text)
+	return string(runes[:length])
+}
@@ -0,0 +1,84 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Command vrage-webadmin serves the browser admin panel of package webadmin
+//
+//	vrage-webadmin -listen :8084 -config vrage.json -users users.json
+//
+// Every profile of the config file becomes a managed server, -profiles limits the
+// panel to some of them. See package config for the format of the file.
+//
+// users.json lists the users, their roles and the tokens they log in with.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"gopkg.in/uranoxyd/govrageremote.v2/access"
+	"gopkg.in/uranoxyd/govrageremote.v2/config"
+	"gopkg.in/uranoxyd/govrageremote.v2/webadmin"
+)
+
+func main() {
+	listen := flag.String("listen", ":8084", "address to listen on")
+	configPath := flag.String("config", "", "config file with server profiles, see VRAGE_CONFIG")
+	profiles := flag.String("profiles", "", "comma separated profiles to manage, empty for all")
+	usersPath := flag.String("users", "users.json", "file listing the users, their roles and tokens")
+	flag.Parse()
+
+	logger := log.New(os.Stdout, "", log.LstdFlags)
+
+	users, err := access.LoadUsers(*usersPath)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	var servers *config.Config
+	if *configPath != "" {
+		servers, err = config.Load(*configPath)
+	} else {
+		servers, err = config.LoadDefault()
+	}
+	if err != nil {
+		logger.Fatal(err)
+	}
+	names := servers.Names()
+	if *profiles != "" {
+		names = strings.Split(*profiles, ",")
+	}
+	if len(names) == 0 {
+		logger.Fatal("no server profiles configured")
+	}
+
+	panel, err := webadmin.New(users)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	panel.Logger = logger
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		client, err := servers.Client(name)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		panel.AddServer(name, client)
+	}
+
+	logger.Printf("serving the admin panel for %d servers on %s", len(names), *listen)
+	logger.Fatal(http.ListenAndServe(*listen, panel))
+}
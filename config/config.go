@@ -0,0 +1,387 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package config loads named server profiles from a JSON or TOML file and builds
+// clients from them, so neither the address nor the key has to be hard coded.
+//
+//	{
+//	  "default": "main",
+//	  "profiles": {
+//	    "main": {
+//	      "address": "http://localhost:8080",
+//	      "keyFile": "main.key",
+//	      "timeout": "10s",
+//	      "retry": {"maxAttempts": 3, "delay": "500ms", "maxDelay": "5s"}
+//	    }
+//	  }
+//	}
+//
+// The same file in TOML:
+//
+//	default = "main"
+//
+//	[profiles.main]
+//	address = "http://localhost:8080"
+//	keyFile = "main.key"
+//	timeout = "10s"
+//
+//	[profiles.main.retry]
+//	maxAttempts = 3
+//
+// Every field of a profile can be overridden with an environment variable named
+// VRAGE_PROFILE_<PROFILE>_<FIELD>, like VRAGE_PROFILE_MAIN_KEY. The PROFILE_
+// part keeps them apart from the VRAGE_<FIELD> variables applied by Flags, a
+// profile called "read" would otherwise make VRAGE_READ_RATE ambiguous. A
+// relative key file from the config file is resolved against its directory, one
+// from the environment against the working directory. YAML is not supported, it
+// would need a dependency the library does not want to pull in.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/uranoxyd/govrageremote.v2"
+)
+
+// Duration accepts strings like "1m30s" or a number of seconds
+type Duration time.Duration
+
+func (duration Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(duration).String())
+}
+
+func (duration *Duration) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	switch value := value.(type) {
+	case float64:
+		*duration = Duration(value * float64(time.Second))
+	case string:
+		parsed, err := parseDuration(value)
+		if err != nil {
+			return err
+		}
+		*duration = parsed
+	case nil:
+	default:
+		return fmt.Errorf("invalid duration %s", data)
+	}
+	return nil
+}
+
+func parseDuration(text string) (Duration, error) {
+	if seconds, err := strconv.ParseFloat(text, 64); err == nil {
+		return Duration(seconds * float64(time.Second)), nil
+	}
+	parsed, err := time.ParseDuration(text)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q", text)
+	}
+	return Duration(parsed), nil
+}
+
+type Retry struct {
+	MaxAttempts int      `json:"maxAttempts"`
+	Delay       Duration `json:"delay"`
+	MaxDelay    Duration `json:"maxDelay"`
+	RetryWrites bool     `json:"retryWrites"`
+}
+
+// Profile describes how to reach one server
+type Profile struct {
+	Name      string   `json:"-"`
+	Address   string   `json:"address"`
+	BaseURL   string   `json:"baseURL,omitempty"`
+	Key       string   `json:"key,omitempty"`
+	KeyFile   string   `json:"keyFile,omitempty"`
+	Timeout   Duration `json:"timeout,omitempty"`
+	Retry     *Retry   `json:"retry,omitempty"`
+	ReadRate  float64  `json:"readRate,omitempty"`  // GET requests per second, zero is unlimited
+	WriteRate float64  `json:"writeRate,omitempty"` // other requests per second, zero is unlimited
+}
+
+// ReadKey returns the key of the profile, reading the key file if there is no key
+func (profile *Profile) ReadKey() (string, error) {
+	if profile.Key != "" || profile.KeyFile == "" {
+		return profile.Key, nil
+	}
+	data, err := ioutil.ReadFile(profile.KeyFile)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// Client builds a client for the profile
+func (profile *Profile) Client() (*govrageremote.VRageRemoteClient, error) {
+	if profile.Address == "" {
+		return nil, errors.New("profile " + profile.Name + " has no address")
+	}
+
+	key, err := profile.ReadKey()
+	if err != nil {
+		return nil, err
+	}
+
+	client := govrageremote.NewVRageRemoteClient(strings.TrimRight(profile.Address, "/"), key)
+	if profile.BaseURL != "" {
+		client.BaseURL = profile.BaseURL
+	}
+	if profile.Timeout > 0 {
+		client.SetTimeout(time.Duration(profile.Timeout))
+	}
+	if profile.Retry != nil {
+		client.Retry = &govrageremote.VRageRetryPolicy{
+			MaxAttempts: profile.Retry.MaxAttempts,
+			Delay:       time.Duration(profile.Retry.Delay),
+			MaxDelay:    time.Duration(profile.Retry.MaxDelay),
+			RetryWrites: profile.Retry.RetryWrites,
+		}
+	}
+	client.SetRateLimits(profile.ReadRate, profile.WriteRate)
+	return client, nil
+}
+
+// applyEnv overrides the fields of the profile with the environment variables
+// starting with prefix, like VRAGE_PROFILE_MAIN_ or VRAGE_
+func (profile *Profile) applyEnv(prefix string) error {
+	lookup := func(name string) (string, bool) {
+		return os.LookupEnv(prefix + name)
+	}
+
+	if value, ok := lookup("ADDRESS"); ok {
+		profile.Address = value
+	}
+	if value, ok := lookup("BASE_URL"); ok {
+		profile.BaseURL = value
+	}
+	if value, ok := lookup("KEY"); ok {
+		profile.Key = value
+	}
+	if value, ok := lookup("KEY_FILE"); ok {
+		profile.KeyFile = value
+		profile.Key = ""
+	}
+	if value, ok := lookup("TIMEOUT"); ok {
+		timeout, err := parseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%sTIMEOUT: %v", prefix, err)
+		}
+		profile.Timeout = timeout
+	}
+	if value, ok := lookup("RETRY_ATTEMPTS"); ok {
+		attempts, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%sRETRY_ATTEMPTS: %v", prefix, err)
+		}
+		if profile.Retry == nil {
+			profile.Retry = &Retry{Delay: Duration(500 * time.Millisecond), MaxDelay: Duration(5 * time.Second)}
+		}
+		profile.Retry.MaxAttempts = attempts
+	}
+	for name, target := range map[string]*float64{"READ_RATE": &profile.ReadRate, "WRITE_RATE": &profile.WriteRate} {
+		if value, ok := lookup(name); ok {
+			rate, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return fmt.Errorf("%s%s: %v", prefix, name, err)
+			}
+			*target = rate
+		}
+	}
+	return nil
+}
+
+// envPrefix is the prefix of the environment variables overriding the named profile
+func envPrefix(name string) string {
+	return "VRAGE_PROFILE_" + envName(name) + "_"
+}
+
+// envName turns a profile name into the part of an environment variable name
+func envName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+type Config struct {
+	Default  string              `json:"default,omitempty"`
+	Profiles map[string]*Profile `json:"profiles"`
+	path     string
+}
+
+// Names returns the names of all profiles, sorted
+func (config *Config) Names() []string {
+	names := make([]string, 0, len(config.Profiles))
+	for name := range config.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Profile returns a copy of the named profile with the VRAGE_PROFILE_<PROFILE>_
+// environment overrides applied. An empty name selects the default profile.
+func (config *Config) Profile(name string) (*Profile, error) {
+	profile, err := config.stored(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := profile.applyEnv(envPrefix(profile.Name)); err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+// stored returns a copy of the named profile as written in the file, with a
+// relative key file resolved against the directory of the config file
+func (config *Config) stored(name string) (*Profile, error) {
+	if name == "" {
+		name = config.Default
+	}
+	if name == "" && len(config.Profiles) == 1 {
+		for only := range config.Profiles {
+			name = only
+		}
+	}
+	if name == "" {
+		return nil, errors.New("no profile selected and no default profile configured")
+	}
+
+	stored, ok := config.Profiles[name]
+	if !ok {
+		return nil, errors.New("unknown profile " + name)
+	}
+
+	profile := *stored
+	if stored.Retry != nil {
+		retry := *stored.Retry
+		profile.Retry = &retry
+	}
+	profile.Name = name
+
+	if profile.KeyFile != "" && !filepath.IsAbs(profile.KeyFile) && config.path != "" {
+		profile.KeyFile = filepath.Join(filepath.Dir(config.path), profile.KeyFile)
+	}
+	return &profile, nil
+}
+
+// Client builds a client for the named profile
+func (config *Config) Client(name string) (*govrageremote.VRageRemoteClient, error) {
+	profile, err := config.Profile(name)
+	if err != nil {
+		return nil, err
+	}
+	return profile.Client()
+}
+
+// Parse reads a config in the given format, "json" or "toml"
+func Parse(data []byte, format string) (*Config, error) {
+	config := &Config{}
+	switch strings.ToLower(format) {
+	case "json":
+		if err := json.Unmarshal(data, config); err != nil {
+			return nil, err
+		}
+	case "toml":
+		// the TOML document is decoded through JSON so both share the field mapping
+		document, err := parseTOML(string(data))
+		if err != nil {
+			return nil, err
+		}
+		encoded, err := json.Marshal(document)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(encoded, config); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("unsupported config format " + format)
+	}
+
+	if config.Profiles == nil {
+		config.Profiles = make(map[string]*Profile)
+	}
+	envNames := make(map[string]string, len(config.Profiles))
+	for name, profile := range config.Profiles {
+		if profile == nil {
+			return nil, errors.New("profile " + name + " is empty")
+		}
+		profile.Name = name
+		if other, ok := envNames[envName(name)]; ok {
+			return nil, fmt.Errorf("profiles %s and %s share the environment variables %s*", other, name, envPrefix(name))
+		}
+		envNames[envName(name)] = name
+	}
+	if config.Default != "" && config.Profiles[config.Default] == nil {
+		return nil, errors.New("default profile " + config.Default + " does not exist")
+	}
+	return config, nil
+}
+
+// Load reads the config file at path, the format is chosen by the extension
+func Load(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	config, err := Parse(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	config.path = path
+	return config, nil
+}
+
+// DefaultPaths are searched by LoadDefault in order
+func DefaultPaths() []string {
+	var paths []string
+	if dir, err := os.UserConfigDir(); err == nil {
+		paths = append(paths, filepath.Join(dir, "vrage", "config.json"), filepath.Join(dir, "vrage", "config.toml"))
+	}
+	return append(paths, "vrage.json", "vrage.toml")
+}
+
+// LoadDefault loads the file named by VRAGE_CONFIG or the first of DefaultPaths
+// which exists. Without any file an empty config is returned.
+func LoadDefault() (*Config, error) {
+	if path := os.Getenv("VRAGE_CONFIG"); path != "" {
+		return Load(path)
+	}
+	for _, path := range DefaultPaths() {
+		if _, err := os.Stat(path); err == nil {
+			return Load(path)
+		}
+	}
+	return &Config{Profiles: make(map[string]*Profile)}, nil
+}
@@ -0,0 +1,166 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setenv sets an environment variable for the rest of the test
+func setenv(t *testing.T, name string, value string) {
+	old, existed := os.LookupEnv(name)
+	os.Setenv(name, value)
+	t.Cleanup(func() {
+		if existed {
+			os.Setenv(name, old)
+		} else {
+			os.Unsetenv(name)
+		}
+	})
+}
+
+const testTOML = `default = "main"
+
+[profiles.main]
+address = "http://main:8080"
+keyFile = "main.key"
+timeout = "10s"
+
+[profiles.main.retry]
+maxAttempts = 3
+delay = 0.5
+
+[profiles.read-only]
+address = "http://read:8080"
+key = "cmVhZA=="
+readRate = 2
+`
+
+func TestParse(t *testing.T) {
+	toml, err := Parse([]byte(testTOML), "toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	json, err := Parse([]byte(`{
+		"default": "main",
+		"profiles": {
+			"main": {"address": "http://main:8080", "keyFile": "main.key", "timeout": "10s", "retry": {"maxAttempts": 3, "delay": 0.5}},
+			"read-only": {"address": "http://read:8080", "key": "cmVhZA==", "readRate": 2}
+		}
+	}`), "JSON")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for format, config := range map[string]*Config{"toml": toml, "json": json} {
+		if names := strings.Join(config.Names(), ","); names != "main,read-only" {
+			t.Errorf("%s: profiles %s", format, names)
+		}
+		main := config.Profiles["main"]
+		if config.Default != "main" || main.Name != "main" || main.Address != "http://main:8080" || main.Timeout != Duration(10*time.Second) {
+			t.Errorf("%s: main profile %+v", format, main)
+		}
+		if main.Retry == nil || main.Retry.MaxAttempts != 3 || main.Retry.Delay != Duration(500*time.Millisecond) {
+			t.Errorf("%s: retry %+v", format, main.Retry)
+		}
+		if readOnly := config.Profiles["read-only"]; readOnly.ReadRate != 2 || readOnly.Key != "cmVhZA==" {
+			t.Errorf("%s: read-only profile %+v", format, readOnly)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		format string
+		err    string
+	}{
+		{"format", `{}`, "yaml", "unsupported config format yaml"},
+		{"default missing", `{"default": "main", "profiles": {}}`, "json", "default profile main does not exist"},
+		{"empty profile", `{"profiles": {"main": null}}`, "json", "profile main is empty"},
+		{"invalid duration", `{"profiles": {"main": {"timeout": "soon"}}}`, "json", `invalid duration "soon"`},
+		{"toml syntax", "[profiles.main]\n[profiles.main]", "toml", "line 2: table profiles.main defined twice"},
+		{"env collision", `{"profiles": {"eu-west": {}, "EU_WEST": {}}}`, "json", "share the environment variables VRAGE_PROFILE_EU_WEST_*"},
+		{"env collision toml", "[profiles.'a.b']\n[profiles.a_b]", "toml", "share the environment variables VRAGE_PROFILE_A_B_*"},
+	}
+	for _, test := range tests {
+		_, err := Parse([]byte(test.data), test.format)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: got %v, want %q", test.name, err, test.err)
+		}
+	}
+
+	// names which only look alike are fine
+	if _, err := Parse([]byte(`{"profiles": {"eu-west": {}, "eu-west-2": {}, "read": {}}}`), "json"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestProfile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "vrage.toml")
+	if err := ioutil.WriteFile(path, []byte(testTOML), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "main.key"), []byte("bWFpbg==\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	config, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the default profile, its key file is found next to the config file
+	profile, err := config.Profile("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key, err := profile.ReadKey(); err != nil || key != "bWFpbg==" {
+		t.Errorf("key %q, %v", key, err)
+	}
+
+	// environment overrides change the copy, not the config
+	setenv(t, "VRAGE_PROFILE_MAIN_ADDRESS", "http://env:8080")
+	setenv(t, "VRAGE_PROFILE_MAIN_RETRY_ATTEMPTS", "5")
+	setenv(t, "VRAGE_PROFILE_READ_ONLY_WRITE_RATE", "1.5")
+	setenv(t, "VRAGE_ADDRESS", "http://ignored:8080")
+	profile, err = config.Profile("main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.Address != "http://env:8080" || profile.Retry.MaxAttempts != 5 {
+		t.Errorf("main profile %+v, retry %+v", profile, profile.Retry)
+	}
+	if stored := config.Profiles["main"]; stored.Address != "http://main:8080" || stored.Retry.MaxAttempts != 3 || stored.KeyFile != "main.key" {
+		t.Errorf("stored profile changed to %+v", stored)
+	}
+	if profile, err := config.Profile("read-only"); err != nil || profile.WriteRate != 1.5 || profile.Address != "http://read:8080" {
+		t.Errorf("read-only profile %+v, %v", profile, err)
+	}
+
+	setenv(t, "VRAGE_PROFILE_MAIN_TIMEOUT", "later")
+	if _, err := config.Profile("main"); err == nil || !strings.Contains(err.Error(), "VRAGE_PROFILE_MAIN_TIMEOUT") {
+		t.Errorf("got %v", err)
+	}
+	if _, err := config.Profile("other"); err == nil {
+		t.Error("unknown profile was found")
+	}
+}
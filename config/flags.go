@@ -0,0 +1,123 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package config
+
+import (
+	"flag"
+	"os"
+
+	"gopkg.in/uranoxyd/govrageremote.v2"
+)
+
+// DefaultAddress is used when neither a config file, the environment nor a flag
+// name a server
+const DefaultAddress = "http://localhost:8080"
+
+// Flags are the command line flags shared by all bundled commands. The profile
+// is built from the config file, then the VRAGE_<FIELD> environment variables
+// are applied, then the VRAGE_PROFILE_<PROFILE>_<FIELD> ones and at last the
+// flags given on the command line, so the more specific setting always wins.
+type Flags struct {
+	Config  string
+	Profile string
+	Address string
+	Key     string
+	KeyFile string
+	set     *flag.FlagSet
+}
+
+// Resolve loads the config and returns the selected profile with all overrides applied
+func (flags *Flags) Resolve() (*Profile, error) {
+	var config *Config
+	var err error
+	if flags.Config != "" {
+		config, err = Load(flags.Config)
+	} else {
+		config, err = LoadDefault()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	name := flags.Profile
+	if name == "" {
+		name = os.Getenv("VRAGE_PROFILE")
+	}
+
+	var profile *Profile
+	if name == "" && config.Default == "" && len(config.Profiles) != 1 {
+		profile = &Profile{Address: DefaultAddress}
+	} else if profile, err = config.stored(name); err != nil {
+		return nil, err
+	}
+
+	if err := profile.applyEnv("VRAGE_"); err != nil {
+		return nil, err
+	}
+	if profile.Name != "" {
+		if err := profile.applyEnv(envPrefix(profile.Name)); err != nil {
+			return nil, err
+		}
+	}
+
+	visited := make(map[string]bool)
+	if flags.set != nil {
+		flags.set.Visit(func(f *flag.Flag) { visited[f.Name] = true })
+	}
+	if visited["address"] {
+		profile.Address = flags.Address
+	}
+	if visited["key"] {
+		profile.Key = flags.Key
+	}
+	if visited["key-file"] {
+		profile.KeyFile = flags.KeyFile
+		if !visited["key"] {
+			profile.Key = ""
+		}
+	}
+	return profile, nil
+}
+
+// Client resolves the profile and builds a client for it
+func (flags *Flags) Client() (*govrageremote.VRageRemoteClient, *Profile, error) {
+	profile, err := flags.Resolve()
+	if err != nil {
+		return nil, nil, err
+	}
+	client, err := profile.Client()
+	if err != nil {
+		return nil, nil, err
+	}
+	return client, profile, nil
+}
+
+// Client builds a client from the config file and the environment the same way
+// the bundled commands do, just without command line flags
+func Client() (*govrageremote.VRageRemoteClient, error) {
+	client, _, err := (&Flags{}).Client()
+	return client, err
+}
+
+// AddFlags registers -config, -profile, -address, -key and -key-file on set
+func AddFlags(set *flag.FlagSet) *Flags {
+	flags := &Flags{set: set}
+	set.StringVar(&flags.Config, "config", "", "config file with server profiles, see VRAGE_CONFIG")
+	set.StringVar(&flags.Profile, "profile", "", "server profile to use, see VRAGE_PROFILE")
+	set.StringVar(&flags.Address, "address", DefaultAddress, "remote api address, overrides the profile")
+	set.StringVar(&flags.Key, "key", "", "remote api key, overrides the profile")
+	set.StringVar(&flags.KeyFile, "key-file", "", "file containing the remote api key, overrides the profile")
+	return flags
+}
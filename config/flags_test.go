@@ -0,0 +1,115 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package config
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestResolvePrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vrage.json")
+	data := `{"default": "main", "profiles": {
+		"main": {"address": "http://file", "key": "file", "timeout": "5s", "readRate": 1, "writeRate": 1},
+		"other": {"address": "http://other"}
+	}}`
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// every layer sets fewer fields than the one before, so each field shows
+	// which layer won
+	setenv(t, "VRAGE_ADDRESS", "http://env")
+	setenv(t, "VRAGE_KEY", "env")
+	setenv(t, "VRAGE_TIMEOUT", "10s")
+	setenv(t, "VRAGE_READ_RATE", "2")
+	setenv(t, "VRAGE_PROFILE_MAIN_ADDRESS", "http://profile-env")
+	setenv(t, "VRAGE_PROFILE_MAIN_KEY", "profile-env")
+	setenv(t, "VRAGE_PROFILE_MAIN_TIMEOUT", "20s")
+
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags := AddFlags(set)
+	if err := set.Parse([]string{"-config", path, "-address", "http://flag"}); err != nil {
+		t.Fatal(err)
+	}
+
+	profile, err := flags.Resolve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		field string
+		got   interface{}
+		want  interface{}
+	}{
+		{"name", profile.Name, "main"},
+		{"address from the flag", profile.Address, "http://flag"},
+		{"key from VRAGE_PROFILE_MAIN_", profile.Key, "profile-env"},
+		{"timeout from VRAGE_PROFILE_MAIN_", time.Duration(profile.Timeout), 20 * time.Second},
+		{"read rate from VRAGE_", profile.ReadRate, 2.0},
+		{"write rate from the file", profile.WriteRate, 1.0},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("%s: %v, want %v", test.field, test.got, test.want)
+		}
+	}
+
+	// the variables of another profile do not apply
+	setenv(t, "VRAGE_PROFILE", "other")
+	flags = AddFlags(flag.NewFlagSet("test", flag.ContinueOnError))
+	flags.Config = path
+	if profile, err := flags.Resolve(); err != nil || profile.Name != "other" || profile.Address != "http://env" || profile.Key != "env" {
+		t.Errorf("other profile %+v, %v", profile, err)
+	}
+
+	// the flag picks the profile over VRAGE_PROFILE, a key file replaces the key
+	set = flag.NewFlagSet("test", flag.ContinueOnError)
+	flags = AddFlags(set)
+	if err := set.Parse([]string{"-config", path, "-profile", "main", "-key-file", "flag.key"}); err != nil {
+		t.Fatal(err)
+	}
+	if profile, err := flags.Resolve(); err != nil || profile.Name != "main" || profile.Key != "" || profile.KeyFile != "flag.key" || profile.Address != "http://profile-env" {
+		t.Errorf("main profile %+v, %v", profile, err)
+	}
+}
+
+func TestResolveWithoutConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vrage.json")
+	if err := ioutil.WriteFile(path, []byte(`{"profiles": {"a": {}, "b": {}}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	setenv(t, "VRAGE_PROFILE", "")
+	setenv(t, "VRAGE_KEY", "env")
+
+	// without a selected profile the default address is used with the VRAGE_ variables
+	flags := AddFlags(flag.NewFlagSet("test", flag.ContinueOnError))
+	flags.Config = path
+	profile, err := flags.Resolve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.Name != "" || profile.Address != DefaultAddress || profile.Key != "env" {
+		t.Errorf("profile %+v", profile)
+	}
+
+	flags.Profile = "c"
+	if _, err := flags.Resolve(); err == nil {
+		t.Error("unknown profile was resolved")
+	}
+}
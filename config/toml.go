@@ -0,0 +1,248 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseTOML understands the part of TOML a config file needs: comments, tables,
+// dotted table names and keys, basic and literal strings, integers, floats,
+// booleans and single line arrays of those.
+func parseTOML(text string) (map[string]interface{}, error) {
+	document := make(map[string]interface{})
+	table := document
+	defined := make(map[string]bool) // tables with a header, each may only have one
+
+	for number, line := range strings.Split(text, "\n") {
+		fail := func(format string, args ...interface{}) error {
+			return fmt.Errorf("line %d: %s", number+1, fmt.Sprintf(format, args...))
+		}
+
+		line = strings.TrimSpace(stripComment(line))
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") || strings.HasPrefix(line, "[[") {
+				return nil, fail("invalid table header %s", line)
+			}
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			path := strings.Join(splitKey(name), "\x00")
+			if defined[path] {
+				return nil, fail("table %s defined twice", name)
+			}
+			defined[path] = true
+
+			var err error
+			table, err = tomlTable(document, name)
+			if err != nil {
+				return nil, fail("%v", err)
+			}
+			continue
+		}
+
+		equals := indexUnquoted(line, '=')
+		if equals < 0 {
+			return nil, fail("expected key = value")
+		}
+		path := splitKey(strings.TrimSpace(line[:equals]))
+		value, err := tomlValue(strings.TrimSpace(line[equals+1:]))
+		if err != nil {
+			return nil, fail("%v", err)
+		}
+
+		target, err := tomlTable(table, strings.Join(path[:len(path)-1], "."))
+		if err != nil {
+			return nil, fail("%v", err)
+		}
+		key := path[len(path)-1]
+		if _, exists := target[key]; exists {
+			return nil, fail("duplicate key %s", key)
+		}
+		target[key] = value
+	}
+	return document, nil
+}
+
+// tomlTable returns the table at the dotted path below root, creating it if needed
+func tomlTable(root map[string]interface{}, name string) (map[string]interface{}, error) {
+	table := root
+	if name == "" {
+		return table, nil
+	}
+	for _, part := range splitKey(name) {
+		if part == "" {
+			return nil, errors.New("empty table name in " + name)
+		}
+		next, exists := table[part]
+		if !exists {
+			created := make(map[string]interface{})
+			table[part] = created
+			table = created
+			continue
+		}
+		nested, ok := next.(map[string]interface{})
+		if !ok {
+			return nil, errors.New(part + " is not a table")
+		}
+		table = nested
+	}
+	return table, nil
+}
+
+// splitKey splits a dotted key, quoted parts may contain dots
+func splitKey(key string) []string {
+	var parts []string
+	var part strings.Builder
+	var quote rune
+	escaped := false
+	for _, r := range key {
+		switch {
+		case escaped:
+			escaped = false
+			part.WriteRune(r)
+		case quote == '"' && r == '\\':
+			escaped = true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			part.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '.':
+			parts = append(parts, strings.TrimSpace(part.String()))
+			part.Reset()
+		default:
+			part.WriteRune(r)
+		}
+	}
+	return append(parts, strings.TrimSpace(part.String()))
+}
+
+// stripComment removes a trailing comment outside of strings
+func stripComment(line string) string {
+	if i := indexUnquoted(line, '#'); i >= 0 {
+		return line[:i]
+	}
+	return line
+}
+
+// indexUnquoted returns the index of the first c outside of basic and literal
+// strings, or -1. Only basic strings know escapes.
+func indexUnquoted(text string, c rune) int {
+	var quote rune
+	escaped := false
+	for i, r := range text {
+		switch {
+		case escaped:
+			escaped = false
+		case quote == '"' && r == '\\':
+			escaped = true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote == 0 && (r == '"' || r == '\''):
+			quote = r
+		case quote == 0 && r == c:
+			return i
+		}
+	}
+	return -1
+}
+
+func tomlValue(text string) (interface{}, error) {
+	switch {
+	case text == "":
+		return nil, errors.New("missing value")
+	case text == "true":
+		return true, nil
+	case text == "false":
+		return false, nil
+	case strings.HasPrefix(text, `"`):
+		if len(text) < 2 || !strings.HasSuffix(text, `"`) {
+			return nil, errors.New("unterminated string")
+		}
+		return strconv.Unquote(text)
+	case strings.HasPrefix(text, "'"):
+		if len(text) < 2 || !strings.HasSuffix(text, "'") {
+			return nil, errors.New("unterminated string")
+		}
+		if strings.Contains(text[1:len(text)-1], "'") {
+			return nil, errors.New("invalid string " + text)
+		}
+		return text[1 : len(text)-1], nil
+	case strings.HasPrefix(text, "["):
+		if !strings.HasSuffix(text, "]") {
+			return nil, errors.New("unterminated array")
+		}
+		return tomlArray(text[1 : len(text)-1])
+	}
+
+	number := strings.Replace(text, "_", "", -1)
+	if value, err := strconv.ParseInt(number, 0, 64); err == nil {
+		return value, nil
+	}
+	if value, err := strconv.ParseFloat(number, 64); err == nil {
+		return value, nil
+	}
+	return nil, errors.New("invalid value " + text)
+}
+
+func tomlArray(text string) ([]interface{}, error) {
+	values := []interface{}{}
+	var quote rune
+	start := 0
+	flush := func(end int) error {
+		item := strings.TrimSpace(text[start:end])
+		start = end + 1
+		if item == "" {
+			return nil // trailing comma
+		}
+		value, err := tomlValue(item)
+		if err != nil {
+			return err
+		}
+		values = append(values, value)
+		return nil
+	}
+
+	escaped := false
+	for i, r := range text {
+		switch {
+		case escaped:
+			escaped = false
+		case quote == '"' && r == '\\':
+			escaped = true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote == 0 && (r == '"' || r == '\''):
+			quote = r
+		case quote == 0 && r == '[':
+			return nil, errors.New("nested arrays are not supported")
+		case quote == 0 && r == ',':
+			if err := flush(i); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := flush(len(text)); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
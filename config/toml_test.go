@@ -0,0 +1,115 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package config
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestParseTOML(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string // the document as JSON, empty if parsing fails
+	}{
+		{
+			"values",
+			`s = "a \"quoted\" \u00e9" # comment
+l = 'C:\keys\main.key'
+i = 1_000
+h = 0x10
+f = 1.5
+b = true
+a = [1, "two", 'three', false, ]
+empty = []`,
+			`{"a":[1,"two","three",false],"b":true,"empty":[],"f":1.5,"h":16,"i":1000,"l":"C:\\keys\\main.key","s":"a \"quoted\" é"}`,
+		},
+		{
+			"tables",
+			`[profiles.main]
+address = "http://main"
+[profiles.main.retry]
+maxAttempts = 3
+[profiles]
+default.address = "http://default"`,
+			`{"profiles":{"default":{"address":"http://default"},"main":{"address":"http://main","retry":{"maxAttempts":3}}}}`,
+		},
+		{
+			"quoted keys",
+			`"a=b" = 1
+'c = d' = "e = f"
+"dotted.key" = 2
+x."y.z" = 3
+"quote\"d" = 4
+[ "table=name" . 'inner' ]
+k = 5`,
+			`{"a=b":1,"c = d":"e = f","dotted.key":2,"quote\"d":4,"table=name":{"inner":{"k":5}},"x":{"y.z":3}}`,
+		},
+		{
+			"literal strings have no escapes",
+			`a = ["say \"hi\", then go", 'it''s', "back\\", "#not a comment"] # comment`,
+			``,
+		},
+		{
+			"arrays with escaped quotes and commas",
+			`a = ["say \"hi\", then go", "back\\", "#not a comment", 'x, y'] # comment`,
+			`{"a":["say \"hi\", then go","back\\","#not a comment","x, y"]}`,
+		},
+		{"comment in string", `s = "a # b" # c`, `{"s":"a # b"}`},
+
+		{"repeated table", "[profiles.main]\na = 1\n[profiles.main]\nb = 2", ""},
+		{"repeated quoted table", "[profiles.main]\na = 1\n[profiles.'main']\nb = 2", ""},
+		{"duplicate key", "a = 1\na = 2", ""},
+		{"duplicate dotted key", "[x]\ny.z = 1\n[x.y]\nz = 2", ""},
+		{"key is no table", "a = 1\n[a]", ""},
+		{"array of tables", "[[profiles]]", ""},
+		{"unterminated header", "[profiles", ""},
+		{"empty table name", "[a..b]", ""},
+		{"missing equals", "address", ""},
+		{"missing value", "a =", ""},
+		{"unterminated string", `a = "open`, ""},
+		{"unterminated literal", `a = 'open`, ""},
+		{"unterminated array", `a = [1, 2`, ""},
+		{"nested array", `a = [[1], [2]]`, ""},
+		{"invalid value", `a = yes`, ""},
+	}
+
+	for _, test := range tests {
+		document, err := parseTOML(test.text)
+		if test.want == "" {
+			if err == nil {
+				data, _ := json.Marshal(document)
+				t.Errorf("%s: parsed to %s, want an error", test.name, data)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if data, _ := json.Marshal(document); string(data) != test.want {
+			t.Errorf("%s: parsed to\n%s\nwant\n%s", test.name, data, test.want)
+		}
+	}
+}
+
+func TestParseTOMLLineNumbers(t *testing.T) {
+	_, err := parseTOML("a = 1\n\n# comment\n[t]\n[t]")
+	if err == nil || !strings.HasPrefix(err.Error(), "line 5: ") {
+		t.Errorf("got %v", err)
+	}
+}
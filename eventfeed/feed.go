@@ -0,0 +1,262 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package eventfeed pushes server events like chat messages, joining players,
+// removed grids and watchdog alerts to browsers over Server-Sent Events or
+// WebSockets. Clients pick the topics they are interested in and get the most
+// recent events replayed when they connect.
+package eventfeed
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/uranoxyd/govrageremote.v2"
+)
+
+const (
+	TopicChat    = "chat"
+	TopicPlayers = "players"
+	TopicGrids   = "grids"
+	TopicAlerts  = "alerts"
+)
+
+// Topics lists all topics a Feed publishes to
+var Topics = []string{TopicChat, TopicPlayers, TopicGrids, TopicAlerts}
+
+const (
+	TypeChatMessage   = "chat.message"
+	TypePlayerJoined  = "player.joined"
+	TypePlayerLeft    = "player.left"
+	TypeGridAdded     = "grid.added"
+	TypeGridRemoved   = "grid.removed"
+	TypeAlertRaised   = "alert.raised"
+	TypeAlertResolved = "alert.resolved"
+)
+
+type Event struct {
+	ID    uint64      `json:"id"`
+	Topic string      `json:"topic"`
+	Type  string      `json:"type"`
+	Time  time.Time   `json:"time"`
+	Data  interface{} `json:"data"`
+}
+
+// Subscription receives the events of its topics until it is closed. A
+// subscriber which does not keep up is dropped and Events is closed.
+type Subscription struct {
+	Events <-chan *Event
+	events chan *Event
+	topics map[string]bool
+	feed   *Feed
+	closed bool
+}
+
+func (subscription *Subscription) wants(topic string) bool {
+	return len(subscription.topics) == 0 || subscription.topics[topic]
+}
+
+func (subscription *Subscription) Close() {
+	subscription.feed.mutex.Lock()
+	defer subscription.feed.mutex.Unlock()
+	subscription.feed.unsubscribe(subscription)
+}
+
+// Feed distributes events to subscribers and keeps the most recent ones for
+// replay. The zero value is ready to use and replays nothing.
+type Feed struct {
+	ReplaySize  int // events kept for replay
+	BufferSize  int // events queued per subscriber before it is dropped, 64 if zero
+	nextID      uint64
+	recent      []*Event
+	subscribers map[*Subscription]bool
+	mutex       sync.Mutex
+}
+
+func (feed *Feed) Publish(topic string, eventType string, data interface{}) *Event {
+	feed.mutex.Lock()
+	defer feed.mutex.Unlock()
+
+	feed.nextID++
+	event := &Event{
+		ID:    feed.nextID,
+		Topic: topic,
+		Type:  eventType,
+		Time:  time.Now(),
+		Data:  data,
+	}
+
+	feed.recent = append(feed.recent, event)
+	if len(feed.recent) > feed.ReplaySize {
+		feed.recent = feed.recent[len(feed.recent)-feed.ReplaySize:]
+	}
+
+	for subscription := range feed.subscribers {
+		if !subscription.wants(topic) {
+			continue
+		}
+		select {
+		case subscription.events <- event:
+		default:
+			feed.unsubscribe(subscription)
+		}
+	}
+	return event
+}
+
+// Subscribe returns a subscription to topics, all topics if none are given. The
+// recent events with an id above after are queued for replay first.
+func (feed *Feed) Subscribe(topics []string, after uint64) *Subscription {
+	feed.mutex.Lock()
+	defer feed.mutex.Unlock()
+
+	bufferSize := feed.BufferSize
+	if bufferSize <= 0 {
+		bufferSize = 64
+	}
+	if bufferSize < len(feed.recent) {
+		bufferSize = len(feed.recent)
+	}
+	events := make(chan *Event, bufferSize)
+	subscription := &Subscription{
+		Events: events,
+		events: events,
+		topics: make(map[string]bool),
+		feed:   feed,
+	}
+	for _, topic := range topics {
+		if topic = strings.TrimSpace(topic); topic != "" {
+			subscription.topics[topic] = true
+		}
+	}
+
+	for _, event := range feed.recent {
+		if event.ID > after && subscription.wants(event.Topic) {
+			events <- event
+		}
+	}
+
+	if feed.subscribers == nil {
+		feed.subscribers = make(map[*Subscription]bool)
+	}
+	feed.subscribers[subscription] = true
+	return subscription
+}
+
+// unsubscribe expects the mutex to be held
+func (feed *Feed) unsubscribe(subscription *Subscription) {
+	if subscription.closed {
+		return
+	}
+	subscription.closed = true
+	delete(feed.subscribers, subscription)
+	close(subscription.events)
+}
+
+// Notify publishes watchdog alerts, so a Feed can be added to a VRageWatchdog
+func (feed *Feed) Notify(alert *govrageremote.VRageAlert) error {
+	eventType := TypeAlertRaised
+	if alert.State == govrageremote.VRageAlertResolved {
+		eventType = TypeAlertResolved
+	}
+	feed.Publish(TopicAlerts, eventType, alert)
+	return nil
+}
+
+//--
+//-- Polling
+//--
+
+// Poller feeds the changes seen by the chat, player and grid watchers into a Feed
+type Poller struct {
+	Feed    *Feed
+	Chat    *govrageremote.VRageChatWatcher
+	Players *govrageremote.VRagePlayerWatcher
+	Grids   *govrageremote.VRageGridWatcher
+	OnError func(err error)
+}
+
+// Poll runs every watcher once, watchers which are nil are skipped
+func (poller *Poller) Poll() {
+	if poller.Chat != nil {
+		messages, err := poller.Chat.Poll()
+		poller.report(err)
+		for _, message := range messages {
+			poller.Feed.Publish(TopicChat, TypeChatMessage, message)
+		}
+	}
+
+	if poller.Players != nil {
+		joined, left, err := poller.Players.Poll()
+		poller.report(err)
+		for _, player := range joined {
+			poller.Feed.Publish(TopicPlayers, TypePlayerJoined, player)
+		}
+		for _, player := range left {
+			poller.Feed.Publish(TopicPlayers, TypePlayerLeft, player)
+		}
+	}
+
+	if poller.Grids != nil {
+		added, removed, err := poller.Grids.Poll()
+		poller.report(err)
+		for _, grid := range added {
+			poller.Feed.Publish(TopicGrids, TypeGridAdded, grid)
+		}
+		for _, grid := range removed {
+			poller.Feed.Publish(TopicGrids, TypeGridRemoved, grid)
+		}
+	}
+}
+
+// Run polls every interval until stop is closed
+func (poller *Poller) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	poller.Poll()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			poller.Poll()
+		}
+	}
+}
+
+func (poller *Poller) report(err error) {
+	if err != nil && poller.OnError != nil {
+		poller.OnError(err)
+	}
+}
+
+// NewPoller creates a poller watching chat, players and grids of client
+func NewPoller(feed *Feed, client *govrageremote.VRageRemoteClient) *Poller {
+	return &Poller{
+		Feed:    feed,
+		Chat:    govrageremote.NewVRageChatWatcher(client),
+		Players: govrageremote.NewVRagePlayerWatcher(client),
+		Grids:   govrageremote.NewVRageGridWatcher(client),
+	}
+}
+
+func New() *Feed {
+	return &Feed{
+		ReplaySize:  100,
+		BufferSize:  64,
+		subscribers: make(map[*Subscription]bool),
+	}
+}
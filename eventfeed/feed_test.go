@@ -0,0 +1,188 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package eventfeed
+
+import (
+	"testing"
+
+	"gopkg.in/uranoxyd/govrageremote.v2"
+)
+
+// received returns the events queued for subscription without waiting
+func received(subscription *Subscription) (events []*Event, open bool) {
+	for {
+		select {
+		case event, ok := <-subscription.Events:
+			if !ok {
+				return events, false
+			}
+			events = append(events, event)
+		default:
+			return events, true
+		}
+	}
+}
+
+func eventIDs(events []*Event) []uint64 {
+	ids := make([]uint64, len(events))
+	for i, event := range events {
+		ids[i] = event.ID
+	}
+	return ids
+}
+
+func sameIDs(a []uint64, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestFeedZeroValue(t *testing.T) {
+	var feed Feed
+	subscription := feed.Subscribe(nil, 0)
+	defer subscription.Close()
+
+	feed.Publish(TopicChat, TypeChatMessage, "hello")
+	events, open := received(subscription)
+	if !open || len(events) != 1 || events[0].Data != "hello" {
+		t.Errorf("got %v, open %t", events, open)
+	}
+
+	// nothing is kept for replay
+	late := feed.Subscribe(nil, 0)
+	defer late.Close()
+	if events, _ := received(late); len(events) != 0 {
+		t.Errorf("zero feed replayed %v", events)
+	}
+}
+
+func TestFeedReplay(t *testing.T) {
+	feed := New()
+	feed.ReplaySize = 4
+	for _, topic := range []string{TopicChat, TopicPlayers, TopicChat, TopicChat, TopicGrids, TopicChat} {
+		feed.Publish(topic, "test", nil)
+	}
+
+	tests := []struct {
+		topics []string
+		after  uint64
+		want   []uint64
+	}{
+		{nil, 0, []uint64{3, 4, 5, 6}},
+		{nil, 4, []uint64{5, 6}},
+		{[]string{TopicChat}, 0, []uint64{3, 4, 6}},
+		{[]string{" chat", "grids "}, 3, []uint64{4, 5, 6}},
+		{[]string{TopicPlayers}, 0, nil},
+		{[]string{""}, 5, []uint64{6}},
+		{nil, 6, nil},
+	}
+	for _, test := range tests {
+		subscription := feed.Subscribe(test.topics, test.after)
+		events, _ := received(subscription)
+		if got := eventIDs(events); !sameIDs(got, test.want) {
+			t.Errorf("Subscribe(%q, %d) replayed %v, want %v", test.topics, test.after, got, test.want)
+		}
+		subscription.Close()
+	}
+}
+
+func TestFeedTopics(t *testing.T) {
+	feed := New()
+	chat := feed.Subscribe([]string{TopicChat}, 0)
+	all := feed.Subscribe(nil, 0)
+
+	feed.Publish(TopicChat, TypeChatMessage, nil)
+	feed.Publish(TopicPlayers, TypePlayerJoined, nil)
+
+	if events, _ := received(chat); !sameIDs(eventIDs(events), []uint64{1}) {
+		t.Errorf("chat subscriber got %v", eventIDs(events))
+	}
+	if events, _ := received(all); !sameIDs(eventIDs(events), []uint64{1, 2}) {
+		t.Errorf("subscriber to all topics got %v", eventIDs(events))
+	}
+
+	// closed subscriptions get nothing and may be closed again
+	chat.Close()
+	chat.Close()
+	feed.Publish(TopicChat, TypeChatMessage, nil)
+	if events, open := received(chat); len(events) != 0 || open {
+		t.Errorf("closed subscription got %v, open %t", eventIDs(events), open)
+	}
+	all.Close()
+}
+
+func TestFeedSlowSubscriber(t *testing.T) {
+	feed := New()
+	feed.BufferSize = 2
+	slow := feed.Subscribe(nil, 0)
+	fast := feed.Subscribe(nil, 0)
+
+	feed.Publish(TopicChat, TypeChatMessage, nil)
+	feed.Publish(TopicChat, TypeChatMessage, nil)
+	if events, _ := received(fast); len(events) != 2 {
+		t.Fatalf("fast subscriber got %v", eventIDs(events))
+	}
+	feed.Publish(TopicChat, TypeChatMessage, nil)
+
+	// the slow subscriber gets what was queued and is dropped
+	events, open := received(slow)
+	if !sameIDs(eventIDs(events), []uint64{1, 2}) || open {
+		t.Errorf("slow subscriber got %v, open %t", eventIDs(events), open)
+	}
+	slow.Close()
+
+	if events, open := received(fast); !sameIDs(eventIDs(events), []uint64{3}) || !open {
+		t.Errorf("fast subscriber got %v, open %t", eventIDs(events), open)
+	}
+	if len(feed.subscribers) != 1 {
+		t.Errorf("feed has %d subscribers, want 1", len(feed.subscribers))
+	}
+	fast.Close()
+}
+
+func TestFeedReplayExceedsBuffer(t *testing.T) {
+	feed := New()
+	feed.BufferSize = 1
+	for i := 0; i < 5; i++ {
+		feed.Publish(TopicChat, TypeChatMessage, nil)
+	}
+	subscription := feed.Subscribe(nil, 0)
+	defer subscription.Close()
+	if events, open := received(subscription); len(events) != 5 || !open {
+		t.Errorf("replayed %v, open %t", eventIDs(events), open)
+	}
+}
+
+func TestFeedNotify(t *testing.T) {
+	feed := New()
+	subscription := feed.Subscribe([]string{TopicAlerts}, 0)
+	defer subscription.Close()
+
+	raised := &govrageremote.VRageAlert{State: govrageremote.VRageAlertRaised}
+	resolved := &govrageremote.VRageAlert{State: govrageremote.VRageAlertResolved}
+	feed.Notify(raised)
+	feed.Notify(resolved)
+
+	events, _ := received(subscription)
+	if len(events) != 2 || events[0].Type != TypeAlertRaised || events[0].Data != raised || events[1].Type != TypeAlertResolved {
+		t.Errorf("got %v", events)
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package eventfeed
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Handler serves a Feed. Requests asking for a WebSocket upgrade get one, all
+// others get a Server-Sent Events stream. Both take the topics as a comma
+// separated list, like /events?topics=chat,players, and replay the recent events
+// after the id given as ?after= or in the Last-Event-ID header.
+type Handler struct {
+	Feed        *Feed
+	AllowOrigin string                           // value of Access-Control-Allow-Origin, empty disables CORS, also the only foreign origin allowed to open a WebSocket
+	Authorize   func(request *http.Request) bool // rejects the request if it returns false, nil allows everyone
+	KeepAlive   time.Duration                    // interval of keep alive messages
+}
+
+func (handler *Handler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	if handler.AllowOrigin != "" {
+		writer.Header().Set("Access-Control-Allow-Origin", handler.AllowOrigin)
+	}
+	if handler.Authorize != nil && !handler.Authorize(request) {
+		http.Error(writer, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	query := request.URL.Query()
+	var topics []string
+	if query.Get("topics") != "" {
+		topics = strings.Split(query.Get("topics"), ",")
+	}
+
+	lastID := request.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = query.Get("after")
+	}
+	after, _ := strconv.ParseUint(lastID, 10, 64)
+
+	if isWebSocketUpgrade(request) {
+		handler.serveWebSocket(writer, request, topics, after)
+		return
+	}
+	handler.serveEvents(writer, request, topics, after)
+}
+
+func (handler *Handler) keepAlive() time.Duration {
+	if handler.KeepAlive <= 0 {
+		return 30 * time.Second
+	}
+	return handler.KeepAlive
+}
+
+// serveEvents streams events as text/event-stream
+func (handler *Handler) serveEvents(writer http.ResponseWriter, request *http.Request, topics []string, after uint64) {
+	flusher, ok := writer.(http.Flusher)
+	if !ok {
+		http.Error(writer, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	header := writer.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	writer.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	subscription := handler.Feed.Subscribe(topics, after)
+	defer subscription.Close()
+
+	ticker := time.NewTicker(handler.keepAlive())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-request.Context().Done():
+			return
+		case <-ticker.C:
+			if _, err := fmt.Fprint(writer, ": keep alive\n\n"); err != nil {
+				return
+			}
+		case event, ok := <-subscription.Events:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(writer, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// serveWebSocket sends every event as a JSON text message
+func (handler *Handler) serveWebSocket(writer http.ResponseWriter, request *http.Request, topics []string, after uint64) {
+	conn, err := upgradeWebSocket(writer, request, handler.AllowOrigin)
+	if err != nil {
+		return
+	}
+	defer conn.close()
+
+	subscription := handler.Feed.Subscribe(topics, after)
+	defer subscription.Close()
+
+	// the read loop answers pings and notices when the browser goes away
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conn.readLoop()
+	}()
+
+	ticker := time.NewTicker(handler.keepAlive())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := conn.writeFrame(opPing, nil); err != nil {
+				return
+			}
+		case event, ok := <-subscription.Events:
+			if !ok {
+				conn.writeClose(closeGoingAway, "too slow")
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			if err := conn.writeFrame(opText, data); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func NewHandler(feed *Feed) *Handler {
+	return &Handler{
+		Feed:      feed,
+		KeepAlive: 30 * time.Second,
+	}
+}
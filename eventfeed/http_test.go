@@ -0,0 +1,265 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package eventfeed
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// waitForSubscribers waits until feed has n subscribers
+func waitForSubscribers(t *testing.T, feed *Feed, n int) {
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		feed.mutex.Lock()
+		count := len(feed.subscribers)
+		feed.mutex.Unlock()
+		if count == n {
+			return
+		}
+	}
+	t.Fatalf("feed did not get %d subscribers", n)
+}
+
+// readEvent reads the next event of an event stream, comments are skipped
+func readEvent(t *testing.T, reader *bufio.Reader) map[string]string {
+	event := make(map[string]string)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			if len(event) > 0 {
+				return event
+			}
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			event[":"] = line
+			continue
+		}
+		parts := strings.SplitN(line, ": ", 2)
+		event[parts[0]] = parts[1]
+	}
+}
+
+func TestServeEvents(t *testing.T) {
+	feed := New()
+	feed.Publish(TopicChat, TypeChatMessage, "first")
+	feed.Publish(TopicPlayers, TypePlayerJoined, "alice")
+	feed.Publish(TopicChat, TypeChatMessage, "second")
+
+	handler := NewHandler(feed)
+	handler.AllowOrigin = "https://admin.example.com"
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	request, _ := http.NewRequest("GET", server.URL+"/events?topics=chat&after=2", nil)
+	request.Header.Set("Last-Event-ID", "1")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	if response.Header.Get("Content-Type") != "text/event-stream" || response.Header.Get("Access-Control-Allow-Origin") != "https://admin.example.com" {
+		t.Errorf("headers %v", response.Header)
+	}
+
+	// Last-Event-ID wins over ?after=, players are not subscribed
+	reader := bufio.NewReader(response.Body)
+	event := readEvent(t, reader)
+	if event["id"] != "3" || event["event"] != TypeChatMessage {
+		t.Errorf("replayed %v", event)
+	}
+	var data Event
+	if err := json.Unmarshal([]byte(event["data"]), &data); err != nil || data.Data != "second" || data.Topic != TopicChat {
+		t.Errorf("data %s: %v", event["data"], err)
+	}
+
+	waitForSubscribers(t, feed, 1)
+	feed.Publish(TopicPlayers, TypePlayerLeft, "alice")
+	feed.Publish(TopicChat, TypeChatMessage, "third")
+	if event := readEvent(t, reader); event["id"] != "5" {
+		t.Errorf("streamed %v", event)
+	}
+
+	// the subscription ends with the request
+	response.Body.Close()
+	waitForSubscribers(t, feed, 0)
+}
+
+func TestServeEventsKeepAlive(t *testing.T) {
+	handler := NewHandler(New())
+	handler.KeepAlive = 10 * time.Millisecond
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	response, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	if event := readEvent(t, bufio.NewReader(response.Body)); event[":"] != ": keep alive" {
+		t.Errorf("got %v", event)
+	}
+}
+
+func TestServeEventsSlowSubscriber(t *testing.T) {
+	feed := New()
+	server := httptest.NewServer(NewHandler(feed))
+	defer server.Close()
+
+	response, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	waitForSubscribers(t, feed, 1)
+
+	// events are published faster than the stream is read, the stream ends
+	data := strings.Repeat("x", 32<<10)
+	for i := 0; i < 1000; i++ {
+		feed.Publish(TopicChat, TypeChatMessage, data)
+	}
+	reader := bufio.NewReader(response.Body)
+	count := 0
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			break
+		}
+		if strings.HasPrefix(line, "id: ") {
+			count++
+		}
+	}
+	if count == 0 || count >= 1000 {
+		t.Errorf("got %d events before the stream ended", count)
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	handler := NewHandler(New())
+	handler.Authorize = func(request *http.Request) bool {
+		return request.URL.Query().Get("token") == "secret"
+	}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "?token=wrong")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusUnauthorized {
+		t.Errorf("status %d, want %d", response.StatusCode, http.StatusUnauthorized)
+	}
+
+	_, _, response = dialWebSocket(t, server, "/?token=wrong", nil)
+	response.Body.Close()
+	if response.StatusCode != http.StatusUnauthorized {
+		t.Errorf("websocket status %d, want %d", response.StatusCode, http.StatusUnauthorized)
+	}
+}
+
+func TestServeWebSocket(t *testing.T) {
+	feed := New()
+	feed.Publish(TopicChat, TypeChatMessage, "first")
+	feed.Publish(TopicChat, TypeChatMessage, "second")
+	server := httptest.NewServer(NewHandler(feed))
+	defer server.Close()
+
+	conn, reader, response := dialWebSocket(t, server, "/?topics=chat,alerts&after=1", nil)
+	if response.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("status %d", response.StatusCode)
+	}
+
+	nextEvent := func() *Event {
+		opcode, payload, err := readServerFrame(reader)
+		if err != nil || opcode != opText {
+			t.Fatalf("read %d %q, %v", opcode, payload, err)
+		}
+		var event Event
+		if err := json.Unmarshal(payload, &event); err != nil {
+			t.Fatal(err)
+		}
+		return &event
+	}
+	if event := nextEvent(); event.ID != 2 || event.Data != "second" {
+		t.Errorf("replayed %+v", event)
+	}
+
+	waitForSubscribers(t, feed, 1)
+	feed.Publish(TopicGrids, TypeGridAdded, nil)
+	feed.Publish(TopicAlerts, TypeAlertRaised, nil)
+	if event := nextEvent(); event.ID != 4 || event.Type != TypeAlertRaised {
+		t.Errorf("streamed %+v", event)
+	}
+
+	conn.Write(clientFrame(true, opPing, []byte("are you there"), true))
+	if opcode, payload, err := readServerFrame(reader); err != nil || opcode != opPong || string(payload) != "are you there" {
+		t.Errorf("answered ping with %d %q, %v", opcode, payload, err)
+	}
+
+	// closing is answered and ends the subscription
+	conn.Write(clientFrame(true, opClose, []byte{0x03, 0xe8}, true))
+	if opcode, payload, err := readServerFrame(reader); err != nil || opcode != opClose || closeCode(payload) != closeNormal {
+		t.Errorf("answered close with %d %q, %v", opcode, payload, err)
+	}
+	waitForSubscribers(t, feed, 0)
+}
+
+func TestServeWebSocketSlowSubscriber(t *testing.T) {
+	feed := New()
+	server := httptest.NewServer(NewHandler(feed))
+	defer server.Close()
+
+	_, reader, response := dialWebSocket(t, server, "/", nil)
+	if response.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("status %d", response.StatusCode)
+	}
+	waitForSubscribers(t, feed, 1)
+
+	// nothing is read while the events are published, the subscriber falls behind
+	data := strings.Repeat("x", 32<<10)
+	for i := 0; i < 1000; i++ {
+		feed.Publish(TopicChat, TypeChatMessage, data)
+	}
+
+	count := 0
+	for {
+		opcode, payload, err := readServerFrame(reader)
+		if err != nil {
+			t.Fatalf("connection ended without a close frame after %d events: %v", count, err)
+		}
+		if opcode == opClose {
+			if closeCode(payload) != closeGoingAway || string(payload[2:]) != "too slow" {
+				t.Errorf("closed with %d %q", closeCode(payload), payload[2:])
+			}
+			break
+		}
+		count++
+	}
+	if count >= 1000 {
+		t.Errorf("got all %d events", count)
+	}
+	waitForSubscribers(t, feed, 0)
+}
@@ -0,0 +1,292 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package eventfeed
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// a minimal server side implementation of RFC 6455, just enough to push
+// messages and answer the control frames of browsers
+
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+const (
+	closeNormal        = 1000
+	closeGoingAway     = 1001
+	closeProtocolError = 1002
+	closeTooBig        = 1009
+)
+
+// browsers only send control frames and the occasional short message
+const maxMessageSize = 64 << 10
+
+type websocketConn struct {
+	conn       net.Conn
+	reader     *bufio.Reader
+	writeMutex sync.Mutex
+
+	// the fragmented message being read, only used by the read loop
+	messageOpcode byte
+	message       []byte
+}
+
+func isWebSocketUpgrade(request *http.Request) bool {
+	return headerContainsToken(request.Header, "Connection", "upgrade") &&
+		strings.EqualFold(request.Header.Get("Upgrade"), "websocket")
+}
+
+func headerContainsToken(header http.Header, name string, token string) bool {
+	for _, value := range header[http.CanonicalHeaderKey(name)] {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkOrigin guards against cross-site WebSocket hijacking, browsers do not
+// apply CORS to upgrades, so any page could open one with the cookies of the
+// user. Requests without an Origin do not come from a browser.
+func checkOrigin(request *http.Request, allowOrigin string) bool {
+	origin := request.Header.Get("Origin")
+	if origin == "" || allowOrigin == "*" || strings.EqualFold(origin, allowOrigin) {
+		return true
+	}
+	parsed, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(parsed.Host, request.Host)
+}
+
+func upgradeWebSocket(writer http.ResponseWriter, request *http.Request, allowOrigin string) (*websocketConn, error) {
+	if request.Method != http.MethodGet {
+		http.Error(writer, "websocket upgrade requires GET", http.StatusMethodNotAllowed)
+		return nil, errors.New("websocket upgrade requires GET")
+	}
+	if !checkOrigin(request, allowOrigin) {
+		http.Error(writer, "origin not allowed", http.StatusForbidden)
+		return nil, errors.New("origin not allowed")
+	}
+	if request.Header.Get("Sec-WebSocket-Version") != "13" {
+		writer.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(writer, "unsupported websocket version", http.StatusUpgradeRequired)
+		return nil, errors.New("unsupported websocket version")
+	}
+	key := request.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		http.Error(writer, "missing Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, errors.New("missing Sec-WebSocket-Key")
+	}
+
+	hijacker, ok := writer.(http.Hijacker)
+	if !ok {
+		http.Error(writer, "websocket not supported", http.StatusInternalServerError)
+		return nil, errors.New("response writer can not be hijacked")
+	}
+	conn, buffer, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha1.Sum([]byte(key + websocketGUID))
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(hash[:]) + "\r\n\r\n"
+	if _, err := conn.Write([]byte(response)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &websocketConn{conn: conn, reader: buffer.Reader}, nil
+}
+
+func (ws *websocketConn) writeFrame(opcode byte, payload []byte) error {
+	ws.writeMutex.Lock()
+	defer ws.writeMutex.Unlock()
+
+	// servers never mask, every message fits into a single final frame
+	header := []byte{0x80 | opcode}
+	switch {
+	case len(payload) < 126:
+		header = append(header, byte(len(payload)))
+	case len(payload) <= 0xffff:
+		header = append(header, 126, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(len(payload)))
+	default:
+		header = append(header, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(len(payload)))
+	}
+
+	ws.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if _, err := ws.conn.Write(header); err != nil {
+		return err
+	}
+	_, err := ws.conn.Write(payload)
+	return err
+}
+
+func (ws *websocketConn) writeClose(code uint16, reason string) error {
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, code)
+	return ws.writeFrame(opClose, append(payload, reason...))
+}
+
+// protocolError closes the connection with a protocol error and returns the reason
+func (ws *websocketConn) protocolError(reason string) error {
+	ws.writeClose(closeProtocolError, reason)
+	return errors.New("websocket " + reason)
+}
+
+// readMessage returns the next control frame or the next complete data message.
+// Fragments are joined, control frames sent between them are returned on their own.
+func (ws *websocketConn) readMessage() (byte, []byte, error) {
+	for {
+		fin, opcode, payload, err := ws.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch opcode {
+		case opClose, opPing, opPong:
+			if !fin || len(payload) > 125 {
+				return 0, nil, ws.protocolError("invalid control frame")
+			}
+			return opcode, payload, nil
+		case opText, opBinary:
+			if ws.messageOpcode != 0 {
+				return 0, nil, ws.protocolError("message started before the last one ended")
+			}
+			ws.messageOpcode = opcode
+		case opContinuation:
+			if ws.messageOpcode == 0 {
+				return 0, nil, ws.protocolError("continuation frame without a message")
+			}
+		default:
+			return 0, nil, ws.protocolError("unknown opcode")
+		}
+
+		if len(ws.message)+len(payload) > maxMessageSize {
+			ws.writeClose(closeTooBig, "message too large")
+			return 0, nil, errors.New("websocket message too large")
+		}
+		ws.message = append(ws.message, payload...)
+		if fin {
+			opcode, message := ws.messageOpcode, ws.message
+			ws.messageOpcode, ws.message = 0, nil
+			return opcode, message, nil
+		}
+	}
+}
+
+// readFrame returns the FIN bit, the opcode and the unmasked payload of the next frame
+func (ws *websocketConn) readFrame() (bool, byte, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(ws.reader, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin := header[0]&0x80 != 0
+	opcode := header[0] & 0x0f
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7f)
+
+	// no extensions are negotiated, so the reserved bits must be clear
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, ws.protocolError("reserved bits set")
+	}
+
+	switch length {
+	case 126:
+		var extended [2]byte
+		if _, err := io.ReadFull(ws.reader, extended[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		if _, err := io.ReadFull(ws.reader, extended[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(extended[:])
+	}
+	if length > maxMessageSize {
+		ws.writeClose(closeTooBig, "frame too large")
+		return false, 0, nil, errors.New("websocket frame too large")
+	}
+	if !masked {
+		return false, 0, nil, ws.protocolError("client frame is not masked")
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(ws.reader, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(ws.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+// readLoop answers control frames until the connection is closed, messages from
+// the client are ignored
+func (ws *websocketConn) readLoop() {
+	for {
+		opcode, payload, err := ws.readMessage()
+		if err != nil {
+			return
+		}
+		switch opcode {
+		case opPing:
+			if ws.writeFrame(opPong, payload) != nil {
+				return
+			}
+		case opClose:
+			ws.writeClose(closeNormal, "")
+			return
+		}
+	}
+}
+
+func (ws *websocketConn) close() error {
+	return ws.conn.Close()
+}
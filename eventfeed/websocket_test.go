@@ -0,0 +1,321 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package eventfeed
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clientFrame builds a frame the way a browser sends it
+func clientFrame(fin bool, opcode byte, payload []byte, masked bool) []byte {
+	first := opcode
+	if fin {
+		first |= 0x80
+	}
+	frame := []byte{first}
+	var maskBit byte
+	if masked {
+		maskBit = 0x80
+	}
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, maskBit|byte(len(payload)))
+	default:
+		frame = append(frame, maskBit|126, 0, 0)
+		binary.BigEndian.PutUint16(frame[2:], uint16(len(payload)))
+	}
+	if !masked {
+		return append(frame, payload...)
+	}
+	mask := []byte{1, 2, 3, 4}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	return frame
+}
+
+// readServerFrame reads an unmasked frame sent by the server
+func readServerFrame(reader *bufio.Reader) (byte, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(reader, header[:]); err != nil {
+		return 0, nil, err
+	}
+	length := int(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var extended [2]byte
+		if _, err := io.ReadFull(reader, extended[:]); err != nil {
+			return 0, nil, err
+		}
+		length = int(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		if _, err := io.ReadFull(reader, extended[:]); err != nil {
+			return 0, nil, err
+		}
+		length = int(binary.BigEndian.Uint64(extended[:]))
+	}
+	payload := make([]byte, length)
+	_, err := io.ReadFull(reader, payload)
+	return header[0] & 0x0f, payload, err
+}
+
+func closeCode(payload []byte) uint16 {
+	if len(payload) < 2 {
+		return 0
+	}
+	return binary.BigEndian.Uint16(payload)
+}
+
+func TestCheckOrigin(t *testing.T) {
+	tests := []struct {
+		origin      string
+		allowOrigin string
+		ok          bool
+	}{
+		{"", "", true},
+		{"https://admin.example.com", "", true},
+		{"https://ADMIN.example.com", "", true},
+		{"https://evil.example.com", "", false},
+		{"https://evil.example.com", "https://other.example.com", false},
+		{"https://other.example.com", "https://other.example.com", true},
+		{"https://evil.example.com", "*", true},
+		{"null", "", false},
+		{"://", "", false},
+	}
+	for _, test := range tests {
+		request := httptest.NewRequest("GET", "http://admin.example.com/events", nil)
+		if test.origin != "" {
+			request.Header.Set("Origin", test.origin)
+		}
+		if got := checkOrigin(request, test.allowOrigin); got != test.ok {
+			t.Errorf("checkOrigin(%q, %q) = %t, want %t", test.origin, test.allowOrigin, got, test.ok)
+		}
+	}
+}
+
+func TestReadMessage(t *testing.T) {
+	big := bytes.Repeat([]byte("x"), 40<<10)
+	tests := []struct {
+		name   string
+		frames [][]byte
+		want   []string // opcode and payload of every message read
+		close  uint16   // close code sent after the messages, 0 if none
+	}{
+		{
+			"single frame",
+			[][]byte{clientFrame(true, opText, []byte("hello"), true)},
+			[]string{"1 hello"},
+			0,
+		},
+		{
+			"fragments with a ping in between",
+			[][]byte{
+				clientFrame(false, opText, []byte("hel"), true),
+				clientFrame(true, opPing, []byte("ping"), true),
+				clientFrame(false, opContinuation, []byte("l"), true),
+				clientFrame(true, opContinuation, []byte("o"), true),
+				clientFrame(true, opBinary, []byte("next"), true),
+			},
+			[]string{"9 ping", "1 hello", "2 next"},
+			0,
+		},
+		{
+			"continuation without a message",
+			[][]byte{clientFrame(true, opContinuation, []byte("lo"), true)},
+			nil,
+			closeProtocolError,
+		},
+		{
+			"message before the last one ended",
+			[][]byte{clientFrame(false, opText, []byte("hel"), true), clientFrame(true, opText, []byte("lo"), true)},
+			nil,
+			closeProtocolError,
+		},
+		{
+			"fragmented ping",
+			[][]byte{clientFrame(false, opPing, nil, true)},
+			nil,
+			closeProtocolError,
+		},
+		{
+			"long ping",
+			[][]byte{clientFrame(true, opPing, bytes.Repeat([]byte("x"), 126), true)},
+			nil,
+			closeProtocolError,
+		},
+		{
+			"unmasked",
+			[][]byte{clientFrame(true, opText, []byte("hello"), false)},
+			nil,
+			closeProtocolError,
+		},
+		{
+			"reserved bits",
+			[][]byte{append([]byte{0xc1}, clientFrame(true, opText, nil, true)[1:]...)},
+			nil,
+			closeProtocolError,
+		},
+		{
+			"unknown opcode",
+			[][]byte{clientFrame(true, 0x3, nil, true)},
+			nil,
+			closeProtocolError,
+		},
+		{
+			"message too large",
+			[][]byte{clientFrame(false, opText, big, true), clientFrame(true, opContinuation, big, true)},
+			nil,
+			closeTooBig,
+		},
+	}
+
+	for _, test := range tests {
+		server, client := net.Pipe()
+		ws := &websocketConn{conn: server, reader: bufio.NewReader(server)}
+		go func(frames [][]byte) {
+			for _, frame := range frames {
+				if _, err := client.Write(frame); err != nil {
+					return
+				}
+			}
+		}(test.frames)
+
+		type message struct {
+			text string
+			err  error
+		}
+		messages := make(chan message)
+		go func(count int) {
+			for i := 0; i <= count; i++ {
+				opcode, payload, err := ws.readMessage()
+				messages <- message{string(rune('0'+opcode)) + " " + string(payload), err}
+				if err != nil {
+					return
+				}
+			}
+		}(len(test.want))
+
+		for i, want := range test.want {
+			if got := <-messages; got.err != nil || got.text != want {
+				t.Errorf("%s: message %d = %q, %v, want %q", test.name, i, got.text, got.err, want)
+			}
+		}
+		if test.close != 0 {
+			opcode, payload, err := readServerFrame(bufio.NewReader(client))
+			if err != nil || opcode != opClose || closeCode(payload) != test.close {
+				t.Errorf("%s: server sent %d %q, %v, want close %d", test.name, opcode, payload, err, test.close)
+			}
+			if got := <-messages; got.err == nil {
+				t.Errorf("%s: read %q, want an error", test.name, got.text)
+			}
+		}
+		client.Close()
+		server.Close()
+	}
+}
+
+func TestWriteFrame(t *testing.T) {
+	for _, size := range []int{0, 125, 126, 0xffff, 0x10000} {
+		server, client := net.Pipe()
+		ws := &websocketConn{conn: server, reader: bufio.NewReader(server)}
+		payload := bytes.Repeat([]byte("x"), size)
+		go ws.writeFrame(opText, payload)
+
+		opcode, got, err := readServerFrame(bufio.NewReader(client))
+		if err != nil || opcode != opText || !bytes.Equal(got, payload) {
+			t.Errorf("frame of %d bytes read back as %d bytes, %v", size, len(got), err)
+		}
+		client.Close()
+		server.Close()
+	}
+}
+
+// dialWebSocket opens a WebSocket to server the way a browser does
+func dialWebSocket(t *testing.T, server *httptest.Server, path string, header http.Header) (net.Conn, *bufio.Reader, *http.Response) {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	request, _ := http.NewRequest("GET", server.URL+path, nil)
+	request.Header.Set("Connection", "keep-alive, Upgrade")
+	request.Header.Set("Upgrade", "websocket")
+	request.Header.Set("Sec-WebSocket-Version", "13")
+	request.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	for name, values := range header {
+		request.Header[name] = values
+	}
+	if err := request.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, reader, response
+}
+
+func TestWebSocketHandshake(t *testing.T) {
+	handler := NewHandler(New())
+	handler.AllowOrigin = "https://other.example.com"
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		header http.Header
+		status int
+	}{
+		{"browser on the same host", http.Header{"Origin": {server.URL}}, http.StatusSwitchingProtocols},
+		{"allowed origin", http.Header{"Origin": {"https://other.example.com"}}, http.StatusSwitchingProtocols},
+		{"no origin", nil, http.StatusSwitchingProtocols},
+		{"foreign origin", http.Header{"Origin": {"https://evil.example.com"}}, http.StatusForbidden},
+		{"old version", http.Header{"Sec-Websocket-Version": {"8"}}, http.StatusUpgradeRequired},
+		{"missing key", http.Header{"Sec-Websocket-Key": {""}}, http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		_, _, response := dialWebSocket(t, server, "/events", test.header)
+		response.Body.Close()
+		if response.StatusCode != test.status {
+			t.Errorf("%s: status %d, want %d", test.name, response.StatusCode, test.status)
+			continue
+		}
+		if test.status != http.StatusSwitchingProtocols {
+			continue
+		}
+		// the accept key of the example in RFC 6455
+		if accept := response.Header.Get("Sec-WebSocket-Accept"); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+			t.Errorf("%s: Sec-WebSocket-Accept %q", test.name, accept)
+		}
+		if !strings.EqualFold(response.Header.Get("Upgrade"), "websocket") {
+			t.Errorf("%s: Upgrade %q", test.name, response.Header.Get("Upgrade"))
+		}
+	}
+}
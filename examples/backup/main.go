@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"gopkg.in/uranoxyd/govrageremote.v2"
+	"gopkg.in/uranoxyd/govrageremote.v2/config"
+)
+
+func main() {
+	// the server is taken from the default profile of the config file or VRAGE_ADDRESS and VRAGE_KEY
+	client, err := config.Client()
+	if err != nil {
+		panic(err)
+	}
+
+	manager, err := govrageremote.NewVRageBackupManager(client, "backups.json", govrageremote.VRageBackupRetention{Hourly: 24, Daily: 7})
+	if err != nil {
+		panic(err)
+	}
+
+	for range time.Tick(time.Hour) {
+		backup, err := manager.Backup()
+		if err != nil {
+			fmt.Println("backup failed:", err)
+			continue
+		}
+		fmt.Println("created backup", backup.Name)
+
+		for _, expired := range manager.Expired() {
+			fmt.Println("backup can be removed:", expired.Name)
+		}
+	}
+}
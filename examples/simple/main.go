@@ -3,11 +3,15 @@ package main
 import (
 	"fmt"
 
-	"gopkg.in/uranoxyd/govrageremote.v1"
+	"gopkg.in/uranoxyd/govrageremote.v2/config"
 )
 
 func main() {
-	client := govrageremote.NewVRageRemoteClient("http://localhost:8080", "RTOLNUrsQ2ZUW1ZDYqkKwA==")
+	// the server is taken from the default profile of the config file or VRAGE_ADDRESS and VRAGE_KEY
+	client, err := config.Client()
+	if err != nil {
+		panic(err)
+	}
 
 	response, err := client.GetServerInfo()
 	if err != nil {
@@ -1,18 +1,32 @@
 package main
 
 import (
-	"gopkg.in/uranoxyd/govrageremote.v1"
+	"context"
+	"fmt"
+
+	"gopkg.in/uranoxyd/govrageremote.v2"
+	"gopkg.in/uranoxyd/govrageremote.v2/config"
 )
 
 func main() {
-	client := govrageremote.NewVRageRemoteClient("http://localhost:8080", "RTOLNUrsQ2ZUW1ZDYqkKwA==")
+	// the server is taken from the default profile of the config file or VRAGE_ADDRESS and VRAGE_KEY
+	client, err := config.Client()
+	if err != nil {
+		panic(err)
+	}
 
 	response, err := client.GetFloatingObjects()
 	if err != nil {
 		panic(err)
 	}
 
+	var ids []govrageremote.EntityID
 	for _, floating := range response.Data.FloatingObjects {
-		floating.Stop()
+		ids = append(ids, floating.EntityID)
+	}
+
+	_, err = client.StopFloatingObjects(context.Background(), ids, &govrageremote.VRageBulkOptions{Concurrency: 4})
+	if err != nil {
+		fmt.Println(err)
 	}
 }
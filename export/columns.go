@@ -0,0 +1,216 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package export
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+
+	"gopkg.in/uranoxyd/govrageremote.v2"
+)
+
+// Column is one value written per entity
+type Column struct {
+	Name  string
+	Value func(entity interface{}) (interface{}, error)
+}
+
+// Field returns a column for a possibly nested field like "Position.X", names are
+// matched case insensitive
+func Field(path string) Column {
+	names := strings.Split(path, ".")
+	return Column{
+		Name: path,
+		Value: func(entity interface{}) (interface{}, error) {
+			value := reflect.ValueOf(entity)
+			for _, name := range names {
+				for value.Kind() == reflect.Ptr {
+					if value.IsNil() {
+						return nil, nil
+					}
+					value = value.Elem()
+				}
+				if value.Kind() != reflect.Struct {
+					return nil, fmt.Errorf("%s has no field %s", value.Type(), name)
+				}
+				field, ok := fieldByName(value, name)
+				if !ok {
+					return nil, fmt.Errorf("%s has no field %s", value.Type(), name)
+				}
+				value = field
+			}
+			return value.Interface(), nil
+		},
+	}
+}
+
+func fieldByName(value reflect.Value, name string) (reflect.Value, bool) {
+	for i := 0; i < value.NumField(); i++ {
+		structField := value.Type().Field(i)
+		if structField.PkgPath == "" && strings.EqualFold(structField.Name, name) {
+			return value.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// Computed returns a column whose value is calculated by fnc
+func Computed(name string, fnc func(entity interface{}) (interface{}, error)) Column {
+	return Column{Name: name, Value: fnc}
+}
+
+// nearest returns the target closest to entity and the distance to it
+func nearest(entity interface{}, targets []govrageremote.VRagePositionable) (govrageremote.VRagePositionable, float64, bool) {
+	positionable, ok := entity.(govrageremote.VRagePositionable)
+	if !ok {
+		return nil, 0, false
+	}
+	var closest govrageremote.VRagePositionable
+	distance := math.Inf(1)
+	for _, target := range targets {
+		if target == entity {
+			continue
+		}
+		if d := govrageremote.Distance(positionable, target); d < distance {
+			closest = target
+			distance = d
+		}
+	}
+	return closest, distance, closest != nil
+}
+
+// DistanceToNearest returns a column with the distance from each entity to the
+// closest of targets, empty if there is no target
+func DistanceToNearest(name string, targets []govrageremote.VRagePositionable) Column {
+	return Computed(name, func(entity interface{}) (interface{}, error) {
+		_, distance, ok := nearest(entity, targets)
+		if !ok {
+			return nil, nil
+		}
+		return distance, nil
+	})
+}
+
+// NameOfNearest returns a column with the display name of the closest of targets
+func NameOfNearest(name string, targets []govrageremote.VRagePositionable) Column {
+	return Computed(name, func(entity interface{}) (interface{}, error) {
+		target, _, ok := nearest(entity, targets)
+		if !ok {
+			return nil, nil
+		}
+		return Field("DisplayName").Value(target)
+	})
+}
+
+// PlayerColumns returns the computed columns NearestPlayerDistance and
+// NearestPlayer. Players have no position in the Remote API, so the characters
+// stand in for them.
+func PlayerColumns(characters []*govrageremote.VRageRemoteCharacter) map[string]Column {
+	targets := make([]govrageremote.VRagePositionable, len(characters))
+	for i, character := range characters {
+		targets[i] = character
+	}
+	return map[string]Column{
+		"NearestPlayerDistance": DistanceToNearest("NearestPlayerDistance", targets),
+		"NearestPlayer":         NameOfNearest("NearestPlayer", targets),
+	}
+}
+
+// DefaultColumns returns a column for every exported field of the entity type,
+// nested structs like Position are flattened into Position.X, Position.Y, ...
+func DefaultColumns(entity interface{}) []Column {
+	t := reflect.TypeOf(entity)
+	for t != nil && (t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice) {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+	var columns []Column
+	addFieldColumns(t, "", &columns)
+	return columns
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func addFieldColumns(t reflect.Type, prefix string, columns *[]Column) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		switch field.Type.Kind() {
+		case reflect.Map, reflect.Slice, reflect.Ptr, reflect.Interface, reflect.Func, reflect.Chan:
+			continue
+		case reflect.Struct:
+			if field.Type != timeType {
+				addFieldColumns(field.Type, prefix+field.Name+".", columns)
+				continue
+			}
+		}
+		*columns = append(*columns, Field(prefix+field.Name))
+	}
+}
+
+// ParseColumns turns a comma separated list of field paths and computed column
+// names into columns, an empty spec selects the default columns of entity
+func ParseColumns(spec string, entity interface{}, computed map[string]Column) ([]Column, error) {
+	if strings.TrimSpace(spec) == "" {
+		return DefaultColumns(entity), nil
+	}
+
+	var columns []Column
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if column, ok := computed[name]; ok {
+			columns = append(columns, column)
+			continue
+		}
+		column := Field(name)
+		if sample := sampleOf(entity); sample != nil {
+			if _, err := column.Value(sample); err != nil {
+				return nil, err
+			}
+		}
+		columns = append(columns, column)
+	}
+	if len(columns) == 0 {
+		return nil, errors.New("no columns selected")
+	}
+	return columns, nil
+}
+
+// sampleOf returns a zero entity of the element type, so column names can be
+// checked before any data was fetched
+func sampleOf(entity interface{}) interface{} {
+	t := reflect.TypeOf(entity)
+	for t != nil && t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if t == nil {
+		return nil
+	}
+	if t.Kind() == reflect.Ptr {
+		return reflect.New(t.Elem()).Interface()
+	}
+	return reflect.New(t).Elem().Interface()
+}
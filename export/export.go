@@ -0,0 +1,256 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package export writes entity lists like grids and players to CSV, JSON Lines
+// and a GeoJSON like feature collection with 3D points, for analysis in
+// spreadsheets and GIS tools. Columns are either fields of the entity or
+// computed, like the distance to the nearest player. Text cells of the CSV
+// starting with =, +, -, @, tab or carriage return get a ' prefix, so
+// spreadsheets do not run them as formulas.
+//
+//	columns, _ := export.ParseColumns("DisplayName,PCU,NearestPlayerDistance", grids, export.PlayerColumns(characters))
+//	export.Write(os.Stdout, export.CSV, columns, grids)
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/uranoxyd/govrageremote.v2"
+)
+
+type Format string
+
+const (
+	CSV     Format = "csv"
+	JSONL   Format = "jsonl"
+	GeoJSON Format = "geojson"
+)
+
+func ParseFormat(text string) (Format, error) {
+	switch format := Format(text); format {
+	case CSV, JSONL, GeoJSON:
+		return format, nil
+	}
+	return "", errors.New("unknown format " + text + ", use csv, jsonl or geojson")
+}
+
+// Write writes entities, a slice of any entity type, in format
+func Write(writer io.Writer, format Format, columns []Column, entities interface{}) error {
+	list := reflect.ValueOf(entities)
+	if list.Kind() != reflect.Slice {
+		return fmt.Errorf("entities must be a slice, got %T", entities)
+	}
+
+	switch format {
+	case CSV:
+		return writeCSV(writer, columns, list)
+	case JSONL:
+		return writeJSONL(writer, columns, list)
+	case GeoJSON:
+		return writeGeoJSON(writer, columns, list)
+	}
+	return errors.New("unknown format " + string(format))
+}
+
+func row(columns []Column, entity interface{}) ([]interface{}, error) {
+	values := make([]interface{}, len(columns))
+	for i, column := range columns {
+		value, err := column.Value(entity)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %v", column.Name, err)
+		}
+		values[i] = normalize(value)
+	}
+	return values, nil
+}
+
+// normalize converts values into what spreadsheets and JSON readers expect
+func normalize(value interface{}) interface{} {
+	switch value := value.(type) {
+	case govrageremote.DotNetTicks:
+		return value.Time().UTC().Format(time.RFC3339)
+	case time.Time:
+		return value.UTC().Format(time.RFC3339)
+	case float64:
+		if math.IsInf(value, 0) || math.IsNaN(value) {
+			return nil
+		}
+	}
+	return value
+}
+
+// escapeFormula keeps spreadsheets from running text as a formula, player and
+// grid names are chosen by the players. Numbers are written unescaped, so
+// negative ones stay numbers.
+func escapeFormula(text string) string {
+	if text != "" && strings.ContainsRune("=+-@\t\r", rune(text[0])) {
+		return "'" + text
+	}
+	return text
+}
+
+func formatCSV(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return escapeFormula(value)
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(value), 'f', -1, 32)
+	case fmt.Stringer:
+		// ids are numbers with a String method, a negative entity id is no formula
+		if isNumber(value) {
+			return value.String()
+		}
+		return escapeFormula(value.String())
+	}
+	return fmt.Sprint(value)
+}
+
+func isNumber(value interface{}) bool {
+	switch reflect.ValueOf(value).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func writeCSV(writer io.Writer, columns []Column, list reflect.Value) error {
+	csvWriter := csv.NewWriter(writer)
+
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = column.Name
+	}
+	if err := csvWriter.Write(header); err != nil {
+		return err
+	}
+
+	record := make([]string, len(columns))
+	for i := 0; i < list.Len(); i++ {
+		values, err := row(columns, list.Index(i).Interface())
+		if err != nil {
+			return err
+		}
+		for j, value := range values {
+			record[j] = formatCSV(value)
+		}
+		if err := csvWriter.Write(record); err != nil {
+			return err
+		}
+	}
+
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+// object encodes the values as a JSON object keeping the order of the columns
+func object(columns []Column, values []interface{}) ([]byte, error) {
+	var buffer bytes.Buffer
+	buffer.WriteByte('{')
+	for i, column := range columns {
+		if i > 0 {
+			buffer.WriteByte(',')
+		}
+		name, err := json.Marshal(column.Name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(values[i])
+		if err != nil {
+			return nil, err
+		}
+		buffer.Write(name)
+		buffer.WriteByte(':')
+		buffer.Write(value)
+	}
+	buffer.WriteByte('}')
+	return buffer.Bytes(), nil
+}
+
+func writeJSONL(writer io.Writer, columns []Column, list reflect.Value) error {
+	for i := 0; i < list.Len(); i++ {
+		values, err := row(columns, list.Index(i).Interface())
+		if err != nil {
+			return err
+		}
+		line, err := object(columns, values)
+		if err != nil {
+			return err
+		}
+		if _, err := writer.Write(append(line, '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeGeoJSON writes a FeatureCollection of Point features with the world
+// coordinates as [x, y, z] and the columns as properties. Entities without a
+// position are skipped.
+func writeGeoJSON(writer io.Writer, columns []Column, list reflect.Value) error {
+	if _, err := io.WriteString(writer, `{"type":"FeatureCollection","features":[`); err != nil {
+		return err
+	}
+
+	first := true
+	for i := 0; i < list.Len(); i++ {
+		entity := list.Index(i).Interface()
+		positionable, ok := entity.(govrageremote.VRagePositionable)
+		if !ok {
+			continue
+		}
+		values, err := row(columns, entity)
+		if err != nil {
+			return err
+		}
+		properties, err := object(columns, values)
+		if err != nil {
+			return err
+		}
+
+		position := positionable.GetPosition()
+		separator := ","
+		if first {
+			separator = ""
+			first = false
+		}
+		_, err = fmt.Fprintf(writer, `%s{"type":"Feature","geometry":{"type":"Point","coordinates":[%s,%s,%s]},"properties":%s}`+"\n",
+			separator,
+			strconv.FormatFloat(position.X, 'f', -1, 64),
+			strconv.FormatFloat(position.Y, 'f', -1, 64),
+			strconv.FormatFloat(position.Z, 'f', -1, 64),
+			properties)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := io.WriteString(writer, "]}\n")
+	return err
+}
@@ -0,0 +1,250 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+
+	"gopkg.in/uranoxyd/govrageremote.v2"
+)
+
+func testGrids() []*govrageremote.VRageRemoteGrid {
+	return []*govrageremote.VRageRemoteGrid{
+		{DisplayName: "Miner", EntityID: 1, Position: govrageremote.VRagePosition{X: 10, Y: -20.5, Z: 0}, PCU: 500},
+		{DisplayName: `=HYPERLINK("http://evil")`, EntityID: -42, Position: govrageremote.VRagePosition{X: -1, Y: 2, Z: 3}, PCU: -1},
+	}
+}
+
+func testCharacters() []*govrageremote.VRageRemoteCharacter {
+	return []*govrageremote.VRageRemoteCharacter{
+		{DisplayName: "alice", Position: govrageremote.VRagePosition{X: 10, Y: -20.5, Z: 3}},
+	}
+}
+
+// label is a text value with a String method
+type label string
+
+func (l label) String() string {
+	return string(l)
+}
+
+func TestEscapeFormula(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"", ""},
+		{"Miner", "Miner"},
+		{"=1+1", "'=1+1"},
+		{"+1", "'+1"},
+		{"-1", "'-1"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\tcmd", "'\tcmd"},
+		{"\rcmd", "'\rcmd"},
+		{"a=1", "a=1"},
+		{"'quoted", "'quoted"},
+	}
+	for _, test := range tests {
+		if got := escapeFormula(test.text); got != test.want {
+			t.Errorf("escapeFormula(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestFormatCSV(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  string
+	}{
+		{nil, ""},
+		{"-1", "'-1"},
+		{label("=cmd"), "'=cmd"},
+		{label("plain"), "plain"},
+		// negative numbers stay numbers, whether or not they have a String method
+		{-1.5, "-1.5"},
+		{float32(-0.25), "-0.25"},
+		{int64(-3), "-3"},
+		{govrageremote.EntityID(-42), "-42"},
+		{govrageremote.SteamID(76561197960287930), "76561197960287930"},
+		{true, "true"},
+		{1e21, "1000000000000000000000"},
+	}
+	for _, test := range tests {
+		if got := formatCSV(test.value); got != test.want {
+			t.Errorf("formatCSV(%#v) = %q, want %q", test.value, got, test.want)
+		}
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	grids := testGrids()
+	columns, err := ParseColumns("DisplayName, EntityID,position.y,PCU,NearestPlayerDistance,NearestPlayer", grids, PlayerColumns(testCharacters()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buffer bytes.Buffer
+	if err := Write(&buffer, CSV, columns, grids); err != nil {
+		t.Fatal(err)
+	}
+	want := `DisplayName,EntityID,position.y,PCU,NearestPlayerDistance,NearestPlayer
+Miner,1,-20.5,500,3,alice
+"'=HYPERLINK(""http://evil"")",-42,2,-1,` + formatCSV(math.Sqrt(11*11+22.5*22.5)) + `,alice
+`
+	if buffer.String() != want {
+		t.Errorf("wrote\n%s\nwant\n%s", buffer.String(), want)
+	}
+}
+
+func TestWriteJSONL(t *testing.T) {
+	grids := testGrids()
+	grids[0].Mass = math.NaN()
+	columns := []Column{
+		Field("DisplayName"),
+		Field("EntityID"),
+		Field("Mass"),
+		Computed("Time", func(entity interface{}) (interface{}, error) {
+			return govrageremote.DotNetTicks(637765920000000000), nil
+		}),
+	}
+
+	var buffer bytes.Buffer
+	if err := Write(&buffer, JSONL, columns, grids); err != nil {
+		t.Fatal(err)
+	}
+	// the columns keep their order, NaN becomes null and ids are strings
+	want := `{"DisplayName":"Miner","EntityID":"1","Mass":null,"Time":"2022-01-01T00:00:00Z"}
+{"DisplayName":"=HYPERLINK(\"http://evil\")","EntityID":"-42","Mass":0,"Time":"2022-01-01T00:00:00Z"}
+`
+	if buffer.String() != want {
+		t.Errorf("wrote\n%s\nwant\n%s", buffer.String(), want)
+	}
+}
+
+func TestWriteGeoJSON(t *testing.T) {
+	// players have no position and are skipped
+	entities := []interface{}{
+		testGrids()[1],
+		&govrageremote.VRageRemotePlayer{DisplayName: "bob"},
+		testCharacters()[0],
+	}
+	var buffer bytes.Buffer
+	if err := Write(&buffer, GeoJSON, []Column{Field("DisplayName")}, entities); err != nil {
+		t.Fatal(err)
+	}
+
+	var collection struct {
+		Type     string
+		Features []struct {
+			Type     string
+			Geometry struct {
+				Type        string
+				Coordinates []float64
+			}
+			Properties map[string]interface{}
+		}
+	}
+	if err := json.Unmarshal(buffer.Bytes(), &collection); err != nil {
+		t.Fatalf("%v in\n%s", err, buffer.String())
+	}
+	if collection.Type != "FeatureCollection" || len(collection.Features) != 2 {
+		t.Fatalf("wrote\n%s", buffer.String())
+	}
+	first, second := collection.Features[0], collection.Features[1]
+	if first.Type != "Feature" || first.Geometry.Type != "Point" || first.Properties["DisplayName"] != `=HYPERLINK("http://evil")` {
+		t.Errorf("first feature %+v", first)
+	}
+	if c := first.Geometry.Coordinates; len(c) != 3 || c[0] != -1 || c[1] != 2 || c[2] != 3 {
+		t.Errorf("first coordinates %v", c)
+	}
+	if c := second.Geometry.Coordinates; len(c) != 3 || c[1] != -20.5 || second.Properties["DisplayName"] != "alice" {
+		t.Errorf("second feature %+v", second)
+	}
+
+	buffer.Reset()
+	if err := Write(&buffer, GeoJSON, nil, []*govrageremote.VRageRemotePlayer{}); err != nil || buffer.String() != `{"type":"FeatureCollection","features":[]}`+"\n" {
+		t.Errorf("empty collection %q, %v", buffer.String(), err)
+	}
+}
+
+func TestWriteErrors(t *testing.T) {
+	if err := Write(&bytes.Buffer{}, CSV, nil, testGrids()[0]); err == nil {
+		t.Error("wrote a single entity")
+	}
+	if err := Write(&bytes.Buffer{}, Format("xml"), nil, testGrids()); err == nil {
+		t.Error("wrote an unknown format")
+	}
+	if err := Write(&bytes.Buffer{}, CSV, []Column{Field("Owner")}, testGrids()); err == nil || !strings.Contains(err.Error(), "column Owner") {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestParseColumns(t *testing.T) {
+	computed := PlayerColumns(nil)
+	tests := []struct {
+		spec  string
+		names string // empty if the spec is rejected
+	}{
+		{"DisplayName,PCU", "DisplayName,PCU"},
+		{" displayname , Position.X ,, ", "displayname,Position.X"},
+		{"NearestPlayer,DisplayName", "NearestPlayer,DisplayName"},
+		{"", "DisplayName,EntityID,GridSize,BlocksCount,Mass,Position.X,Position.Y,Position.Z,LinearSpeed,DistanceToPlayer,OwnerSteamID,OwnerDisplayName,IsPowered,PCU"},
+		{"Owner", ""},
+		{"Position.W", ""},
+		{"PCU.Value", ""},
+		{",,", ""},
+	}
+	for _, test := range tests {
+		columns, err := ParseColumns(test.spec, []*govrageremote.VRageRemoteGrid{}, computed)
+		if test.names == "" {
+			if err == nil {
+				t.Errorf("ParseColumns(%q) accepted", test.spec)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseColumns(%q): %v", test.spec, err)
+			continue
+		}
+		var names []string
+		for _, column := range columns {
+			names = append(names, column.Name)
+		}
+		if got := strings.Join(names, ","); got != test.names {
+			t.Errorf("ParseColumns(%q) = %s, want %s", test.spec, got, test.names)
+		}
+	}
+
+	// without characters the computed columns are empty
+	grid := testGrids()[0]
+	if value, err := computed["NearestPlayerDistance"].Value(grid); value != nil || err != nil {
+		t.Errorf("distance to nobody %v, %v", value, err)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for _, text := range []string{"csv", "jsonl", "geojson"} {
+		if format, err := ParseFormat(text); err != nil || string(format) != text {
+			t.Errorf("ParseFormat(%q) = %q, %v", text, format, err)
+		}
+	}
+	if _, err := ParseFormat("CSV"); err == nil {
+		t.Error("ParseFormat accepted CSV")
+	}
+}
@@ -0,0 +1,309 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package fixtures records the traffic between a VRageRemoteClient and a server
+// into a fixture file and replays it later, so code built on the client can be
+// tested without a running server.
+//
+//	recorder, err := fixtures.Open("testdata/grids.json", fixtures.ModeFromEnv(fixtures.ModeReplay))
+//	defer recorder.Close()
+//	recorder.Install(client)
+//
+// Recorded interactions are kept in memory and written to the fixture file by
+// Close, so a recorder in record mode has to be closed. Recording starts from an
+// empty file, interactions recorded earlier are replaced.
+//
+// Requests are matched by method, path and query. Signatures and dates are
+// never written to the fixture file.
+package fixtures
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"gopkg.in/uranoxyd/govrageremote.v2"
+)
+
+type Mode int
+
+const (
+	ModeReplay      Mode = iota // answer from the fixture file, unknown requests fail
+	ModeRecord                  // forward to the server and replace the fixture file with the recorded interactions on Close
+	ModePassthrough             // forward to the server, the fixture file is neither read nor written
+)
+
+// EnvMode is the environment variable read by ModeFromEnv
+const EnvMode = "VRAGE_FIXTURES"
+
+// ModeFromEnv returns the mode named by the VRAGE_FIXTURES environment variable
+// (replay, record or passthrough) or fallback if it is not set
+func ModeFromEnv(fallback Mode) Mode {
+	switch strings.ToLower(os.Getenv(EnvMode)) {
+	case "replay":
+		return ModeReplay
+	case "record":
+		return ModeRecord
+	case "passthrough":
+		return ModePassthrough
+	}
+	return fallback
+}
+
+type Request struct {
+	Method string
+	Path   string
+	Query  string `json:",omitempty"`
+	Body   string `json:",omitempty"`
+}
+
+// key identifies the requests an interaction answers, the query is in the
+// sorted form url.Values.Encode produces so parameter order does not matter
+func (request *Request) key() string {
+	if request.Query == "" {
+		return request.Method + " " + request.Path
+	}
+	return request.Method + " " + request.Path + "?" + request.Query
+}
+
+type Response struct {
+	StatusCode int
+	Header     http.Header `json:",omitempty"`
+	Body       string
+}
+
+type Interaction struct {
+	Request  Request
+	Response Response
+}
+
+// Recorder is an http.RoundTripper that records or replays interactions
+type Recorder struct {
+	Path         string
+	Mode         Mode
+	Transport    http.RoundTripper // used to reach the server in record and passthrough mode, nil means http.DefaultTransport
+	Interactions []*Interaction
+	replayed     map[string]int
+	dirty        bool // interactions were recorded since the last save
+	mutex        sync.Mutex
+}
+
+// Install routes all requests of client through the recorder
+func (recorder *Recorder) Install(client *govrageremote.VRageRemoteClient) {
+	client.SetTransport(recorder)
+}
+
+func (recorder *Recorder) RoundTrip(httpRequest *http.Request) (*http.Response, error) {
+	request, outgoing, err := newRequest(httpRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	if recorder.Mode == ModeReplay {
+		interaction, err := recorder.find(request)
+		if err != nil {
+			return nil, err
+		}
+		return interaction.Response.httpResponse(httpRequest), nil
+	}
+
+	transport := recorder.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	httpResponse, err := transport.RoundTrip(outgoing)
+	if err != nil {
+		return nil, err
+	}
+	httpResponse.Request = httpRequest
+	if recorder.Mode == ModePassthrough {
+		return httpResponse, nil
+	}
+
+	body, err := ioutil.ReadAll(httpResponse.Body)
+	httpResponse.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	httpResponse.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	header := httpResponse.Header.Clone()
+	header.Del("Date")
+	header.Del("Set-Cookie")
+
+	recorder.record(&Interaction{
+		Request: *request,
+		Response: Response{
+			StatusCode: httpResponse.StatusCode,
+			Header:     header,
+			Body:       string(body),
+		},
+	})
+	return httpResponse, nil
+}
+
+// find returns the recorded interactions for a request in the order they were
+// recorded, the last one answers all further repetitions
+func (recorder *Recorder) find(request *Request) (*Interaction, error) {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	key := request.key()
+	var matches []*Interaction
+	for _, interaction := range recorder.Interactions {
+		if interaction.Request.key() == key {
+			matches = append(matches, interaction)
+		}
+	}
+	if len(matches) == 0 {
+		return nil, errors.New("no recorded interaction for " + key)
+	}
+
+	if recorder.replayed == nil {
+		recorder.replayed = make(map[string]int)
+	}
+	index := recorder.replayed[key]
+	if index >= len(matches) {
+		index = len(matches) - 1
+	}
+	recorder.replayed[key] = index + 1
+	return matches[index], nil
+}
+
+func (recorder *Recorder) record(interaction *Interaction) {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	recorder.Interactions = append(recorder.Interactions, interaction)
+	recorder.dirty = true
+}
+
+// Rewind starts replaying repeated requests from their first recording again
+func (recorder *Recorder) Rewind() {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+	recorder.replayed = make(map[string]int)
+}
+
+// Save writes the recorded interactions to the fixture file if anything was
+// recorded since the last save
+func (recorder *Recorder) Save() error {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	if recorder.Path == "" || !recorder.dirty {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(recorder.Interactions, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	temp := recorder.Path + ".tmp"
+	err = ioutil.WriteFile(temp, data, 0644)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(temp, recorder.Path); err != nil {
+		return err
+	}
+	recorder.dirty = false
+	return nil
+}
+
+// Close saves the recorded interactions
+func (recorder *Recorder) Close() error {
+	return recorder.Save()
+}
+
+func (recorder *Recorder) load() error {
+	data, err := ioutil.ReadFile(recorder.Path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &recorder.Interactions)
+}
+
+// newRequest captures the parts of a request that are matched on, the
+// Authorization and Date headers are left out on purpose. The body is consumed,
+// so the request is cloned with a new body to be sent on.
+func newRequest(httpRequest *http.Request) (*Request, *http.Request, error) {
+	request := &Request{
+		Method: httpRequest.Method,
+		Path:   httpRequest.URL.Path,
+		Query:  httpRequest.URL.Query().Encode(),
+	}
+
+	if httpRequest.Body == nil || httpRequest.Body == http.NoBody {
+		return request, httpRequest, nil
+	}
+
+	body, err := ioutil.ReadAll(httpRequest.Body)
+	httpRequest.Body.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+	request.Body = string(body)
+
+	outgoing := httpRequest.Clone(httpRequest.Context())
+	outgoing.Body = ioutil.NopCloser(bytes.NewReader(body))
+	outgoing.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}
+	return request, outgoing, nil
+}
+
+func (response *Response) httpResponse(httpRequest *http.Request) *http.Response {
+	header := response.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", response.StatusCode, http.StatusText(response.StatusCode)),
+		StatusCode:    response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(strings.NewReader(response.Body)),
+		ContentLength: int64(len(response.Body)),
+		Request:       httpRequest,
+	}
+}
+
+// Open creates a recorder for the fixture file at path. In replay mode the file
+// has to exist, in record mode an existing file is replaced by Close.
+func Open(path string, mode Mode) (*Recorder, error) {
+	recorder := &Recorder{
+		Path:     path,
+		Mode:     mode,
+		replayed: make(map[string]int),
+	}
+
+	if mode == ModeReplay {
+		if err := recorder.load(); err != nil {
+			return nil, err
+		}
+	}
+
+	return recorder, nil
+}
@@ -0,0 +1,195 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package fixtures
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"gopkg.in/uranoxyd/govrageremote.v2"
+)
+
+// newServer answers like a Remote API server, the body tells which request it
+// answered and how many requests came before it
+func newServer(t *testing.T) (*httptest.Server, *int32) {
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		n := atomic.AddInt32(&count, 1)
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Header().Set("Date", "Sat, 01 Jan 2022 00:00:00 GMT")
+		writer.Header().Set("Set-Cookie", "session=secret")
+
+		body, _ := ioutil.ReadAll(request.Body)
+		switch {
+		case request.Method == "GET" && request.URL.Path == "/vrageremote/v1/server":
+			writer.Write([]byte(`{"data":{"ServerName":"call ` + string(rune('0'+n)) + `","IsReady":true},"meta":{"apiVersion":"1.0","queryTime":1}}`))
+		case request.Method == "GET" && request.URL.Path == "/vrageremote/v1/session/grids":
+			writer.Write([]byte(`{"data":{"Grids":[{"DisplayName":"grids ` + request.URL.RawQuery + `"}]},"meta":{"apiVersion":"1.0","queryTime":1}}`))
+		case request.Method == "POST" && request.URL.Path == "/vrageremote/v1/session/chat":
+			if string(body) != `"hello"` {
+				t.Errorf("chat body = %s", body)
+			}
+			writer.Write([]byte(`{"meta":{"apiVersion":"1.0","queryTime":1}}`))
+		case request.Method == "DELETE" && request.URL.Path == "/vrageremote/v1/session/grids/5":
+			writer.WriteHeader(http.StatusNotFound)
+			writer.Write([]byte(`{"error":{"message":"grid not found"},"meta":{"apiVersion":"1.0","queryTime":1}}`))
+		default:
+			t.Errorf("unexpected request %s %s", request.Method, request.URL)
+			writer.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &count
+}
+
+func serverName(t *testing.T, client *govrageremote.VRageRemoteClient) string {
+	response, err := client.GetServerInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response.Data.ServerName
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	server, count := newServer(t)
+	path := filepath.Join(t.TempDir(), "fixture.json")
+
+	recorder, err := Open(path, ModeRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := govrageremote.NewVRageRemoteClient(server.URL, "c2VjcmV0")
+	recorder.Install(client)
+
+	first, second := serverName(t, client), serverName(t, client)
+	if first != "call 1" || second != "call 2" {
+		t.Fatalf("recorded %q and %q", first, second)
+	}
+	if err := client.SendChat("hello"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.DeleteGrid(5); err == nil {
+		t.Fatal("expected an error")
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"c2VjcmV0", "Authorization", "secret", "Date"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("fixture file contains %q", secret)
+		}
+	}
+
+	replay, err := Open(path, ModeReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client = govrageremote.NewVRageRemoteClient("http://unreachable.invalid", "b3RoZXI=")
+	replay.Install(client)
+	recorded := atomic.LoadInt32(count)
+
+	// repetitions replay in order, the last recording answers everything after
+	for _, want := range []string{"call 1", "call 2", "call 2"} {
+		if got := serverName(t, client); got != want {
+			t.Errorf("replayed %q, want %q", got, want)
+		}
+	}
+	if err := client.SendChat("hello"); err != nil {
+		t.Error(err)
+	}
+	if err := client.DeleteGrid(5); err == nil || err.Error() != "grid not found" {
+		t.Errorf("replayed error %v", err)
+	}
+
+	replay.Rewind()
+	if got := serverName(t, client); got != "call 1" {
+		t.Errorf("after Rewind replayed %q, want %q", got, "call 1")
+	}
+	if atomic.LoadInt32(count) != recorded {
+		t.Error("replay reached the server")
+	}
+}
+
+func TestMatching(t *testing.T) {
+	recorder := &Recorder{Mode: ModeReplay}
+	recorder.Interactions = []*Interaction{
+		{Request: Request{Method: "GET", Path: "/vrageremote/v1/session/grids", Query: "a=1&b=2"}, Response: Response{StatusCode: 200, Body: "grids a b"}},
+		{Request: Request{Method: "GET", Path: "/vrageremote/v1/session/grids"}, Response: Response{StatusCode: 200, Body: "grids"}},
+		{Request: Request{Method: "DELETE", Path: "/vrageremote/v1/session/grids"}, Response: Response{StatusCode: 200, Body: "deleted"}},
+	}
+	httpClient := &http.Client{Transport: recorder}
+
+	tests := []struct {
+		method string
+		url    string
+		body   string
+	}{
+		{"GET", "http://server/vrageremote/v1/session/grids", "grids"},
+		{"GET", "http://server/vrageremote/v1/session/grids?b=2&a=1", "grids a b"},
+		{"DELETE", "http://server/vrageremote/v1/session/grids", "deleted"},
+		{"GET", "http://server/vrageremote/v1/session/grids?a=1", ""},
+		{"PATCH", "http://server/vrageremote/v1/session/grids", ""},
+		{"GET", "http://server/vrageremote/v1/session/characters", ""},
+	}
+	for _, test := range tests {
+		request, _ := http.NewRequest(test.method, test.url, nil)
+		response, err := httpClient.Do(request)
+		if test.body == "" {
+			if err == nil {
+				t.Errorf("%s %s matched a recording", test.method, test.url)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s %s: %v", test.method, test.url, err)
+			continue
+		}
+		body, _ := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		if string(body) != test.body {
+			t.Errorf("%s %s replayed %q, want %q", test.method, test.url, body, test.body)
+		}
+	}
+}
+
+func TestRoundTripKeepsRequest(t *testing.T) {
+	server, _ := newServer(t)
+	recorder := &Recorder{Mode: ModePassthrough}
+
+	request, _ := http.NewRequest("POST", server.URL+"/vrageremote/v1/session/chat", strings.NewReader(`"hello"`))
+	body := request.Body
+	response, err := recorder.RoundTrip(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+
+	if request.Body != body {
+		t.Error("RoundTrip replaced the body of the request")
+	}
+	if response.Request != request {
+		t.Error("response does not point to the original request")
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package gateway exposes the operations of a VRageRemoteClient as a plain JSON
+// REST API. Callers authenticate with a bearer token instead of signing every
+// request, the gateway checks the role of the user and makes the signed Remote
+// API call on their behalf.
+//
+// Successful reads answer {"data": ...}, actions answer 204 No Content and all
+// errors share one shape:
+//
+//	{"error": {"status": 403, "code": "forbidden", "message": "delete grid requires the admin role"}}
+//
+// The OpenAPI description of all routes is served at <prefix>/openapi.json.
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"gopkg.in/uranoxyd/govrageremote.v2"
+	"gopkg.in/uranoxyd/govrageremote.v2/access"
+)
+
+// Error is the normalized error every failed call answers with
+type Error struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (err *Error) Error() string {
+	return err.Message
+}
+
+func newError(status int, code string, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+// normalizeError maps errors of the client to an Error
+func normalizeError(err error) *Error {
+	var gatewayErr *Error
+	if errors.As(err, &gatewayErr) {
+		return gatewayErr
+	}
+
+	var versionErr *govrageremote.VRageUnsupportedAPIVersionError
+	if errors.As(err, &versionErr) {
+		return newError(http.StatusNotImplemented, "unsupported_api_version", err.Error())
+	}
+	var schemaErr *govrageremote.VRageSchemaError
+	if errors.As(err, &schemaErr) {
+		return newError(http.StatusBadGateway, "schema_drift", err.Error())
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return newError(http.StatusGatewayTimeout, "timeout", err.Error())
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return newError(http.StatusGatewayTimeout, "timeout", err.Error())
+		}
+		return newError(http.StatusBadGateway, "unreachable", err.Error())
+	}
+	var statusErr *govrageremote.VRageStatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.StatusCode {
+		case http.StatusBadRequest:
+			return newError(http.StatusBadRequest, "invalid_argument", err.Error())
+		case http.StatusForbidden:
+			return newError(http.StatusForbidden, "forbidden", err.Error())
+		case http.StatusNotFound:
+			return newError(http.StatusNotFound, "not_found", err.Error())
+		}
+	}
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+		return newError(http.StatusBadGateway, "bad_response", err.Error())
+	}
+	// everything else is a message the Remote API answered with
+	return newError(http.StatusBadGateway, "remote_error", err.Error())
+}
+
+type Gateway struct {
+	client      *govrageremote.VRageRemoteClient
+	users       access.Users
+	Prefix      string      // path the API is served under, like "/api"
+	AllowOrigin string      // value of Access-Control-Allow-Origin, empty disables CORS
+	Logger      *log.Logger // logs every call if not nil
+}
+
+func (gateway *Gateway) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	start := time.Now()
+
+	if gateway.AllowOrigin != "" {
+		header := writer.Header()
+		header.Set("Access-Control-Allow-Origin", gateway.AllowOrigin)
+		header.Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+		header.Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE")
+		if request.Method == http.MethodOptions {
+			writer.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+
+	if !strings.HasPrefix(request.URL.Path, gateway.Prefix+"/") {
+		writeError(writer, newError(http.StatusNotFound, "not_found", "no route for "+request.URL.Path))
+		return
+	}
+	path := strings.TrimPrefix(request.URL.Path, gateway.Prefix)
+	if path == "/openapi.json" && request.Method == http.MethodGet {
+		writeJSON(writer, http.StatusOK, gateway.OpenAPI())
+		return
+	}
+
+	route, params, err := match(request.Method, path)
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+
+	user, err := gateway.authenticate(request, route)
+	if err != nil {
+		gateway.logf("denied %s %s from %s: %s", request.Method, request.URL.Path, request.RemoteAddr, err)
+		writeError(writer, err)
+		return
+	}
+
+	data, err := route.handle(gateway.client, request, params)
+	if err != nil {
+		normalized := normalizeError(err)
+		gateway.logf("%s (%s) %s %s -> %d %s", user.Name, user.Role, request.Method, request.URL.Path, normalized.Status, normalized.Message)
+		writeError(writer, normalized)
+		return
+	}
+	gateway.logf("%s (%s) %s %s in %s", user.Name, user.Role, request.Method, request.URL.Path, time.Since(start).Round(time.Millisecond))
+
+	if route.action {
+		writer.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(writer, http.StatusOK, map[string]interface{}{"data": data})
+}
+
+func (gateway *Gateway) authenticate(request *http.Request, route *route) (*access.User, error) {
+	authorization := request.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, "Bearer ") {
+		return nil, newError(http.StatusUnauthorized, "unauthorized", "missing bearer token")
+	}
+	user := gateway.users.ByToken(strings.TrimSpace(strings.TrimPrefix(authorization, "Bearer ")))
+	if user == nil {
+		return nil, newError(http.StatusUnauthorized, "unauthorized", "invalid bearer token")
+	}
+
+	rule := route.rule()
+	if !user.Role.Includes(rule.Role) {
+		return nil, newError(http.StatusForbidden, "forbidden", rule.Action+" requires the "+string(rule.Role)+" role")
+	}
+	return user, nil
+}
+
+func (gateway *Gateway) logf(format string, args ...interface{}) {
+	if gateway.Logger != nil {
+		gateway.Logger.Printf(format, args...)
+	}
+}
+
+func writeJSON(writer http.ResponseWriter, status int, value interface{}) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	json.NewEncoder(writer).Encode(value)
+}
+
+func writeError(writer http.ResponseWriter, err error) {
+	normalized := normalizeError(err)
+	writeJSON(writer, normalized.Status, map[string]interface{}{"error": normalized})
+}
+
+// New creates a gateway serving the API under prefix for the users with a token
+func New(client *govrageremote.VRageRemoteClient, users access.Users, prefix string) *Gateway {
+	return &Gateway{
+		client: client,
+		users:  users,
+		Prefix: strings.TrimRight(prefix, "/"),
+	}
+}
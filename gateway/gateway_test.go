@@ -0,0 +1,188 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"gopkg.in/uranoxyd/govrageremote.v2"
+	"gopkg.in/uranoxyd/govrageremote.v2/access"
+)
+
+// newTestGateway serves /api in front of a stand-in Remote API which records
+// the calls it got
+func newTestGateway(t *testing.T) (*Gateway, func() []string) {
+	var mutex sync.Mutex
+	var calls []string
+	remote := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		resource := strings.TrimPrefix(request.URL.Path, "/vrageremote/v1/")
+		mutex.Lock()
+		calls = append(calls, request.Method+" "+resource)
+		mutex.Unlock()
+
+		switch {
+		case request.Method == "GET" && resource == "session/grids":
+			fmt.Fprint(writer, `{"data":{"Grids":[{"DisplayName":"Miner","EntityId":76561198000000001}]},"meta":{"apiVersion":"1.0","queryTime":1}}`)
+		case resource == "session/grids/404":
+			writer.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(writer, `{"error":{"message":"grid not found"},"meta":{"apiVersion":"1.0","queryTime":1}}`)
+		case resource == "session/grids/500":
+			writer.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(writer, `{"error":{"message":"something broke"},"meta":{"apiVersion":"1.0","queryTime":1}}`)
+		default:
+			fmt.Fprint(writer, `{"meta":{"apiVersion":"1.0","queryTime":1}}`)
+		}
+	}))
+	t.Cleanup(remote.Close)
+
+	users := access.Users{
+		{Name: "admin", Role: access.RoleAdmin, Token: "admin-token"},
+		{Name: "mod", Role: access.RoleModerator, Token: "mod-token"},
+		{Name: "reader", Role: access.RoleReadOnly, Token: "read-token"},
+	}
+	gateway := New(govrageremote.NewVRageRemoteClient(remote.URL, "c2VjcmV0"), users, "/api/")
+	return gateway, func() []string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return append([]string(nil), calls...)
+	}
+}
+
+func TestGateway(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   string
+		status int
+		code   string // error code, empty on success
+		remote string // the Remote API call made, empty if none
+	}{
+		{"read", "GET", "/api/grids", "read-token", "", 200, "", "GET session/grids"},
+		{"missing token", "GET", "/api/grids", "", "", 401, "unauthorized", ""},
+		{"invalid token", "GET", "/api/grids", "nope", "", 401, "unauthorized", ""},
+		{"moderator action", "POST", "/api/grids/5/stop", "mod-token", "", 204, "", "PATCH session/grids/5"},
+		{"role too low", "POST", "/api/grids/5/stop", "read-token", "", 403, "forbidden", ""},
+		{"admin only", "DELETE", "/api/grids/5", "mod-token", "", 403, "forbidden", ""},
+		{"admin", "DELETE", "/api/grids/5", "admin-token", "", 204, "", "DELETE session/grids/5"},
+		{"ban needs admin", "PUT", "/api/bans/76561198000000001", "mod-token", "", 403, "forbidden", ""},
+		{"steam id formats", "PUT", "/api/kicks/STEAM_0:1:19867136", "mod-token", "", 204, "", "POST admin/kickedPlayers/76561198000000001"},
+		{"invalid id", "POST", "/api/grids/abc/stop", "mod-token", "", 400, "invalid_argument", ""},
+		{"unknown route", "GET", "/api/nothing", "read-token", "", 404, "not_found", ""},
+		{"method not allowed", "PATCH", "/api/grids", "admin-token", "", 405, "method_not_allowed", ""},
+		{"outside the prefix", "GET", "/grids", "read-token", "", 404, "not_found", ""},
+		{"prefix lookalike", "GET", "/apigrids", "read-token", "", 404, "not_found", ""},
+
+		{"power on", "PUT", "/api/grids/5/power", "mod-token", `{"on":true}`, 204, "", "POST session/poweredGrids/5"},
+		{"power off", "PUT", "/api/grids/5/power", "mod-token", `{"on":false}`, 204, "", "DELETE session/poweredGrids/5"},
+		{"power without body", "PUT", "/api/grids/5/power", "mod-token", "", 400, "invalid_body", ""},
+		{"power without on", "PUT", "/api/grids/5/power", "mod-token", `{}`, 400, "invalid_body", ""},
+		{"power with broken body", "PUT", "/api/grids/5/power", "mod-token", `{"on":`, 400, "invalid_body", ""},
+		{"empty chat", "POST", "/api/chat", "mod-token", `{"message":""}`, 400, "invalid_argument", ""},
+		{"chat", "POST", "/api/chat", "mod-token", `{"message":"hi"}`, 204, "", "POST session/chat"},
+
+		{"remote not found", "DELETE", "/api/grids/404", "admin-token", "", 404, "not_found", "DELETE session/grids/404"},
+		{"remote failure", "DELETE", "/api/grids/500", "admin-token", "", 502, "remote_error", "DELETE session/grids/500"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			gateway, calls := newTestGateway(t)
+			request := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+			if test.token != "" {
+				request.Header.Set("Authorization", "Bearer "+test.token)
+			}
+			recorder := httptest.NewRecorder()
+			gateway.ServeHTTP(recorder, request)
+
+			if recorder.Code != test.status {
+				t.Errorf("status = %d, want %d: %s", recorder.Code, test.status, recorder.Body)
+			}
+			if test.code != "" {
+				var response struct{ Error *Error }
+				if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil || response.Error == nil {
+					t.Fatalf("invalid error response %s", recorder.Body)
+				}
+				if response.Error.Code != test.code || response.Error.Status != test.status {
+					t.Errorf("error = %+v, want code %s", response.Error, test.code)
+				}
+			}
+			if got := strings.Join(calls(), ", "); got != test.remote {
+				t.Errorf("remote calls %q, want %q", got, test.remote)
+			}
+		})
+	}
+}
+
+func TestGatewayData(t *testing.T) {
+	gateway, _ := newTestGateway(t)
+	request := httptest.NewRequest("GET", "/api/grids", nil)
+	request.Header.Set("Authorization", "Bearer read-token")
+	recorder := httptest.NewRecorder()
+	gateway.ServeHTTP(recorder, request)
+
+	var response struct {
+		Data []map[string]interface{}
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	// ids are strings, JavaScript numbers would round them
+	if len(response.Data) != 1 || response.Data[0]["EntityId"] != "76561198000000001" {
+		t.Errorf("data = %v", response.Data)
+	}
+}
+
+func TestRoutesHaveRules(t *testing.T) {
+	for _, route := range routes {
+		if rule := route.rule(); rule.Action == "unknown" {
+			t.Errorf("%s %s calls %s which has no rule", route.method, route.path, route.remote)
+		}
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	gateway, _ := newTestGateway(t)
+	request := httptest.NewRequest("GET", "/api/openapi.json", nil)
+	recorder := httptest.NewRecorder()
+	gateway.ServeHTTP(recorder, request)
+
+	var document struct {
+		Paths      map[string]map[string]interface{}
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]map[string]interface{}
+			}
+		}
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &document); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := document.Paths["/api/grids/{id}/power"]["put"]; !ok {
+		t.Error("PUT /api/grids/{id}/power is missing")
+	}
+	for schema, property := range map[string]string{"Grid": "EntityId", "Player": "SteamID"} {
+		if got := document.Components.Schemas[schema].Properties[property]["type"]; got != "string" {
+			t.Errorf("%s.%s has type %v, want string", schema, property, got)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package gateway
+
+import (
+	"go/ast"
+	"reflect"
+	"strings"
+
+	"gopkg.in/uranoxyd/govrageremote.v2"
+)
+
+// schemaTypes are the Go types behind the schema names used by the routes
+var schemaTypes = map[string]reflect.Type{
+	"ServerInfo":      reflect.TypeOf(govrageremote.VRageRemoteServerInfo{}),
+	"Ping":            reflect.TypeOf(pingData{}),
+	"Players":         reflect.TypeOf([]*govrageremote.VRageRemotePlayer{}),
+	"BannedPlayers":   reflect.TypeOf([]*govrageremote.VRageBannedPlayer{}),
+	"KickedPlayers":   reflect.TypeOf([]*govrageremote.VRageKickedPlayer{}),
+	"Characters":      reflect.TypeOf([]*govrageremote.VRageRemoteCharacter{}),
+	"Grids":           reflect.TypeOf([]*govrageremote.VRageRemoteGrid{}),
+	"FloatingObjects": reflect.TypeOf([]*govrageremote.VRageRemoteFloatingObject{}),
+	"Asteroids":       reflect.TypeOf([]*govrageremote.VRageRemoteAsteroid{}),
+	"Planets":         reflect.TypeOf([]*govrageremote.VRagePlanet{}),
+	"ChatMessages":    reflect.TypeOf([]*govrageremote.VRageChatMessage{}),
+	"Save":            reflect.TypeOf(saveBody{}),
+	"Power":           reflect.TypeOf(powerBody{}),
+	"Chat":            reflect.TypeOf(chatBody{}),
+	"Error":           reflect.TypeOf(Error{}),
+}
+
+type schemaBuilder struct {
+	components map[string]interface{}
+}
+
+// schema describes t in OpenAPI terms, named structs become components
+func (builder *schemaBuilder) schema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t {
+	case reflect.TypeOf(govrageremote.SteamID(0)):
+		return map[string]interface{}{"type": "string", "pattern": "^[0-9]+$", "description": "SteamID64 as a decimal string, it exceeds the precision of JavaScript numbers"}
+	case reflect.TypeOf(govrageremote.EntityID(0)):
+		return map[string]interface{}{"type": "string", "pattern": "^[0-9]+$", "description": "entity id as a decimal string, it exceeds the precision of JavaScript numbers"}
+	case reflect.TypeOf(govrageremote.DotNetTicks(0)):
+		return map[string]interface{}{"type": "integer", "format": "int64", "description": ".NET ticks, 100ns intervals since 0001-01-01"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": builder.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": builder.schema(t.Elem())}
+	case reflect.Struct:
+		// only exported types are worth a component, request bodies are inlined
+		name := strings.TrimPrefix(strings.TrimPrefix(t.Name(), "VRageRemote"), "VRage")
+		if name != "" && ast.IsExported(name) {
+			if _, ok := builder.components[name]; !ok {
+				builder.components[name] = nil // guards against recursion
+				builder.components[name] = builder.object(t)
+			}
+			return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+		}
+		return builder.object(t)
+	}
+	return map[string]interface{}{}
+}
+
+func (builder *schemaBuilder) object(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := field.Name
+		if parts := strings.Split(tag, ","); parts[0] != "" {
+			name = parts[0]
+		}
+		properties[name] = builder.schema(field.Type)
+	}
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
+
+// OpenAPI returns the OpenAPI 3 description of the gateway
+func (gateway *Gateway) OpenAPI() map[string]interface{} {
+	builder := &schemaBuilder{components: make(map[string]interface{})}
+	errorResponse := map[string]interface{}{
+		"description": "error",
+		"content": map[string]interface{}{
+			"application/json": map[string]interface{}{
+				"schema": map[string]interface{}{
+					"type":       "object",
+					"properties": map[string]interface{}{"error": builder.schema(schemaTypes["Error"])},
+				},
+			},
+		},
+	}
+
+	paths := make(map[string]interface{})
+	for _, route := range routes {
+		item, ok := paths[gateway.Prefix+route.path].(map[string]interface{})
+		if !ok {
+			item = make(map[string]interface{})
+			paths[gateway.Prefix+route.path] = item
+		}
+
+		var parameters []interface{}
+		for _, segment := range strings.Split(route.path, "/") {
+			if strings.HasPrefix(segment, "{") {
+				name := strings.Trim(segment, "{}")
+				description := "entity id"
+				if name == "steamID" {
+					description = "SteamID64, SteamID3, SteamID2 or profile url"
+				}
+				parameters = append(parameters, map[string]interface{}{
+					"name": name, "in": "path", "required": true, "description": description,
+					"schema": map[string]interface{}{"type": "string"},
+				})
+			}
+		}
+
+		responses := map[string]interface{}{"default": errorResponse}
+		if route.action {
+			responses["204"] = map[string]interface{}{"description": "done"}
+		} else {
+			responses["200"] = map[string]interface{}{
+				"description": "ok",
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{
+						"schema": map[string]interface{}{
+							"type":       "object",
+							"properties": map[string]interface{}{"data": builder.schema(schemaTypes[route.response])},
+						},
+					},
+				},
+			}
+		}
+
+		rule := route.rule()
+		operation := map[string]interface{}{
+			"summary":     route.summary,
+			"description": "Requires the " + string(rule.Role) + " role.",
+			"responses":   responses,
+		}
+		if parameters != nil {
+			operation["parameters"] = parameters
+		}
+		if route.body != "" {
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": builder.schema(schemaTypes[route.body])},
+				},
+			}
+		}
+		item[strings.ToLower(route.method)] = operation
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "VRage Remote API gateway",
+			"version": "1.0",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": builder.components,
+			"securitySchemes": map[string]interface{}{
+				"bearer": map[string]interface{}{"type": "http", "scheme": "bearer"},
+			},
+		},
+		"security": []interface{}{map[string]interface{}{"bearer": []interface{}{}}},
+	}
+}
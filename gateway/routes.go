@@ -0,0 +1,328 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"gopkg.in/uranoxyd/govrageremote.v2"
+	"gopkg.in/uranoxyd/govrageremote.v2/access"
+)
+
+type handler func(client *govrageremote.VRageRemoteClient, request *http.Request, params map[string]string) (interface{}, error)
+
+type route struct {
+	method   string
+	path     string // {name} matches a single path segment
+	summary  string
+	remote   string // the Remote API call made, like "DELETE session/grids/*", it decides the required role
+	body     string // schema of the request body, empty if there is none
+	response string // schema of the data, empty for actions
+	action   bool   // answers 204 No Content
+	handle   handler
+}
+
+func (route *route) rule() access.Rule {
+	parts := strings.SplitN(route.remote, " ", 2)
+	return access.LookupPattern(parts[0], parts[1])
+}
+
+// match finds the route for a request, params holds the values of the {name} segments
+func match(method string, path string) (*route, map[string]string, error) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	pathFound := false
+	for _, route := range routes {
+		params, ok := matchPath(route.path, segments)
+		if !ok {
+			continue
+		}
+		pathFound = true
+		if route.method == method {
+			return route, params, nil
+		}
+	}
+	if pathFound {
+		return nil, nil, newError(http.StatusMethodNotAllowed, "method_not_allowed", method+" is not allowed on "+path)
+	}
+	return nil, nil, newError(http.StatusNotFound, "not_found", "no route for "+path)
+}
+
+func matchPath(pattern string, segments []string) (map[string]string, bool) {
+	parts := strings.Split(strings.Trim(pattern, "/"), "/")
+	if len(parts) != len(segments) {
+		return nil, false
+	}
+	params := make(map[string]string)
+	for i, part := range parts {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			params[part[1:len(part)-1]] = segments[i]
+			continue
+		}
+		if part != segments[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+func entityID(params map[string]string) (govrageremote.EntityID, error) {
+	id, err := govrageremote.ParseEntityID(params["id"])
+	if err != nil {
+		return 0, newError(http.StatusBadRequest, "invalid_argument", err.Error())
+	}
+	return id, nil
+}
+
+func steamID(params map[string]string) (govrageremote.SteamID, error) {
+	id, err := govrageremote.ParseSteamID(params["steamID"])
+	if err != nil {
+		return 0, newError(http.StatusBadRequest, "invalid_argument", err.Error())
+	}
+	return id, nil
+}
+
+func decodeBody(request *http.Request, value interface{}) error {
+	err := json.NewDecoder(io.LimitReader(request.Body, 1<<20)).Decode(value)
+	if err == io.EOF {
+		return newError(http.StatusBadRequest, "invalid_body", "missing request body")
+	}
+	if err != nil {
+		return newError(http.StatusBadRequest, "invalid_body", "invalid request body: "+err.Error())
+	}
+	return nil
+}
+
+// call makes a Remote API call with the context of the incoming request, so it
+// is given up when the caller goes away
+func call(client *govrageremote.VRageRemoteClient, request *http.Request, method string, resource string, query url.Values, body interface{}, out interface{}) error {
+	_, _, err := client.Do(request.Context(), method, resource, query, body, out)
+	return err
+}
+
+// entityAction calls method on collection/<id>
+func entityAction(method string, collection string) handler {
+	return func(client *govrageremote.VRageRemoteClient, request *http.Request, params map[string]string) (interface{}, error) {
+		id, err := entityID(params)
+		if err != nil {
+			return nil, err
+		}
+		return nil, call(client, request, method, fmt.Sprintf("%s/%d", collection, id), nil, nil, nil)
+	}
+}
+
+// playerAction calls method on collection/<steam id>
+func playerAction(method string, collection string) handler {
+	return func(client *govrageremote.VRageRemoteClient, request *http.Request, params map[string]string) (interface{}, error) {
+		id, err := steamID(params)
+		if err != nil {
+			return nil, err
+		}
+		return nil, call(client, request, method, fmt.Sprintf("%s/%d", collection, id), nil, nil, nil)
+	}
+}
+
+type saveBody struct {
+	Name string `json:"name"`
+}
+
+type powerBody struct {
+	On *bool `json:"on"` // required, a missing value must not power the grid off
+}
+
+type pingData struct {
+	LatencyMs float64 `json:"latencyMs"`
+}
+
+type chatBody struct {
+	Message string `json:"message"`
+}
+
+var routes = []*route{
+	{method: "GET", path: "/server", summary: "Server info", remote: "GET server", response: "ServerInfo",
+		handle: func(client *govrageremote.VRageRemoteClient, request *http.Request, params map[string]string) (interface{}, error) {
+			data := &govrageremote.VRageRemoteServerInfo{}
+			if err := call(client, request, "GET", "server", nil, nil, data); err != nil {
+				return nil, err
+			}
+			return data, nil
+		}},
+	{method: "GET", path: "/server/ping", summary: "Measure the latency to the server", remote: "GET server/ping", response: "Ping",
+		handle: func(client *govrageremote.VRageRemoteClient, request *http.Request, params map[string]string) (interface{}, error) {
+			start := time.Now()
+			if err := call(client, request, "GET", "server/ping", nil, nil, nil); err != nil {
+				return nil, err
+			}
+			return &pingData{LatencyMs: time.Since(start).Seconds() * 1000}, nil
+		}},
+	{method: "POST", path: "/server/stop", summary: "Stop the server", remote: "DELETE server", action: true,
+		handle: func(client *govrageremote.VRageRemoteClient, request *http.Request, params map[string]string) (interface{}, error) {
+			return nil, call(client, request, "DELETE", "server", nil, nil, nil)
+		}},
+	{method: "POST", path: "/session/save", summary: "Save the world, optionally under a new name", remote: "PATCH session", body: "Save", action: true,
+		handle: func(client *govrageremote.VRageRemoteClient, request *http.Request, params map[string]string) (interface{}, error) {
+			body := &saveBody{}
+			if err := decodeBody(request, body); err != nil {
+				return nil, err
+			}
+			var query url.Values
+			if body.Name != "" {
+				query = url.Values{"savename": {body.Name}}
+			}
+			return nil, call(client, request, "PATCH", "session", query, nil, nil)
+		}},
+
+	{method: "GET", path: "/players", summary: "Online players", remote: "GET session/players", response: "Players",
+		handle: func(client *govrageremote.VRageRemoteClient, request *http.Request, params map[string]string) (interface{}, error) {
+			data := &govrageremote.VRageRemotePlayerList{}
+			if err := call(client, request, "GET", "session/players", nil, nil, data); err != nil {
+				return nil, err
+			}
+			return data.Players, nil
+		}},
+	{method: "PUT", path: "/promotions/{steamID}", summary: "Promote a player", remote: "POST admin/promotedPlayers/*", action: true,
+		handle: playerAction("POST", "admin/promotedPlayers")},
+	{method: "DELETE", path: "/promotions/{steamID}", summary: "Demote a player", remote: "DELETE admin/promotedPlayers/*", action: true,
+		handle: playerAction("DELETE", "admin/promotedPlayers")},
+
+	{method: "GET", path: "/bans", summary: "Banned players", remote: "GET admin/bannedPlayers", response: "BannedPlayers",
+		handle: func(client *govrageremote.VRageRemoteClient, request *http.Request, params map[string]string) (interface{}, error) {
+			data := &govrageremote.VRageRemoteBannedPlayersList{}
+			if err := call(client, request, "GET", "admin/bannedPlayers", nil, nil, data); err != nil {
+				return nil, err
+			}
+			return data.BannedPlayers, nil
+		}},
+	{method: "PUT", path: "/bans/{steamID}", summary: "Ban a player", remote: "POST admin/bannedPlayers/*", action: true,
+		handle: playerAction("POST", "admin/bannedPlayers")},
+	{method: "DELETE", path: "/bans/{steamID}", summary: "Unban a player", remote: "DELETE admin/bannedPlayers/*", action: true,
+		handle: playerAction("DELETE", "admin/bannedPlayers")},
+
+	{method: "GET", path: "/kicks", summary: "Kicked players", remote: "GET admin/kickedPlayers", response: "KickedPlayers",
+		handle: func(client *govrageremote.VRageRemoteClient, request *http.Request, params map[string]string) (interface{}, error) {
+			data := &govrageremote.VRageRemoteKickedPlayersList{}
+			if err := call(client, request, "GET", "admin/kickedPlayers", nil, nil, data); err != nil {
+				return nil, err
+			}
+			return data.KickedPlayers, nil
+		}},
+	{method: "PUT", path: "/kicks/{steamID}", summary: "Kick a player", remote: "POST admin/kickedPlayers/*", action: true,
+		handle: playerAction("POST", "admin/kickedPlayers")},
+	{method: "DELETE", path: "/kicks/{steamID}", summary: "Allow a kicked player to rejoin", remote: "DELETE admin/kickedPlayers/*", action: true,
+		handle: playerAction("DELETE", "admin/kickedPlayers")},
+
+	{method: "GET", path: "/characters", summary: "Characters in the world", remote: "GET session/characters", response: "Characters",
+		handle: func(client *govrageremote.VRageRemoteClient, request *http.Request, params map[string]string) (interface{}, error) {
+			data := &govrageremote.VRageRemoteCharacterList{}
+			if err := call(client, request, "GET", "session/characters", nil, nil, data); err != nil {
+				return nil, err
+			}
+			return data.Characters, nil
+		}},
+	{method: "POST", path: "/characters/{id}/stop", summary: "Stop a character", remote: "PATCH session/characters/*", action: true,
+		handle: entityAction("PATCH", "session/characters")},
+
+	{method: "GET", path: "/grids", summary: "Grids in the world", remote: "GET session/grids", response: "Grids",
+		handle: func(client *govrageremote.VRageRemoteClient, request *http.Request, params map[string]string) (interface{}, error) {
+			data := &govrageremote.VRageRemoteGridList{}
+			if err := call(client, request, "GET", "session/grids", nil, nil, data); err != nil {
+				return nil, err
+			}
+			return data.Grids, nil
+		}},
+	{method: "DELETE", path: "/grids/{id}", summary: "Delete a grid", remote: "DELETE session/grids/*", action: true,
+		handle: entityAction("DELETE", "session/grids")},
+	{method: "POST", path: "/grids/{id}/stop", summary: "Stop a grid", remote: "PATCH session/grids/*", action: true,
+		handle: entityAction("PATCH", "session/grids")},
+	{method: "PUT", path: "/grids/{id}/power", summary: "Power a grid on or off", remote: "POST session/poweredGrids/*", body: "Power", action: true,
+		handle: func(client *govrageremote.VRageRemoteClient, request *http.Request, params map[string]string) (interface{}, error) {
+			id, err := entityID(params)
+			if err != nil {
+				return nil, err
+			}
+			body := &powerBody{}
+			if err := decodeBody(request, body); err != nil {
+				return nil, err
+			}
+			method := "DELETE"
+			if body.On == nil {
+				return nil, newError(http.StatusBadRequest, "invalid_body", "on must be true or false")
+			}
+			if *body.On {
+				method = "POST"
+			}
+			return nil, call(client, request, method, fmt.Sprintf("session/poweredGrids/%d", id), nil, nil, nil)
+		}},
+
+	{method: "GET", path: "/floating-objects", summary: "Floating objects in the world", remote: "GET session/floatingObjects", response: "FloatingObjects",
+		handle: func(client *govrageremote.VRageRemoteClient, request *http.Request, params map[string]string) (interface{}, error) {
+			data := &govrageremote.VRageRemoteFloatingObjectList{}
+			if err := call(client, request, "GET", "session/floatingObjects", nil, nil, data); err != nil {
+				return nil, err
+			}
+			return data.FloatingObjects, nil
+		}},
+	{method: "DELETE", path: "/floating-objects/{id}", summary: "Delete a floating object", remote: "DELETE session/floatingObjects/*", action: true,
+		handle: entityAction("DELETE", "session/floatingObjects")},
+	{method: "POST", path: "/floating-objects/{id}/stop", summary: "Stop a floating object", remote: "PATCH session/floatingObjects/*", action: true,
+		handle: entityAction("PATCH", "session/floatingObjects")},
+
+	{method: "GET", path: "/asteroids", summary: "Asteroids in the world", remote: "GET session/asteroids", response: "Asteroids",
+		handle: func(client *govrageremote.VRageRemoteClient, request *http.Request, params map[string]string) (interface{}, error) {
+			data := &govrageremote.VRageRemoteAsteroidsList{}
+			if err := call(client, request, "GET", "session/asteroids", nil, nil, data); err != nil {
+				return nil, err
+			}
+			return data.Asteroids, nil
+		}},
+	{method: "DELETE", path: "/asteroids/{id}", summary: "Delete an asteroid", remote: "DELETE session/asteroids/*", action: true,
+		handle: entityAction("DELETE", "session/asteroids")},
+
+	{method: "GET", path: "/planets", summary: "Planets in the world", remote: "GET session/planets", response: "Planets",
+		handle: func(client *govrageremote.VRageRemoteClient, request *http.Request, params map[string]string) (interface{}, error) {
+			data := &govrageremote.VRageRemotePlanetList{}
+			if err := call(client, request, "GET", "session/planets", nil, nil, data); err != nil {
+				return nil, err
+			}
+			return data.Planets, nil
+		}},
+	{method: "DELETE", path: "/planets/{id}", summary: "Delete a planet", remote: "DELETE session/planets/*", action: true,
+		handle: entityAction("DELETE", "session/planets")},
+
+	{method: "GET", path: "/chat", summary: "Recent chat messages", remote: "GET session/chat", response: "ChatMessages",
+		handle: func(client *govrageremote.VRageRemoteClient, request *http.Request, params map[string]string) (interface{}, error) {
+			data := &govrageremote.VRageRemoteChatMessageList{}
+			if err := call(client, request, "GET", "session/chat", nil, nil, data); err != nil {
+				return nil, err
+			}
+			return data.Messages, nil
+		}},
+	{method: "POST", path: "/chat", summary: "Send a chat message", remote: "POST session/chat", body: "Chat", action: true,
+		handle: func(client *govrageremote.VRageRemoteClient, request *http.Request, params map[string]string) (interface{}, error) {
+			body := &chatBody{}
+			if err := decodeBody(request, body); err != nil {
+				return nil, err
+			}
+			if body.Message == "" {
+				return nil, newError(http.StatusBadRequest, "invalid_argument", "message must not be empty")
+			}
+			return nil, call(client, request, "POST", "session/chat", nil, body.Message, nil)
+		}},
+}
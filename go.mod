@@ -1,3 +1,3 @@
-module gopkg.in/uranoxyd/govrageremote.v1
+module gopkg.in/uranoxyd/govrageremote.v2
 
 go 1.16
@@ -0,0 +1,116 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package history
+
+import (
+	"time"
+
+	"gopkg.in/uranoxyd/govrageremote.v2"
+)
+
+// Recorder takes snapshots of a server and adds them to a store
+type Recorder struct {
+	client     *govrageremote.VRageRemoteClient
+	store      *Store
+	Grids      bool
+	Characters bool
+	Players    bool
+	Chat       bool
+	Retention  time.Duration // snapshots older than this are pruned, zero keeps everything
+	OnError    func(err error)
+}
+
+// Record takes a single snapshot
+func (recorder *Recorder) Record() error {
+	snapshot := &Snapshot{Time: time.Now().UTC()}
+
+	if recorder.Grids {
+		response, err := recorder.client.GetGrids()
+		if err != nil {
+			return err
+		}
+		snapshot.Grids = response.Data.Grids
+	}
+	if recorder.Characters {
+		response, err := recorder.client.GetCharacters()
+		if err != nil {
+			return err
+		}
+		snapshot.Characters = response.Data.Characters
+	}
+	if recorder.Players {
+		response, err := recorder.client.GetPlayers()
+		if err != nil {
+			return err
+		}
+		// an empty but non nil list marks "nobody online" for PlayerSessions
+		snapshot.Players = append([]*govrageremote.VRageRemotePlayer{}, response.Data.Players...)
+	}
+	if recorder.Chat {
+		response, err := recorder.client.GetChat()
+		if err != nil {
+			return err
+		}
+		snapshot.Chat = response.Data.Messages
+	}
+
+	if err := recorder.store.Add(snapshot); err != nil {
+		return err
+	}
+	return recorder.prune(snapshot.Time)
+}
+
+// prune drops snapshots older than Retention. The file is only compacted once a
+// tenth of Retention has piled up, not after every snapshot.
+func (recorder *Recorder) prune(now time.Time) error {
+	if recorder.Retention <= 0 {
+		return nil
+	}
+	cutoff := now.Add(-recorder.Retention)
+	oldest := recorder.store.Oldest()
+	if oldest.IsZero() || !oldest.Before(cutoff.Add(-recorder.Retention/10)) {
+		return nil
+	}
+	return recorder.store.Prune(cutoff)
+}
+
+// Run records a snapshot every interval until stop is closed
+func (recorder *Recorder) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := recorder.Record(); err != nil && recorder.OnError != nil {
+			recorder.OnError(err)
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func NewRecorder(client *govrageremote.VRageRemoteClient, store *Store) *Recorder {
+	return &Recorder{
+		client:     client,
+		store:      store,
+		Grids:      true,
+		Characters: true,
+		Players:    true,
+		Chat:       true,
+	}
+}
@@ -0,0 +1,389 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package history persists periodic snapshots of a server and answers questions
+// about the past, like where a grid was yesterday or how long a player played.
+//
+// Snapshots are appended to a single JSON Lines file which is read back into
+// memory when the store is opened, so no database is required. The price is that
+// the whole history is held in memory and every query scans the snapshots of its
+// time range, so the history has to be kept short: use Prune or the Retention of
+// a Recorder to drop old snapshots. For months of history at a short interval a
+// real database is the better choice.
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"gopkg.in/uranoxyd/govrageremote.v2"
+)
+
+type Snapshot struct {
+	Time       time.Time
+	Grids      []*govrageremote.VRageRemoteGrid      `json:",omitempty"`
+	Characters []*govrageremote.VRageRemoteCharacter `json:",omitempty"`
+	Players    []*govrageremote.VRageRemotePlayer    // nil if players were not recorded
+	Chat       []*govrageremote.VRageChatMessage     `json:",omitempty"`
+}
+
+type GridPosition struct {
+	Time time.Time
+	Grid *govrageremote.VRageRemoteGrid
+}
+
+type CharacterPosition struct {
+	Time      time.Time
+	Character *govrageremote.VRageRemoteCharacter
+}
+
+type Session struct {
+	Start time.Time
+	End   time.Time
+}
+
+func (session Session) Duration() time.Duration {
+	return session.End.Sub(session.Start)
+}
+
+type Store struct {
+	path        string
+	file        *os.File
+	snapshots   []*Snapshot
+	chatKeys    map[string]time.Time // the messages stored, with the time they were sent
+	chatHorizon time.Time            // older messages were pruned or came before the store
+	mutex       sync.RWMutex
+}
+
+// Add appends a snapshot to the store. Chat messages already stored by a previous
+// snapshot are dropped, so the whole chat history can be passed every time.
+// Messages older than the oldest snapshot or the last Prune are dropped as well.
+func (store *Store) Add(snapshot *Snapshot) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	var chat []*govrageremote.VRageChatMessage
+	for _, message := range snapshot.Chat {
+		t := message.Time()
+		if t.Before(store.chatHorizon) {
+			continue
+		}
+		key := chatKey(message)
+		if _, ok := store.chatKeys[key]; ok {
+			continue
+		}
+		store.chatKeys[key] = t
+		chat = append(chat, message)
+	}
+	snapshot.Chat = chat
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if _, err := store.file.Write(data); err != nil {
+		return err
+	}
+
+	store.insert(snapshot)
+	return nil
+}
+
+// GridTrack returns the positions of a grid between from and to, oldest first
+func (store *Store) GridTrack(entityID govrageremote.EntityID, from time.Time, to time.Time) []*GridPosition {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	var track []*GridPosition
+	for _, snapshot := range store.between(from, to) {
+		for _, grid := range snapshot.Grids {
+			if grid.EntityID == entityID {
+				track = append(track, &GridPosition{Time: snapshot.Time, Grid: grid})
+				break
+			}
+		}
+	}
+	return track
+}
+
+// GridAt returns the last known state of a grid at the given time
+func (store *Store) GridAt(entityID govrageremote.EntityID, at time.Time) *GridPosition {
+	track := store.GridTrack(entityID, time.Time{}, at)
+	if len(track) == 0 {
+		return nil
+	}
+	return track[len(track)-1]
+}
+
+// CharacterTrack returns the positions of a character between from and to, oldest first
+func (store *Store) CharacterTrack(entityID govrageremote.EntityID, from time.Time, to time.Time) []*CharacterPosition {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	var track []*CharacterPosition
+	for _, snapshot := range store.between(from, to) {
+		for _, character := range snapshot.Characters {
+			if character.EntityID == entityID {
+				track = append(track, &CharacterPosition{Time: snapshot.Time, Character: character})
+				break
+			}
+		}
+	}
+	return track
+}
+
+// PlayerSessions returns the periods in which a player was seen online. A session
+// ends when the player is missing from a snapshot or when two snapshots are more
+// than maxGap apart. Interval is the time between two snapshots, a player counts
+// as online for up to interval after the last snapshot showing them, so a player
+// seen once played for one interval.
+func (store *Store) PlayerSessions(steamID govrageremote.SteamID, from time.Time, to time.Time, interval time.Duration, maxGap time.Duration) []Session {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	var sessions []Session
+	var current *Session // End is the last snapshot showing the player until the session is closed
+	closeSession := func(next time.Time) {
+		current.End = current.End.Add(interval)
+		if !next.IsZero() && next.Before(current.End) {
+			current.End = next
+		}
+		sessions = append(sessions, *current)
+		current = nil
+	}
+	for _, snapshot := range store.between(from, to) {
+		if snapshot.Players == nil {
+			continue // snapshot without player data
+		}
+
+		online := false
+		for _, player := range snapshot.Players {
+			if player.SteamID == steamID {
+				online = true
+				break
+			}
+		}
+
+		if current != nil && (!online || snapshot.Time.Sub(current.End) > maxGap) {
+			closeSession(snapshot.Time)
+		}
+		if online {
+			if current == nil {
+				current = &Session{Start: snapshot.Time}
+			}
+			current.End = snapshot.Time
+		}
+	}
+	if current != nil {
+		closeSession(time.Time{})
+	}
+	return sessions
+}
+
+// PlayTime sums the duration of all sessions of a player between from and to
+func (store *Store) PlayTime(steamID govrageremote.SteamID, from time.Time, to time.Time, interval time.Duration, maxGap time.Duration) time.Duration {
+	var total time.Duration
+	for _, session := range store.PlayerSessions(steamID, from, to, interval, maxGap) {
+		total += session.Duration()
+	}
+	return total
+}
+
+// Chat returns the chat messages stored between from and to. If steamID is not
+// zero only messages of that player are returned.
+func (store *Store) Chat(steamID govrageremote.SteamID, from time.Time, to time.Time) []*govrageremote.VRageChatMessage {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	var messages []*govrageremote.VRageChatMessage
+	for _, snapshot := range store.snapshots {
+		for _, message := range snapshot.Chat {
+			if steamID != 0 && message.SteamID != steamID {
+				continue
+			}
+			t := message.Time()
+			if t.Before(from) || (!to.IsZero() && t.After(to)) {
+				continue
+			}
+			messages = append(messages, message)
+		}
+	}
+	return messages
+}
+
+// Oldest returns the time of the oldest stored snapshot, zero if the store is empty
+func (store *Store) Oldest() time.Time {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	if len(store.snapshots) == 0 {
+		return time.Time{}
+	}
+	return store.snapshots[0].Time
+}
+
+// Prune drops all snapshots taken before the given time and compacts the file.
+// Chat messages sent before it are forgotten and not stored again.
+func (store *Store) Prune(before time.Time) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	keep := store.between(before, time.Time{})
+	if len(keep) == len(store.snapshots) {
+		return nil
+	}
+
+	// the file is replaced atomically, a crash leaves either the old or the new one
+	tmp, err := os.CreateTemp(filepath.Dir(store.path), filepath.Base(store.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	writer := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(writer)
+	for _, snapshot := range keep {
+		if err := encoder.Encode(snapshot); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), store.path); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(store.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	store.file.Close()
+	store.file = file
+	store.snapshots = append([]*Snapshot(nil), keep...)
+
+	for key, t := range store.chatKeys {
+		if t.Before(before) {
+			delete(store.chatKeys, key)
+		}
+	}
+	if before.After(store.chatHorizon) {
+		store.chatHorizon = before
+	}
+	return nil
+}
+
+func (store *Store) Close() error {
+	return store.file.Close()
+}
+
+// between expects the read lock to be held. A zero to means no upper bound.
+func (store *Store) between(from time.Time, to time.Time) []*Snapshot {
+	start := sort.Search(len(store.snapshots), func(i int) bool {
+		return !store.snapshots[i].Time.Before(from)
+	})
+	end := len(store.snapshots)
+	if !to.IsZero() {
+		end = sort.Search(len(store.snapshots), func(i int) bool {
+			return store.snapshots[i].Time.After(to)
+		})
+	}
+	if end < start {
+		return nil
+	}
+	return store.snapshots[start:end]
+}
+
+// insert keeps the snapshots ordered by time
+func (store *Store) insert(snapshot *Snapshot) {
+	i := sort.Search(len(store.snapshots), func(i int) bool {
+		return store.snapshots[i].Time.After(snapshot.Time)
+	})
+	store.snapshots = append(store.snapshots, nil)
+	copy(store.snapshots[i+1:], store.snapshots[i:])
+	store.snapshots[i] = snapshot
+}
+
+func chatKey(message *govrageremote.VRageChatMessage) string {
+	data, _ := json.Marshal(message)
+	return string(data)
+}
+
+// Open opens or creates the store at path and loads all stored snapshots
+func Open(path string) (*Store, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	store := &Store{
+		path:     path,
+		chatKeys: make(map[string]time.Time),
+	}
+
+	reader := bufio.NewReaderSize(file, 64*1024)
+	var good int64 // offset behind the last complete line
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break // a torn last line after a crash, it is cut off below
+		}
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		good += int64(len(line))
+
+		snapshot := &Snapshot{}
+		if len(bytes.TrimSpace(line)) == 0 || json.Unmarshal(line, snapshot) != nil {
+			continue
+		}
+		for _, message := range snapshot.Chat {
+			store.chatKeys[chatKey(message)] = message.Time()
+		}
+		store.insert(snapshot)
+	}
+	file.Close()
+
+	// messages older than the oldest snapshot are either stored with it or were pruned
+	if len(store.snapshots) > 0 {
+		store.chatHorizon = store.snapshots[0].Time
+	}
+
+	// cutting off the torn line keeps the next snapshot from being appended to it
+	if err := os.Truncate(path, good); err != nil {
+		return nil, err
+	}
+	if store.file, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
@@ -0,0 +1,256 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package history
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/uranoxyd/govrageremote.v2"
+)
+
+var start = time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func minute(n int) time.Time {
+	return start.Add(time.Duration(n) * time.Minute)
+}
+
+func openStore(t *testing.T, path string) *Store {
+	store, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func chatMessage(content string, sent time.Time) *govrageremote.VRageChatMessage {
+	return &govrageremote.VRageChatMessage{SteamID: 1, Content: content, Timestamp: govrageremote.DotNetTicksFromTime(sent)}
+}
+
+func contents(messages []*govrageremote.VRageChatMessage) string {
+	var texts []string
+	for _, message := range messages {
+		texts = append(texts, message.Content)
+	}
+	return strings.Join(texts, ",")
+}
+
+func TestOpenTornLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	good := `{"Time":"2022-01-01T12:00:00Z","Players":[]}` + "\n" +
+		"\n" +
+		`{"broken"` + "\n" +
+		`{"Time":"2022-01-01T12:01:00Z","Players":[]}` + "\n"
+	if err := ioutil.WriteFile(path, []byte(good+`{"Time":"2022-01-01T12:02:00Z","Pla`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	store := openStore(t, path)
+	if len(store.snapshots) != 2 {
+		t.Fatalf("loaded %d snapshots, want 2", len(store.snapshots))
+	}
+	data, _ := ioutil.ReadFile(path)
+	if string(data) != good {
+		t.Errorf("file after open:\n%s", data)
+	}
+
+	// the next snapshot starts on its own line
+	if err := store.Add(&Snapshot{Time: minute(2), Players: []*govrageremote.VRageRemotePlayer{}}); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+	if reopened := openStore(t, path); len(reopened.snapshots) != 3 {
+		t.Errorf("reopened store has %d snapshots, want 3", len(reopened.snapshots))
+	}
+}
+
+func TestChatDeduplication(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	store := openStore(t, path)
+
+	hello, again := chatMessage("hello", minute(0)), chatMessage("again", minute(1))
+	store.Add(&Snapshot{Time: minute(0), Chat: []*govrageremote.VRageChatMessage{hello}})
+	store.Add(&Snapshot{Time: minute(1), Chat: []*govrageremote.VRageChatMessage{hello, again}})
+	if got := contents(store.Chat(0, time.Time{}, time.Time{})); got != "hello,again" {
+		t.Errorf("stored %s", got)
+	}
+	store.Close()
+
+	// the stored messages are known after reopening
+	store = openStore(t, path)
+	store.Add(&Snapshot{Time: minute(2), Chat: []*govrageremote.VRageChatMessage{hello, again, chatMessage("new", minute(2))}})
+	if got := contents(store.Chat(0, time.Time{}, time.Time{})); got != "hello,again,new" {
+		t.Errorf("stored %s", got)
+	}
+
+	tests := []struct {
+		steamID  govrageremote.SteamID
+		from, to time.Time
+		want     string
+	}{
+		{0, minute(1), time.Time{}, "again,new"},
+		{0, time.Time{}, minute(1), "hello,again"},
+		{1, minute(1), minute(1), "again"},
+		{2, time.Time{}, time.Time{}, ""},
+	}
+	for _, test := range tests {
+		if got := contents(store.Chat(test.steamID, test.from, test.to)); got != test.want {
+			t.Errorf("Chat(%d, %s, %s) = %s, want %s", test.steamID, test.from, test.to, got, test.want)
+		}
+	}
+}
+
+func TestPrune(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	store := openStore(t, path)
+
+	var history []*govrageremote.VRageChatMessage
+	for i := 0; i < 10; i++ {
+		history = append(history, chatMessage(string(rune('a'+i)), minute(i)))
+		store.Add(&Snapshot{Time: minute(i), Chat: history})
+	}
+	if err := store.Prune(minute(7)); err != nil {
+		t.Fatal(err)
+	}
+
+	if !store.Oldest().Equal(minute(7)) || len(store.snapshots) != 3 {
+		t.Errorf("kept %d snapshots from %s", len(store.snapshots), store.Oldest())
+	}
+	if len(store.chatKeys) != 3 {
+		t.Errorf("kept %d chat keys, want 3", len(store.chatKeys))
+	}
+
+	// the pruned messages are still sent by the server but not stored again
+	store.Add(&Snapshot{Time: minute(10), Chat: append(history, chatMessage("k", minute(10)))})
+	if got := contents(store.Chat(0, time.Time{}, time.Time{})); got != "h,i,j,k" {
+		t.Errorf("stored %s", got)
+	}
+	store.Close()
+
+	store = openStore(t, path)
+	if len(store.snapshots) != 4 {
+		t.Errorf("compacted file holds %d snapshots, want 4", len(store.snapshots))
+	}
+	store.Add(&Snapshot{Time: minute(11), Chat: history})
+	if got := contents(store.Chat(0, time.Time{}, time.Time{})); got != "h,i,j,k" {
+		t.Errorf("stored %s after reopening", got)
+	}
+
+	// pruning nothing keeps the file
+	info, _ := os.Stat(path)
+	if err := store.Prune(minute(0)); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := os.Stat(path); !after.ModTime().Equal(info.ModTime()) || after.Size() != info.Size() {
+		t.Error("pruning nothing rewrote the file")
+	}
+}
+
+func TestPlayerSessions(t *testing.T) {
+	player := &govrageremote.VRageRemotePlayer{SteamID: 1}
+	// who was online at every minute, "-" marks a snapshot without player data
+	online := []string{"1", "1", "", "1", "-", "1", "", "", "1"}
+
+	store := openStore(t, filepath.Join(t.TempDir(), "history.jsonl"))
+	for i, who := range online {
+		snapshot := &Snapshot{Time: minute(i)}
+		switch who {
+		case "1":
+			snapshot.Players = []*govrageremote.VRageRemotePlayer{player}
+		case "":
+			snapshot.Players = []*govrageremote.VRageRemotePlayer{}
+		}
+		store.Add(snapshot)
+	}
+	// a gap of 20 minutes ends the session even though the player is seen again
+	store.Add(&Snapshot{Time: minute(28), Players: []*govrageremote.VRageRemotePlayer{player}})
+	store.Add(&Snapshot{Time: minute(29), Players: []*govrageremote.VRageRemotePlayer{player}})
+
+	tests := []struct {
+		interval time.Duration
+		maxGap   time.Duration
+		from, to time.Time
+		want     []Session
+	}{
+		{
+			time.Minute, 5 * time.Minute, time.Time{}, time.Time{},
+			[]Session{{minute(0), minute(2)}, {minute(3), minute(6)}, {minute(8), minute(9)}, {minute(28), minute(30)}},
+		},
+		{
+			// the next snapshot ends a session before the interval does
+			10 * time.Minute, 5 * time.Minute, time.Time{}, time.Time{},
+			[]Session{{minute(0), minute(2)}, {minute(3), minute(6)}, {minute(8), minute(18)}, {minute(28), minute(39)}},
+		},
+		{
+			time.Minute, 30 * time.Minute, minute(7), minute(28),
+			[]Session{{minute(8), minute(29)}},
+		},
+		{
+			time.Minute, time.Minute, minute(3), minute(5),
+			[]Session{{minute(3), minute(4)}, {minute(5), minute(6)}},
+		},
+	}
+	for _, test := range tests {
+		got := store.PlayerSessions(1, test.from, test.to, test.interval, test.maxGap)
+		if len(got) != len(test.want) {
+			t.Errorf("interval %s, gap %s: sessions %v, want %v", test.interval, test.maxGap, got, test.want)
+			continue
+		}
+		for i := range got {
+			if !got[i].Start.Equal(test.want[i].Start) || !got[i].End.Equal(test.want[i].End) {
+				t.Errorf("interval %s, gap %s: sessions %v, want %v", test.interval, test.maxGap, got, test.want)
+				break
+			}
+		}
+	}
+
+	if got := store.PlayTime(1, time.Time{}, time.Time{}, time.Minute, 5*time.Minute); got != 8*time.Minute {
+		t.Errorf("PlayTime = %s, want 8m", got)
+	}
+	if got := store.PlayTime(2, time.Time{}, time.Time{}, time.Minute, 5*time.Minute); got != 0 {
+		t.Errorf("PlayTime of a stranger = %s", got)
+	}
+}
+
+func TestGridTrack(t *testing.T) {
+	store := openStore(t, filepath.Join(t.TempDir(), "history.jsonl"))
+	// snapshots may be added out of order
+	for _, i := range []int{2, 0, 1, 3} {
+		grids := []*govrageremote.VRageRemoteGrid{{EntityID: 7, DisplayName: string(rune('a' + i))}}
+		if i == 1 {
+			grids = nil
+		}
+		store.Add(&Snapshot{Time: minute(i), Grids: grids})
+	}
+
+	var names []string
+	for _, position := range store.GridTrack(7, minute(0), minute(2)) {
+		names = append(names, position.Grid.DisplayName)
+	}
+	if strings.Join(names, ",") != "a,c" {
+		t.Errorf("track %v", names)
+	}
+	if position := store.GridAt(7, minute(1)); position == nil || !position.Time.Equal(minute(0)) {
+		t.Errorf("GridAt = %v", position)
+	}
+	if position := store.GridAt(8, minute(3)); position != nil {
+		t.Errorf("GridAt of an unknown grid = %v", position)
+	}
+}
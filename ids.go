@@ -0,0 +1,338 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package govrageremote
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+//--
+//-- Steam IDs
+//--
+
+type SteamUniverse uint8
+
+const (
+	SteamUniverseInvalid  SteamUniverse = 0
+	SteamUniversePublic   SteamUniverse = 1
+	SteamUniverseBeta     SteamUniverse = 2
+	SteamUniverseInternal SteamUniverse = 3
+	SteamUniverseDev      SteamUniverse = 4
+)
+
+type SteamAccountType uint8
+
+const (
+	SteamAccountInvalid        SteamAccountType = 0
+	SteamAccountIndividual     SteamAccountType = 1
+	SteamAccountMultiseat      SteamAccountType = 2
+	SteamAccountGameServer     SteamAccountType = 3
+	SteamAccountAnonGameServer SteamAccountType = 4
+	SteamAccountPending        SteamAccountType = 5
+	SteamAccountContentServer  SteamAccountType = 6
+	SteamAccountClan           SteamAccountType = 7
+	SteamAccountChat           SteamAccountType = 8
+	SteamAccountConsoleUser    SteamAccountType = 9
+	SteamAccountAnonUser       SteamAccountType = 10
+)
+
+// steamAccountLetters are the type letters used by the SteamID3 format. Steam
+// has no letter for console users and writes them like invalid ids.
+var steamAccountLetters = map[SteamAccountType]string{
+	SteamAccountInvalid:        "I",
+	SteamAccountIndividual:     "U",
+	SteamAccountMultiseat:      "M",
+	SteamAccountGameServer:     "G",
+	SteamAccountAnonGameServer: "A",
+	SteamAccountPending:        "P",
+	SteamAccountContentServer:  "C",
+	SteamAccountClan:           "g",
+	SteamAccountChat:           "T",
+	SteamAccountConsoleUser:    "I",
+	SteamAccountAnonUser:       "a",
+}
+
+// steamLetterAccounts maps the SteamID3 letters back, "I" is read as invalid and
+// the chat letters "c" and "L" mark clan and lobby chats
+var steamLetterAccounts = map[string]SteamAccountType{
+	"I": SteamAccountInvalid,
+	"U": SteamAccountIndividual,
+	"M": SteamAccountMultiseat,
+	"G": SteamAccountGameServer,
+	"A": SteamAccountAnonGameServer,
+	"P": SteamAccountPending,
+	"C": SteamAccountContentServer,
+	"g": SteamAccountClan,
+	"T": SteamAccountChat,
+	"c": SteamAccountChat,
+	"L": SteamAccountChat,
+	"a": SteamAccountAnonUser,
+}
+
+// instance flags of chat ids
+const (
+	steamChatInstanceClan  = 0x80000
+	steamChatInstanceLobby = 0x40000
+)
+
+// the instance of individual accounts, Steam uses it for the desktop client
+const steamDesktopInstance = 1
+
+// SteamID identifies a Steam account, it is stored in the SteamID64 layout
+//
+//	universe (8 bit) | account type (4 bit) | instance (20 bit) | account id (32 bit)
+type SteamID uint64
+
+// NewIndividualSteamID builds the SteamID of a regular player account in the public universe
+func NewIndividualSteamID(accountID uint32) SteamID {
+	return NewSteamID(SteamUniversePublic, SteamAccountIndividual, steamDesktopInstance, accountID)
+}
+
+func NewSteamID(universe SteamUniverse, accountType SteamAccountType, instance uint32, accountID uint32) SteamID {
+	return SteamID(uint64(universe)<<56 | uint64(accountType&0xf)<<52 | uint64(instance&0xfffff)<<32 | uint64(accountID))
+}
+
+func (id SteamID) Universe() SteamUniverse {
+	return SteamUniverse(id >> 56)
+}
+
+func (id SteamID) AccountType() SteamAccountType {
+	return SteamAccountType(id >> 52 & 0xf)
+}
+
+func (id SteamID) Instance() uint32 {
+	return uint32(id >> 32 & 0xfffff)
+}
+
+func (id SteamID) AccountID() uint32 {
+	return uint32(id)
+}
+
+// IsValid checks universe, account type and instance the same way Steam does
+func (id SteamID) IsValid() bool {
+	if id.Universe() == SteamUniverseInvalid || id.Universe() > SteamUniverseDev {
+		return false
+	}
+	accountType := id.AccountType()
+	if accountType == SteamAccountInvalid || accountType > SteamAccountAnonUser {
+		return false
+	}
+	switch accountType {
+	case SteamAccountIndividual:
+		return id.AccountID() != 0 && id.Instance() <= 4
+	case SteamAccountClan:
+		return id.AccountID() != 0 && id.Instance() == 0
+	case SteamAccountGameServer:
+		return id.AccountID() != 0
+	}
+	return true
+}
+
+// IsIndividual reports whether the id belongs to a player account
+func (id SteamID) IsIndividual() bool {
+	return id.AccountType() == SteamAccountIndividual
+}
+
+// String returns the SteamID64
+func (id SteamID) String() string {
+	return strconv.FormatUint(uint64(id), 10)
+}
+
+// SteamID3 formats the id like [U:1:22202]
+func (id SteamID) SteamID3() string {
+	letter, ok := steamAccountLetters[id.AccountType()]
+	if !ok {
+		letter = "I"
+	}
+	if id.AccountType() == SteamAccountChat {
+		switch {
+		case id.Instance()&steamChatInstanceClan != 0:
+			letter = "c"
+		case id.Instance()&steamChatInstanceLobby != 0:
+			letter = "L"
+		}
+	}
+	if id.AccountType() == SteamAccountIndividual && id.Instance() != steamDesktopInstance {
+		return fmt.Sprintf("[%s:%d:%d:%d]", letter, id.Universe(), id.AccountID(), id.Instance())
+	}
+	return fmt.Sprintf("[%s:%d:%d]", letter, id.Universe(), id.AccountID())
+}
+
+// SteamID2 formats the id like STEAM_1:0:11101, only meaningful for individual accounts
+func (id SteamID) SteamID2() string {
+	return fmt.Sprintf("STEAM_%d:%d:%d", id.Universe(), id.AccountID()&1, id.AccountID()>>1)
+}
+
+func (id SteamID) ProfileURL() string {
+	return "https://steamcommunity.com/profiles/" + id.String()
+}
+
+// MarshalJSON writes the id as a string, JavaScript numbers can not hold it.
+// UnmarshalJSON accepts strings and numbers.
+func (id SteamID) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + id.String() + `"`), nil
+}
+
+func (id *SteamID) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	text := string(data)
+	if len(data) > 0 && data[0] == '"' {
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+	}
+	// the server sends 0 for unowned grids, so plain numbers are taken as they are
+	if value, err := strconv.ParseUint(text, 10, 64); err == nil {
+		*id = SteamID(value)
+		return nil
+	}
+	parsed, err := ParseSteamID(text)
+	if err != nil {
+		return err
+	}
+	*id = parsed
+	return nil
+}
+
+var (
+	steamID2Pattern   = regexp.MustCompile(`^STEAM_([0-5]):([01]):(\d+)$`)
+	steamID3Pattern   = regexp.MustCompile(`^\[?([IUMGAPCgTLca]):([0-5]):(\d+)(?::(\d+))?\]?$`)
+	steamProfileRegex = regexp.MustCompile(`^(?:https?://)?steamcommunity\.com/profiles/(\d+)/?$`)
+)
+
+// ParseSteamID accepts SteamID64, SteamID3 ([U:1:22202]), SteamID2 (STEAM_0:0:11101)
+// and steamcommunity.com/profiles/ URLs. Vanity URLs (/id/name) need the Steam Web
+// API to be resolved and are rejected.
+func ParseSteamID(text string) (SteamID, error) {
+	text = strings.TrimSpace(text)
+
+	if match := steamProfileRegex.FindStringSubmatch(text); match != nil {
+		text = match[1]
+	}
+	if strings.Contains(text, "steamcommunity.com/id/") {
+		return 0, errors.New("steam vanity urls can not be resolved: " + text)
+	}
+
+	if value, err := strconv.ParseUint(text, 10, 64); err == nil {
+		id := SteamID(value)
+		// plain account ids are what the SteamID3 format shows, so accept them as well
+		if value <= 0xffffffff {
+			id = NewIndividualSteamID(uint32(value))
+		}
+		if !id.IsValid() {
+			return 0, errors.New("invalid steam id: " + text)
+		}
+		return id, nil
+	}
+
+	if match := steamID2Pattern.FindStringSubmatch(text); match != nil {
+		y, err := strconv.ParseUint(match[2], 10, 1)
+		if err != nil {
+			return 0, errors.New("invalid steam id: " + text)
+		}
+		// the account id is z*2+y, so z has one bit less
+		z, err := strconv.ParseUint(match[3], 10, 31)
+		if err != nil {
+			return 0, errors.New("invalid steam id: " + text)
+		}
+		// STEAM_0 is how older games wrote the public universe
+		return NewIndividualSteamID(uint32(z*2 + y)), nil
+	}
+
+	if match := steamID3Pattern.FindStringSubmatch(text); match != nil {
+		accountType := steamLetterAccounts[match[1]]
+		universe, err := strconv.ParseUint(match[2], 10, 8)
+		if err != nil {
+			return 0, errors.New("invalid steam id: " + text)
+		}
+		accountID, err := strconv.ParseUint(match[3], 10, 32)
+		if err != nil {
+			return 0, errors.New("invalid steam id: " + text)
+		}
+		var instance uint64
+		if accountType == SteamAccountIndividual {
+			instance = steamDesktopInstance
+		}
+		switch match[1] {
+		case "c":
+			instance = steamChatInstanceClan
+		case "L":
+			instance = steamChatInstanceLobby
+		}
+		if match[4] != "" {
+			instance, err = strconv.ParseUint(match[4], 10, 20)
+			if err != nil {
+				return 0, errors.New("invalid steam id: " + text)
+			}
+		}
+		id := NewSteamID(SteamUniverse(universe), accountType, uint32(instance), uint32(accountID))
+		if !id.IsValid() {
+			return 0, errors.New("invalid steam id: " + text)
+		}
+		return id, nil
+	}
+
+	return 0, errors.New("invalid steam id: " + text)
+}
+
+//--
+//-- Entity IDs
+//--
+
+// EntityID identifies an entity like a grid, character or floating object in the world
+type EntityID int64
+
+func (id EntityID) String() string {
+	return strconv.FormatInt(int64(id), 10)
+}
+
+// MarshalJSON writes the id as a string like SteamID does
+func (id EntityID) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + id.String() + `"`), nil
+}
+
+func (id *EntityID) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	text := string(data)
+	if len(data) > 0 && data[0] == '"' {
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+	}
+	parsed, err := ParseEntityID(text)
+	if err != nil {
+		return err
+	}
+	*id = parsed
+	return nil
+}
+
+func ParseEntityID(text string) (EntityID, error) {
+	value, err := strconv.ParseInt(strings.TrimSpace(text), 10, 64)
+	if err != nil {
+		return 0, errors.New("invalid entity id: " + text)
+	}
+	return EntityID(value), nil
+}
@@ -0,0 +1,197 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package govrageremote
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// gabe is the SteamID of account 22202, STEAM_0:0:11101
+const gabe SteamID = 76561197960287930
+
+func TestParseSteamID(t *testing.T) {
+	tests := []struct {
+		text string
+		id   SteamID
+		ok   bool
+	}{
+		{"76561197960287930", gabe, true},
+		{" 76561197960287930 ", gabe, true},
+		{"22202", gabe, true},
+		{"[U:1:22202]", gabe, true},
+		{"U:1:22202", gabe, true},
+		{"[U:1:22202:4]", NewSteamID(SteamUniversePublic, SteamAccountIndividual, 4, 22202), true},
+		{"[g:1:4]", NewSteamID(SteamUniversePublic, SteamAccountClan, 0, 4), true},
+		{"[c:1:4]", NewSteamID(SteamUniversePublic, SteamAccountChat, steamChatInstanceClan, 4), true},
+		{"[L:1:4]", NewSteamID(SteamUniversePublic, SteamAccountChat, steamChatInstanceLobby, 4), true},
+		{"STEAM_0:0:11101", gabe, true},
+		{"STEAM_1:0:11101", gabe, true},
+		{"STEAM_0:1:11101", gabe + 1, true},
+		{"https://steamcommunity.com/profiles/76561197960287930/", gabe, true},
+		{"http://steamcommunity.com/profiles/76561197960287930", gabe, true},
+		{"steamcommunity.com/profiles/76561197960287930", gabe, true},
+
+		{"", 0, false},
+		{"gabe", 0, false},
+		{"0", 0, false},
+		{"-1", 0, false},
+		{"https://steamcommunity.com/id/gabelogannewell", 0, false},
+		{"https://steamcommunity.com/profiles/0", 0, false},
+		{"STEAM_0:2:11101", 0, false},
+		{"STEAM_0:0:2147483648", 0, false},
+		{"STEAM_0:0:99999999999999999999", 0, false},
+		{"[U:1:4294967296]", 0, false},
+		{"[U:1:22202:5]", 0, false},
+		{"[U:1:22202:1048576]", 0, false},
+		{"[U:1:22202:99999999999999999999]", 0, false},
+		{"[U:0:22202]", 0, false},
+		{"[U:6:22202]", 0, false},
+		{"[g:1:4:1]", 0, false},
+		{"[X:1:22202]", 0, false},
+	}
+	for _, test := range tests {
+		id, err := ParseSteamID(test.text)
+		if !test.ok {
+			if err == nil {
+				t.Errorf("ParseSteamID(%q) = %d, want an error", test.text, id)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseSteamID(%q): %v", test.text, err)
+		} else if id != test.id {
+			t.Errorf("ParseSteamID(%q) = %d, want %d", test.text, id, test.id)
+		}
+	}
+}
+
+func TestSteamIDFormats(t *testing.T) {
+	tests := []struct {
+		id      SteamID
+		steamID string
+		steam3  string
+		steam2  string
+	}{
+		{gabe, "76561197960287930", "[U:1:22202]", "STEAM_1:0:11101"},
+		{gabe + 1, "76561197960287931", "[U:1:22203]", "STEAM_1:1:11101"},
+		{NewSteamID(SteamUniversePublic, SteamAccountIndividual, 4, 22202), "76561210845189818", "[U:1:22202:4]", "STEAM_1:0:11101"},
+		{NewSteamID(SteamUniversePublic, SteamAccountClan, 0, 4), "103582791429521412", "[g:1:4]", "STEAM_1:0:2"},
+		{NewSteamID(SteamUniversePublic, SteamAccountChat, steamChatInstanceClan, 4), "110338190870577156", "[c:1:4]", "STEAM_1:0:2"},
+	}
+	for _, test := range tests {
+		if got := test.id.String(); got != test.steamID {
+			t.Errorf("%d String() = %s, want %s", test.id, got, test.steamID)
+		}
+		if got := test.id.SteamID3(); got != test.steam3 {
+			t.Errorf("%d SteamID3() = %s, want %s", test.id, got, test.steam3)
+		}
+		if got := test.id.SteamID2(); got != test.steam2 {
+			t.Errorf("%d SteamID2() = %s, want %s", test.id, got, test.steam2)
+		}
+
+		// every format parses back to the same id, SteamID2 only for desktop players
+		texts := []string{test.id.String(), test.id.SteamID3(), test.id.ProfileURL()}
+		if test.id.IsIndividual() && test.id.Instance() == steamDesktopInstance {
+			texts = append(texts, test.id.SteamID2())
+		}
+		for _, text := range texts {
+			if parsed, err := ParseSteamID(text); err != nil || parsed != test.id {
+				t.Errorf("ParseSteamID(%q) = %d, %v, want %d", text, parsed, err, test.id)
+			}
+		}
+	}
+}
+
+func TestSteamIDIsValid(t *testing.T) {
+	tests := []struct {
+		id    SteamID
+		valid bool
+	}{
+		{gabe, true},
+		{0, false},
+		{NewSteamID(SteamUniverseInvalid, SteamAccountIndividual, 1, 22202), false},
+		{NewSteamID(SteamUniverseDev, SteamAccountIndividual, 1, 22202), true},
+		{NewSteamID(SteamUniverseDev+1, SteamAccountIndividual, 1, 22202), false},
+		{NewSteamID(SteamUniversePublic, SteamAccountInvalid, 1, 22202), false},
+		{NewSteamID(SteamUniversePublic, SteamAccountAnonUser, 0, 0), true},
+		{NewSteamID(SteamUniversePublic, SteamAccountAnonUser+1, 0, 22202), false},
+		{NewSteamID(SteamUniversePublic, SteamAccountIndividual, 1, 0), false},
+		{NewSteamID(SteamUniversePublic, SteamAccountIndividual, 4, 22202), true},
+		{NewSteamID(SteamUniversePublic, SteamAccountIndividual, 5, 22202), false},
+		{NewSteamID(SteamUniversePublic, SteamAccountClan, 0, 4), true},
+		{NewSteamID(SteamUniversePublic, SteamAccountClan, 1, 4), false},
+		{NewSteamID(SteamUniversePublic, SteamAccountClan, 0, 0), false},
+		{NewSteamID(SteamUniversePublic, SteamAccountGameServer, 7, 4), true},
+		{NewSteamID(SteamUniversePublic, SteamAccountGameServer, 7, 0), false},
+	}
+	for _, test := range tests {
+		if got := test.id.IsValid(); got != test.valid {
+			t.Errorf("%d (%s) IsValid() = %t, want %t", test.id, test.id.SteamID3(), got, test.valid)
+		}
+	}
+}
+
+func TestIDJSON(t *testing.T) {
+	type ids struct {
+		Steam  SteamID
+		Entity EntityID
+	}
+
+	data, err := json.Marshal(ids{gabe, -42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"Steam":"76561197960287930","Entity":"-42"}` {
+		t.Errorf("marshalled %s", data)
+	}
+
+	tests := []struct {
+		data string
+		want ids
+		ok   bool
+	}{
+		{`{"Steam":"76561197960287930","Entity":"-42"}`, ids{gabe, -42}, true},
+		{`{"Steam":76561197960287930,"Entity":-42}`, ids{gabe, -42}, true},
+		{`{"Steam":"[U:1:22202]","Entity":9223372036854775807}`, ids{gabe, 9223372036854775807}, true},
+		{`{"Steam":0,"Entity":0}`, ids{0, 0}, true},
+		{`{"Steam":null,"Entity":null}`, ids{}, true},
+		{`{"Steam":"gabe"}`, ids{}, false},
+		{`{"Entity":"grid"}`, ids{}, false},
+		{`{"Entity":9223372036854775808}`, ids{}, false},
+		{`{"Steam":true}`, ids{}, false},
+	}
+	for _, test := range tests {
+		var got ids
+		err := json.Unmarshal([]byte(test.data), &got)
+		if !test.ok {
+			if err == nil {
+				t.Errorf("%s decoded to %+v, want an error", test.data, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.data, err)
+		} else if got != test.want {
+			t.Errorf("%s decoded to %+v, want %+v", test.data, got, test.want)
+		}
+	}
+
+	// round trip through the string form
+	var back ids
+	if err := json.Unmarshal(data, &back); err != nil || back != (ids{gabe, -42}) {
+		t.Errorf("round trip gave %+v, %v", back, err)
+	}
+}
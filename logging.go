@@ -0,0 +1,93 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package govrageremote
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// VRageLogger receives structured log records as a message followed by
+// alternating keys and values. A *slog.Logger satisfies it.
+type VRageLogger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+type vrageNopLogger struct{}
+
+func (vrageNopLogger) Debug(msg string, args ...interface{}) {}
+func (vrageNopLogger) Info(msg string, args ...interface{})  {}
+func (vrageNopLogger) Warn(msg string, args ...interface{})  {}
+func (vrageNopLogger) Error(msg string, args ...interface{}) {}
+
+// SetLogger makes the client log every request at debug level, server errors
+// and failed requests at error level and requests slower than slowThreshold at
+// warn level. A nil logger disables logging.
+func (client *VRageRemoteClient) SetLogger(logger VRageLogger, slowThreshold time.Duration) {
+	if logger == nil {
+		logger = vrageNopLogger{}
+	}
+	client.logger = logger
+	client.slowThreshold = slowThreshold
+}
+
+func (client *VRageRemoteClient) log() VRageLogger {
+	if client.logger == nil {
+		return vrageNopLogger{}
+	}
+	return client.logger
+}
+
+// logRequest runs between the middlewares and the cache, so it sees the final
+// request and every response, including cached ones
+func (client *VRageRemoteClient) logRequest(request *VRageRequest, send func(request *VRageRequest) (*VRageRawResponse, error)) (*VRageRawResponse, error) {
+	logger := client.log()
+	if _, ok := logger.(vrageNopLogger); ok {
+		return send(request)
+	}
+
+	start := time.Now()
+	response, err := send(request)
+	duration := time.Since(start)
+
+	args := []interface{}{
+		"method", request.Method,
+		"resource", request.Resource,
+		"duration", duration,
+	}
+	if err != nil {
+		logger.Error("remote api request failed", append(args, "error", err.Error())...)
+		return response, err
+	}
+
+	args = append(args, "status", response.StatusCode, "cached", response.Cached)
+	if response.Meta != nil {
+		args = append(args, "apiVersion", response.Meta.ApiVersion, "queryTime", response.Meta.QueryTime)
+	}
+
+	decoded := &VRageRemoteResponse{}
+	if json.Unmarshal(response.Body, decoded) == nil && decoded.Error != nil {
+		logger.Error("remote api returned an error", append(args, "error", decoded.Error.Message)...)
+	} else if client.slowThreshold > 0 && duration > client.slowThreshold && !response.Cached {
+		logger.Warn("slow remote api response", args...)
+	} else {
+		logger.Debug("remote api request", args...)
+	}
+
+	return response, err
+}
@@ -0,0 +1,90 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package govrageremote
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// VRageRequest is a Remote API call before it is signed
+type VRageRequest struct {
+	Context  context.Context
+	Method   string
+	Resource string // path below BaseURL, like session/grids/123
+	Query    url.Values
+	Body     interface{}
+}
+
+// VRageRawResponse is the undecoded answer of the server
+type VRageRawResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	Meta       *VRageRemoteResponseMeta
+	Cached     bool // served from the response cache or shared with a concurrent request
+}
+
+// cached copies the response for another caller, nothing but the Cached flag
+// is shared so callers may modify what they get
+func (response *VRageRawResponse) cached() *VRageRawResponse {
+	copied := *response
+	copied.Cached = true
+	copied.Header = response.Header.Clone()
+	if response.Body != nil {
+		copied.Body = append([]byte(nil), response.Body...)
+	}
+	if response.Meta != nil {
+		meta := *response.Meta
+		copied.Meta = &meta
+	}
+	return &copied
+}
+
+type VRageDoer interface {
+	Do(request *VRageRequest) (*VRageRawResponse, error)
+}
+
+type VRageDoerFunc func(request *VRageRequest) (*VRageRawResponse, error)
+
+func (fnc VRageDoerFunc) Do(request *VRageRequest) (*VRageRawResponse, error) {
+	return fnc(request)
+}
+
+// VRageMiddleware wraps the execution of requests, for logging, tracing, metrics
+// or fault injection. A middleware may modify the request, answer it without
+// calling next or inspect and replace the response.
+type VRageMiddleware func(next VRageDoer) VRageDoer
+
+// Use appends middlewares to the chain. The first middleware added is the
+// outermost and sees every request first.
+func (client *VRageRemoteClient) Use(middlewares ...VRageMiddleware) {
+	client.middlewareMutex.Lock()
+	defer client.middlewareMutex.Unlock()
+	client.middlewares = append(client.middlewares, middlewares...)
+}
+
+// doer returns the middleware chain wrapped around the cache, rate limiter and transport
+func (client *VRageRemoteClient) doer() VRageDoer {
+	client.middlewareMutex.RLock()
+	defer client.middlewareMutex.RUnlock()
+
+	var doer VRageDoer = VRageDoerFunc(client.do)
+	for i := len(client.middlewares) - 1; i >= 0; i-- {
+		doer = client.middlewares[i](doer)
+	}
+	return doer
+}
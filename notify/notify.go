@@ -0,0 +1,147 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package notify forwards server events to Discord or Slack compatible webhooks.
+package notify
+
+import (
+	"fmt"
+	"time"
+
+	"gopkg.in/uranoxyd/govrageremote.v2"
+)
+
+type EventKind string
+
+const (
+	EventJoin  EventKind = "join"
+	EventLeave EventKind = "leave"
+	EventBan   EventKind = "ban"
+	EventKick  EventKind = "kick"
+	EventChat  EventKind = "chat"
+	EventAlert EventKind = "alert"
+)
+
+const (
+	colorGreen  = 0x2ecc71
+	colorGrey   = 0x95a5a6
+	colorRed    = 0xe74c3c
+	colorOrange = 0xe67e22
+	colorBlue   = 0x3498db
+)
+
+type Event struct {
+	Kind  EventKind
+	Title string
+	Text  string
+	Color int
+	Time  time.Time
+}
+
+// Notifier formats server events and sends them to all webhooks interested in the event kind
+type Notifier struct {
+	Webhooks []*Webhook
+}
+
+func (notifier *Notifier) Send(event *Event) error {
+	// the event belongs to the caller, the time is only filled in on a copy
+	copied := *event
+	event = &copied
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	var firstErr error
+	for _, hook := range notifier.Webhooks {
+		if !hook.Accepts(event.Kind) {
+			continue
+		}
+		if err := hook.Send(event); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (notifier *Notifier) PlayerJoined(player *govrageremote.VRageRemotePlayer) error {
+	return notifier.Send(&Event{
+		Kind:  EventJoin,
+		Title: "Player joined",
+		Text:  playerName(player.DisplayName, player.FactionTag),
+		Color: colorGreen,
+	})
+}
+
+func (notifier *Notifier) PlayerLeft(player *govrageremote.VRageRemotePlayer) error {
+	return notifier.Send(&Event{
+		Kind:  EventLeave,
+		Title: "Player left",
+		Text:  playerName(player.DisplayName, player.FactionTag),
+		Color: colorGrey,
+	})
+}
+
+func (notifier *Notifier) PlayerBanned(player *govrageremote.VRageBannedPlayer) error {
+	return notifier.Send(&Event{
+		Kind:  EventBan,
+		Title: "Player banned",
+		Text:  fmt.Sprintf("%s (%d)", player.DisplayName, player.SteamID),
+		Color: colorRed,
+	})
+}
+
+func (notifier *Notifier) PlayerKicked(player *govrageremote.VRageKickedPlayer) error {
+	return notifier.Send(&Event{
+		Kind:  EventKick,
+		Title: "Player kicked",
+		Text:  fmt.Sprintf("%s (%d)", player.DisplayName, player.SteamID),
+		Color: colorOrange,
+	})
+}
+
+func (notifier *Notifier) Chat(message *govrageremote.VRageChatMessage) error {
+	return notifier.Send(&Event{
+		Kind:  EventChat,
+		Title: message.DisplayName,
+		Text:  message.Content,
+		Color: colorBlue,
+		Time:  message.Time(),
+	})
+}
+
+// Notify implements govrageremote.VRageAlertNotifier so a Notifier can be passed to a watchdog
+func (notifier *Notifier) Notify(alert *govrageremote.VRageAlert) error {
+	color := colorRed
+	if alert.State == govrageremote.VRageAlertResolved {
+		color = colorGreen
+	}
+	return notifier.Send(&Event{
+		Kind:  EventAlert,
+		Title: fmt.Sprintf("Alert %s: %s", alert.State, alert.Kind),
+		Text:  alert.Message,
+		Color: color,
+		Time:  alert.Time,
+	})
+}
+
+func playerName(name string, factionTag string) string {
+	if factionTag == "" {
+		return name
+	}
+	return fmt.Sprintf("[%s] %s", factionTag, name)
+}
+
+func NewNotifier(webhooks ...*Webhook) *Notifier {
+	return &Notifier{Webhooks: webhooks}
+}
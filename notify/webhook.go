@@ -0,0 +1,192 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Format string
+
+const (
+	FormatDiscord Format = "discord"
+	FormatSlack   Format = "slack"
+)
+
+// Discord rejects embed descriptions longer than this
+const discordDescriptionLimit = 4096
+
+// defaultClient is used by webhooks created without NewDiscordWebhook or NewSlackWebhook
+var defaultClient = &http.Client{Timeout: 10 * time.Second}
+
+type Webhook struct {
+	URL         string
+	Format      Format
+	Username    string
+	Kinds       []EventKind   // event kinds sent to this webhook, all kinds if empty
+	MinInterval time.Duration // minimum time between two messages
+	MaxRetries  int
+	RetryDelay  time.Duration // first retry delay, doubled on every further retry
+	httpClient  *http.Client
+	mutex       sync.Mutex
+	lastSent    time.Time
+}
+
+func (hook *Webhook) Accepts(kind EventKind) bool {
+	if len(hook.Kinds) == 0 {
+		return true
+	}
+	for _, other := range hook.Kinds {
+		if other == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// Send posts the event, waiting for MinInterval and retrying on rate limits,
+// server errors and network errors
+func (hook *Webhook) Send(event *Event) error {
+	payload, err := json.Marshal(hook.payload(event))
+	if err != nil {
+		return err
+	}
+
+	// serialized so MinInterval holds across concurrent senders
+	hook.mutex.Lock()
+	defer hook.mutex.Unlock()
+
+	delay := hook.RetryDelay
+	for attempt := 0; ; attempt++ {
+		if wait := hook.MinInterval - time.Since(hook.lastSent); wait > 0 {
+			time.Sleep(wait)
+		}
+
+		retryAfter, err := hook.post(payload)
+		hook.lastSent = time.Now()
+		if err == nil {
+			return nil
+		}
+		if retryAfter < 0 || attempt >= hook.MaxRetries {
+			return err
+		}
+
+		if retryAfter == 0 {
+			retryAfter = delay
+			delay *= 2
+		}
+		time.Sleep(retryAfter)
+	}
+}
+
+// post returns a negative retry delay if retrying makes no sense and zero if
+// the default delay should be used
+func (hook *Webhook) post(payload []byte) (time.Duration, error) {
+	httpClient := hook.httpClient
+	if httpClient == nil {
+		httpClient = defaultClient
+	}
+	response, err := httpClient.Post(hook.URL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	body, _ := ioutil.ReadAll(response.Body)
+
+	switch {
+	case response.StatusCode >= 200 && response.StatusCode <= 299:
+		return 0, nil
+	case response.StatusCode == http.StatusTooManyRequests:
+		return retryAfter(response, body), fmt.Errorf("webhook rate limited: %s", response.Status)
+	case response.StatusCode >= 500:
+		return 0, fmt.Errorf("webhook responded with %s", response.Status)
+	default:
+		return -1, fmt.Errorf("webhook responded with %s: %s", response.Status, bytes.TrimSpace(body))
+	}
+}
+
+// retryAfter reads the Retry-After header or the retry_after field Discord puts in the body
+func retryAfter(response *http.Response, body []byte) time.Duration {
+	if seconds, err := strconv.ParseFloat(response.Header.Get("Retry-After"), 64); err == nil {
+		return time.Duration(seconds * float64(time.Second))
+	}
+
+	var discord struct {
+		RetryAfter float64 `json:"retry_after"`
+	}
+	if json.Unmarshal(body, &discord) == nil && discord.RetryAfter > 0 {
+		return time.Duration(discord.RetryAfter * float64(time.Second))
+	}
+	return 0
+}
+
+// slackEscaper escapes the characters Slack reads as control sequences, so
+// players can not ping <!channel> or <!everyone> through the chat relay
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+func (hook *Webhook) payload(event *Event) interface{} {
+	if hook.Format == FormatSlack {
+		return map[string]interface{}{
+			"username": hook.Username,
+			"text":     fmt.Sprintf("*%s*\n%s", slackEscaper.Replace(event.Title), slackEscaper.Replace(event.Text)),
+		}
+	}
+
+	text := event.Text
+	if runes := []rune(text); len(runes) > discordDescriptionLimit {
+		text = string(runes[:discordDescriptionLimit])
+	}
+	return map[string]interface{}{
+		"username": hook.Username,
+		"embeds": []map[string]interface{}{
+			{
+				"title":       event.Title,
+				"description": text,
+				"color":       event.Color,
+				"timestamp":   event.Time.UTC().Format(time.RFC3339),
+			},
+		},
+		// never let players ping @everyone through the chat relay
+		"allowed_mentions": map[string]interface{}{"parse": []string{}},
+	}
+}
+
+func newWebhook(url string, format Format) *Webhook {
+	return &Webhook{
+		URL:         url,
+		Format:      format,
+		Username:    "Space Engineers",
+		MinInterval: time.Second,
+		MaxRetries:  3,
+		RetryDelay:  time.Second,
+		httpClient:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func NewDiscordWebhook(url string) *Webhook {
+	return newWebhook(url, FormatDiscord)
+}
+
+func NewSlackWebhook(url string) *Webhook {
+	return newWebhook(url, FormatSlack)
+}
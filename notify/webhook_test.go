@@ -0,0 +1,210 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package notify
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stand in records the payloads it receives and answers with the queued status codes
+type standIn struct {
+	server   *httptest.Server
+	mutex    sync.Mutex
+	statuses []int
+	payloads []map[string]interface{}
+	times    []time.Time
+}
+
+func newStandIn(t *testing.T, statuses ...int) *standIn {
+	stand := &standIn{statuses: statuses}
+	stand.server = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		stand.mutex.Lock()
+		defer stand.mutex.Unlock()
+
+		body, _ := ioutil.ReadAll(request.Body)
+		var payload map[string]interface{}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Errorf("invalid payload %q: %v", body, err)
+		}
+		stand.payloads = append(stand.payloads, payload)
+		stand.times = append(stand.times, time.Now())
+
+		status := http.StatusNoContent
+		if len(stand.statuses) > 0 {
+			status, stand.statuses = stand.statuses[0], stand.statuses[1:]
+		}
+		if status == http.StatusTooManyRequests {
+			writer.Header().Set("Retry-After", "0.05")
+		}
+		writer.WriteHeader(status)
+	}))
+	t.Cleanup(stand.server.Close)
+	return stand
+}
+
+func TestDiscordPayload(t *testing.T) {
+	stand := newStandIn(t)
+	hook := NewDiscordWebhook(stand.server.URL)
+
+	if err := hook.Send(&Event{Kind: EventChat, Title: "Alice", Text: "hello @everyone", Color: colorBlue}); err != nil {
+		t.Fatal(err)
+	}
+	if len(stand.payloads) != 1 {
+		t.Fatalf("got %d requests, want 1", len(stand.payloads))
+	}
+
+	payload := stand.payloads[0]
+	if payload["username"] != "Space Engineers" {
+		t.Errorf("username = %v", payload["username"])
+	}
+	embeds, ok := payload["embeds"].([]interface{})
+	if !ok || len(embeds) != 1 {
+		t.Fatalf("embeds = %v", payload["embeds"])
+	}
+	embed := embeds[0].(map[string]interface{})
+	if embed["title"] != "Alice" || embed["description"] != "hello @everyone" || embed["color"] != float64(colorBlue) {
+		t.Errorf("embed = %v", embed)
+	}
+	if _, err := time.Parse(time.RFC3339, embed["timestamp"].(string)); err != nil {
+		t.Errorf("timestamp: %v", err)
+	}
+	mentions := payload["allowed_mentions"].(map[string]interface{})
+	if parse := mentions["parse"].([]interface{}); len(parse) != 0 {
+		t.Errorf("allowed_mentions.parse = %v, want empty", parse)
+	}
+}
+
+func TestSlackPayload(t *testing.T) {
+	stand := newStandIn(t)
+	hook := NewSlackWebhook(stand.server.URL)
+
+	if err := hook.Send(&Event{Kind: EventJoin, Title: "Player joined", Text: "Alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if text := stand.payloads[0]["text"]; text != "*Player joined*\nAlice" {
+		t.Errorf("text = %q", text)
+	}
+}
+
+func TestSlackEscaping(t *testing.T) {
+	stand := newStandIn(t)
+	hook := NewSlackWebhook(stand.server.URL)
+
+	event := &Event{Kind: EventChat, Title: "<b>Alice</b>", Text: "hi <!channel> & <!everyone> <@U123>"}
+	if err := hook.Send(event); err != nil {
+		t.Fatal(err)
+	}
+	want := "*&lt;b&gt;Alice&lt;/b&gt;*\nhi &lt;!channel&gt; &amp; &lt;!everyone&gt; &lt;@U123&gt;"
+	if text := stand.payloads[0]["text"]; text != want {
+		t.Errorf("text = %q, want %q", text, want)
+	}
+}
+
+func TestNotifierKeepsEvent(t *testing.T) {
+	stand := newStandIn(t)
+	notifier := &Notifier{Webhooks: []*Webhook{NewDiscordWebhook(stand.server.URL)}}
+
+	event := &Event{Kind: EventAlert, Title: "alert"}
+	if err := notifier.Send(event); err != nil {
+		t.Fatal(err)
+	}
+	if !event.Time.IsZero() {
+		t.Errorf("Send changed the time of the event to %s", event.Time)
+	}
+	embed := stand.payloads[0]["embeds"].([]interface{})[0].(map[string]interface{})
+	sent, err := time.Parse(time.RFC3339, embed["timestamp"].(string))
+	if err != nil || time.Since(sent) > time.Minute {
+		t.Errorf("timestamp = %v, %v", embed["timestamp"], err)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	stand := newStandIn(t, http.StatusTooManyRequests, http.StatusTooManyRequests)
+	hook := NewDiscordWebhook(stand.server.URL)
+	hook.MinInterval = 0
+	hook.RetryDelay = time.Hour // Retry-After has to win
+
+	if err := hook.Send(&Event{Kind: EventChat, Text: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(stand.times) != 3 {
+		t.Fatalf("got %d requests, want 3", len(stand.times))
+	}
+	for i := 1; i < len(stand.times); i++ {
+		if gap := stand.times[i].Sub(stand.times[i-1]); gap < 50*time.Millisecond {
+			t.Errorf("retry %d after %s, want at least 50ms", i, gap)
+		}
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	stand := newStandIn(t, http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError)
+	hook := NewDiscordWebhook(stand.server.URL)
+	hook.MinInterval = 0
+	hook.MaxRetries = 1
+	hook.RetryDelay = time.Millisecond
+
+	if err := hook.Send(&Event{Kind: EventChat}); err == nil {
+		t.Fatal("expected an error")
+	}
+	if len(stand.payloads) != 2 {
+		t.Errorf("got %d requests, want 2", len(stand.payloads))
+	}
+}
+
+func TestClientErrorIsNotRetried(t *testing.T) {
+	stand := newStandIn(t, http.StatusBadRequest)
+	hook := NewDiscordWebhook(stand.server.URL)
+	hook.RetryDelay = time.Millisecond
+
+	if err := hook.Send(&Event{Kind: EventChat}); err == nil {
+		t.Fatal("expected an error")
+	}
+	if len(stand.payloads) != 1 {
+		t.Errorf("got %d requests, want 1", len(stand.payloads))
+	}
+}
+
+func TestMinInterval(t *testing.T) {
+	stand := newStandIn(t)
+	hook := NewDiscordWebhook(stand.server.URL)
+	hook.MinInterval = 100 * time.Millisecond
+
+	for i := 0; i < 3; i++ {
+		if err := hook.Send(&Event{Kind: EventChat}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 1; i < len(stand.times); i++ {
+		if gap := stand.times[i].Sub(stand.times[i-1]); gap < hook.MinInterval {
+			t.Errorf("message %d sent after %s, want at least %s", i, gap, hook.MinInterval)
+		}
+	}
+}
+
+func TestLiteralWebhook(t *testing.T) {
+	stand := newStandIn(t)
+	hook := &Webhook{URL: stand.server.URL}
+
+	if err := hook.Send(&Event{Kind: EventChat}); err != nil {
+		t.Fatal(err)
+	}
+}
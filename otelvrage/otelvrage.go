@@ -0,0 +1,202 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package otelvrage instruments a VRageRemoteClient with OpenTelemetry. Every
+// Remote API call produces a span and is recorded in the request counter and
+// latency histograms.
+//
+// It is a module of its own so the client does not depend on OpenTelemetry.
+package otelvrage
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	"gopkg.in/uranoxyd/govrageremote.v2"
+)
+
+const instrumentationName = "gopkg.in/uranoxyd/govrageremote.v2/otelvrage"
+
+type config struct {
+	tracerProvider trace.TracerProvider
+	meterProvider  metric.MeterProvider
+}
+
+type Option func(config *config)
+
+// WithTracerProvider uses provider instead of the global tracer provider
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(config *config) {
+		config.tracerProvider = provider
+	}
+}
+
+// WithMeterProvider uses provider instead of the global meter provider
+func WithMeterProvider(provider metric.MeterProvider) Option {
+	return func(config *config) {
+		config.meterProvider = provider
+	}
+}
+
+type instruments struct {
+	tracer    trace.Tracer
+	requests  metric.Int64Counter
+	errors    metric.Int64Counter
+	duration  metric.Float64Histogram
+	queryTime metric.Float64Histogram
+}
+
+// Middleware creates a middleware recording spans and metrics for every request
+func Middleware(options ...Option) (govrageremote.VRageMiddleware, error) {
+	config := &config{
+		tracerProvider: otel.GetTracerProvider(),
+		meterProvider:  otel.GetMeterProvider(),
+	}
+	for _, option := range options {
+		option(config)
+	}
+
+	meter := config.meterProvider.Meter(instrumentationName)
+	i := &instruments{
+		tracer: config.tracerProvider.Tracer(instrumentationName),
+	}
+
+	var err error
+	i.requests, err = meter.Int64Counter("vrage.client.requests",
+		metric.WithDescription("Remote API requests sent"))
+	if err != nil {
+		return nil, err
+	}
+	i.errors, err = meter.Int64Counter("vrage.client.errors",
+		metric.WithDescription("Remote API requests which failed or were answered with an error"))
+	if err != nil {
+		return nil, err
+	}
+	i.duration, err = meter.Float64Histogram("vrage.client.duration",
+		metric.WithDescription("Remote API request latency"), metric.WithUnit("s"))
+	if err != nil {
+		return nil, err
+	}
+	i.queryTime, err = meter.Float64Histogram("vrage.server.query_time",
+		metric.WithDescription("Query time reported by the server"), metric.WithUnit("ms"))
+	if err != nil {
+		return nil, err
+	}
+
+	return i.middleware, nil
+}
+
+// Instrument adds the middleware to client
+func Instrument(client *govrageremote.VRageRemoteClient, options ...Option) error {
+	middleware, err := Middleware(options...)
+	if err != nil {
+		return err
+	}
+	client.Use(middleware)
+	return nil
+}
+
+func (i *instruments) middleware(next govrageremote.VRageDoer) govrageremote.VRageDoer {
+	return govrageremote.VRageDoerFunc(func(request *govrageremote.VRageRequest) (*govrageremote.VRageRawResponse, error) {
+		ctx := request.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+
+		collection, entityID := splitResource(request.Resource)
+		attributes := []attribute.KeyValue{
+			attribute.String("http.request.method", request.Method),
+			attribute.String("vrage.resource", collection),
+		}
+
+		ctx, span := i.tracer.Start(ctx, request.Method+" "+collection,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(attributes...))
+		defer span.End()
+		if entityID != "" {
+			span.SetAttributes(attribute.String("vrage.entity_id", entityID))
+		}
+
+		traced := *request
+		traced.Context = ctx
+
+		start := time.Now()
+		response, err := next.Do(&traced)
+		elapsed := time.Since(start)
+
+		if err == nil {
+			span.SetAttributes(
+				attribute.Int("http.response.status_code", response.StatusCode),
+				attribute.Bool("vrage.cached", response.Cached))
+			attributes = append(attributes, attribute.Int("http.response.status_code", response.StatusCode))
+
+			if response.Meta != nil {
+				span.SetAttributes(
+					attribute.Float64("vrage.query_time_ms", response.Meta.QueryTime),
+					attribute.String("vrage.api_version", response.Meta.ApiVersion))
+				if !response.Cached {
+					i.queryTime.Record(ctx, response.Meta.QueryTime, metric.WithAttributes(attributes...))
+				}
+			}
+
+			if message := errorMessage(response); message != "" {
+				span.SetStatus(codes.Error, message)
+				i.errors.Add(ctx, 1, metric.WithAttributes(attributes...))
+			}
+		} else {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			i.errors.Add(ctx, 1, metric.WithAttributes(attributes...))
+		}
+
+		i.requests.Add(ctx, 1, metric.WithAttributes(attributes...))
+		i.duration.Record(ctx, elapsed.Seconds(), metric.WithAttributes(attributes...))
+
+		return response, err
+	})
+}
+
+// splitResource separates a trailing id, so session/grids/123 is recorded as
+// session/grids and the metrics do not get one series per entity
+func splitResource(resource string) (string, string) {
+	i := strings.LastIndex(resource, "/")
+	if i < 0 {
+		return resource, ""
+	}
+	if _, err := strconv.ParseInt(resource[i+1:], 10, 64); err != nil {
+		return resource, ""
+	}
+	return resource[:i], resource[i+1:]
+}
+
+func errorMessage(response *govrageremote.VRageRawResponse) string {
+	decoded := &govrageremote.VRageRemoteResponse{}
+	if json.Unmarshal(response.Body, decoded) == nil && decoded.Error != nil {
+		return decoded.Error.Message
+	}
+	if response.StatusCode >= 400 {
+		return strconv.Itoa(response.StatusCode) + " " + http.StatusText(response.StatusCode)
+	}
+	return ""
+}
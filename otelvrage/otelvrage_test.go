@@ -0,0 +1,217 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package otelvrage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"gopkg.in/uranoxyd/govrageremote.v2"
+)
+
+type harness struct {
+	client  *govrageremote.VRageRemoteClient
+	spans   *tracetest.SpanRecorder
+	metrics *sdkmetric.ManualReader
+}
+
+// newHarness starts a stand-in server which stops grid 123 and does not know
+// any other grid
+func newHarness(t *testing.T) *harness {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "application/json")
+		if request.URL.Path == "/vrageremote/v1/session/grids/123" {
+			writer.Write([]byte(`{"data":{},"meta":{"apiVersion":"1.0","queryTime":2.5}}`))
+			return
+		}
+		writer.WriteHeader(http.StatusNotFound)
+		writer.Write([]byte(`{"error":{"message":"grid not found"},"meta":{"apiVersion":"1.0","queryTime":0.5}}`))
+	}))
+	t.Cleanup(server.Close)
+
+	h := &harness{
+		client:  govrageremote.NewVRageRemoteClient(server.URL, "c2VjcmV0"),
+		spans:   tracetest.NewSpanRecorder(),
+		metrics: sdkmetric.NewManualReader(),
+	}
+	err := Instrument(h.client,
+		WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(h.spans))),
+		WithMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(h.metrics))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func (h *harness) collect(t *testing.T) map[string]metricdata.Metrics {
+	var data metricdata.ResourceMetrics
+	if err := h.metrics.Collect(context.Background(), &data); err != nil {
+		t.Fatal(err)
+	}
+	metrics := make(map[string]metricdata.Metrics)
+	for _, scope := range data.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			metrics[m.Name] = m
+		}
+	}
+	return metrics
+}
+
+func spanAttributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attributes := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes() {
+		attributes[kv.Key] = kv.Value
+	}
+	return attributes
+}
+
+func TestSpan(t *testing.T) {
+	h := newHarness(t)
+	if err := h.client.StopGrid(123); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := h.spans.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != "PATCH session/grids" {
+		t.Errorf("name = %q", span.Name())
+	}
+	if span.SpanKind() != trace.SpanKindClient {
+		t.Errorf("kind = %s", span.SpanKind())
+	}
+	if span.Status().Code == codes.Error {
+		t.Errorf("status = %v", span.Status())
+	}
+
+	attributes := spanAttributes(span)
+	want := map[attribute.Key]attribute.Value{
+		"http.request.method":       attribute.StringValue("PATCH"),
+		"vrage.resource":            attribute.StringValue("session/grids"),
+		"vrage.entity_id":           attribute.StringValue("123"),
+		"http.response.status_code": attribute.IntValue(200),
+		"vrage.query_time_ms":       attribute.Float64Value(2.5),
+		"vrage.api_version":         attribute.StringValue("1.0"),
+		"vrage.cached":              attribute.BoolValue(false),
+	}
+	for key, value := range want {
+		if got, ok := attributes[key]; !ok || got != value {
+			t.Errorf("%s = %v, want %v", key, got.Emit(), value.Emit())
+		}
+	}
+}
+
+func TestErrorSpan(t *testing.T) {
+	h := newHarness(t)
+	if err := h.client.StopGrid(7); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	spans := h.spans.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(spans))
+	}
+	status := spans[0].Status()
+	if status.Code != codes.Error || status.Description != "grid not found" {
+		t.Errorf("status = %v", status)
+	}
+	if code := spanAttributes(spans[0])["http.response.status_code"]; code != attribute.IntValue(404) {
+		t.Errorf("status code = %v", code.Emit())
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	h := newHarness(t)
+	h.client.StopGrid(123)
+	h.client.StopGrid(123)
+	h.client.StopGrid(7)
+
+	metrics := h.collect(t)
+
+	sum := func(name string) map[int64]int64 {
+		data, ok := metrics[name].Data.(metricdata.Sum[int64])
+		if !ok {
+			t.Fatalf("%s is %T, want a sum", name, metrics[name].Data)
+		}
+		byStatus := make(map[int64]int64)
+		for _, point := range data.DataPoints {
+			status, _ := point.Attributes.Value("http.response.status_code")
+			if resource, _ := point.Attributes.Value("vrage.resource"); resource.AsString() != "session/grids" {
+				t.Errorf("%s recorded resource %q", name, resource.AsString())
+			}
+			byStatus[status.AsInt64()] += point.Value
+		}
+		return byStatus
+	}
+
+	if requests := sum("vrage.client.requests"); requests[200] != 2 || requests[404] != 1 {
+		t.Errorf("requests by status = %v, want 2 x 200 and 1 x 404", requests)
+	}
+	if errors := sum("vrage.client.errors"); errors[200] != 0 || errors[404] != 1 {
+		t.Errorf("errors by status = %v, want 1 x 404", errors)
+	}
+
+	histogram := func(name string) (uint64, float64) {
+		data, ok := metrics[name].Data.(metricdata.Histogram[float64])
+		if !ok {
+			t.Fatalf("%s is %T, want a histogram", name, metrics[name].Data)
+		}
+		var count uint64
+		var total float64
+		for _, point := range data.DataPoints {
+			count += point.Count
+			total += point.Sum
+		}
+		return count, total
+	}
+
+	if count, total := histogram("vrage.client.duration"); count != 3 || total <= 0 {
+		t.Errorf("duration recorded %d values summing to %f, want 3 positive ones", count, total)
+	}
+	if count, total := histogram("vrage.server.query_time"); count != 3 || total != 5.5 {
+		t.Errorf("query time recorded %d values summing to %f, want 3 summing to 5.5", count, total)
+	}
+}
+
+func TestUnreachable(t *testing.T) {
+	h := newHarness(t)
+	h.client.RemoteAddress = "http://127.0.0.1:1"
+	if err := h.client.StopGrid(123); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	spans := h.spans.Ended()
+	if len(spans) != 1 || spans[0].Status().Code != codes.Error {
+		t.Fatalf("want one failed span, got %d", len(spans))
+	}
+	if len(spans[0].Events()) == 0 || spans[0].Events()[0].Name != "exception" {
+		t.Error("error not recorded on the span")
+	}
+	if errors := h.collect(t)["vrage.client.errors"]; errors.Data == nil {
+		t.Error("error not counted")
+	}
+}
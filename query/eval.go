@@ -0,0 +1,474 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package query
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+
+	"gopkg.in/uranoxyd/govrageremote.v2"
+)
+
+type evaluator struct {
+	entity   interface{}
+	resolver Resolver
+}
+
+type function func(e *evaluator, args []interface{}) (interface{}, error)
+
+var functions map[string]function
+
+func init() {
+	functions = map[string]function{
+		"distance": distanceFunction,
+		"lower": func(e *evaluator, args []interface{}) (interface{}, error) {
+			if len(args) != 1 {
+				return nil, fmt.Errorf("lower expects 1 argument")
+			}
+			s, ok := args[0].(string)
+			if !ok {
+				return nil, fmt.Errorf("lower expects a string")
+			}
+			return strings.ToLower(s), nil
+		},
+		"contains": func(e *evaluator, args []interface{}) (interface{}, error) {
+			if len(args) != 2 {
+				return nil, fmt.Errorf("contains expects 2 arguments")
+			}
+			s, ok1 := args[0].(string)
+			sub, ok2 := args[1].(string)
+			if !ok1 || !ok2 {
+				return nil, fmt.Errorf("contains expects strings")
+			}
+			return strings.Contains(strings.ToLower(s), strings.ToLower(sub)), nil
+		},
+		"abs": func(e *evaluator, args []interface{}) (interface{}, error) {
+			if len(args) != 1 {
+				return nil, fmt.Errorf("abs expects 1 argument")
+			}
+			switch value := args[0].(type) {
+			case int64:
+				if value == math.MinInt64 {
+					return -float64(value), nil
+				}
+				if value < 0 {
+					return -value, nil
+				}
+				return value, nil
+			case uint64:
+				return value, nil
+			case float64:
+				return math.Abs(value), nil
+			}
+			return nil, fmt.Errorf("abs expects a number")
+		},
+	}
+}
+
+// distanceFunction accepts a reference like player:123 or x, y, z coordinates
+func distanceFunction(e *evaluator, args []interface{}) (interface{}, error) {
+	positionable, ok := e.entity.(govrageremote.VRagePositionable)
+	if !ok {
+		return nil, fmt.Errorf("distance is not available for %T", e.entity)
+	}
+
+	var target govrageremote.VRagePosition
+	switch len(args) {
+	case 1:
+		target, ok = args[0].(govrageremote.VRagePosition)
+		if !ok {
+			return nil, fmt.Errorf("distance expects a reference like player:<steam id>")
+		}
+	case 3:
+		var coordinates [3]float64
+		for i, arg := range args {
+			if coordinates[i], ok = toFloat(arg); !ok {
+				return nil, fmt.Errorf("distance expects numeric coordinates")
+			}
+		}
+		target = govrageremote.VRagePosition{X: coordinates[0], Y: coordinates[1], Z: coordinates[2]}
+	default:
+		return nil, fmt.Errorf("distance expects a reference or x, y, z")
+	}
+
+	return positionable.GetPosition().DistanceTo(target), nil
+}
+
+func (e *evaluator) eval(n node) (interface{}, error) {
+	switch n := n.(type) {
+	case *literalNode:
+		return n.value, nil
+
+	case *fieldNode:
+		return field(e.entity, n.path)
+
+	case *referenceNode:
+		if e.resolver == nil {
+			return nil, fmt.Errorf("no resolver for %s:%d", n.kind, n.id)
+		}
+		return e.resolver.Resolve(n.kind, n.id)
+
+	case *callNode:
+		args := make([]interface{}, len(n.args))
+		for i, arg := range n.args {
+			value, err := e.eval(arg)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = value
+		}
+		return functions[n.name](e, args)
+
+	case *unaryNode:
+		value, err := e.eval(n.operand)
+		if err != nil {
+			return nil, err
+		}
+		if n.operator == "!" {
+			b, ok := value.(bool)
+			if !ok {
+				return nil, fmt.Errorf("! expects a boolean, got %v", value)
+			}
+			return !b, nil
+		}
+		switch value := value.(type) {
+		case int64:
+			if value == math.MinInt64 {
+				return -float64(value), nil
+			}
+			return -value, nil
+		case uint64:
+			return -float64(value), nil
+		case float64:
+			return -value, nil
+		}
+		return nil, fmt.Errorf("- expects a number, got %v", value)
+
+	case *binaryNode:
+		return e.evalBinary(n)
+	}
+	return nil, fmt.Errorf("unknown node %T", n)
+}
+
+func (e *evaluator) evalBinary(n *binaryNode) (interface{}, error) {
+	left, err := e.eval(n.left)
+	if err != nil {
+		return nil, err
+	}
+
+	// && and || short circuit so distance lookups are skipped when possible
+	if n.operator == "&&" || n.operator == "||" {
+		l, ok := left.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s expects booleans, got %v", n.operator, left)
+		}
+		if (n.operator == "&&" && !l) || (n.operator == "||" && l) {
+			return l, nil
+		}
+		right, err := e.eval(n.right)
+		if err != nil {
+			return nil, err
+		}
+		r, ok := right.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s expects booleans, got %v", n.operator, right)
+		}
+		return r, nil
+	}
+
+	right, err := e.eval(n.right)
+	if err != nil {
+		return nil, err
+	}
+
+	switch l := left.(type) {
+	case int64, uint64, float64:
+		if li, ok := l.(int64); ok {
+			if ri, ok := right.(int64); ok {
+				if result, ok := intArithmetic(n.operator, li, ri); ok {
+					return result, nil
+				}
+			}
+		}
+
+		lf, _ := toFloat(left)
+		rf, ok := toFloat(right)
+		if !ok {
+			return nil, fmt.Errorf("cannot %s number and %v", n.operator, right)
+		}
+		switch n.operator {
+		case "+":
+			return lf + rf, nil
+		case "-":
+			return lf - rf, nil
+		case "*":
+			return lf * rf, nil
+		case "/":
+			return lf / rf, nil
+		}
+		// comparisons never go through float64, IDs above 2^53 would match their neighbours
+		order, ordered := compareNumbers(left, right)
+		if !ordered {
+			// NaN is neither less, equal nor greater than anything, only != holds
+			if _, err := compare(n.operator, false, false); err != nil {
+				return nil, err
+			}
+			return n.operator == "!=", nil
+		}
+		return compare(n.operator, order < 0, order == 0)
+
+	case string:
+		r, ok := right.(string)
+		if !ok {
+			return nil, fmt.Errorf("cannot %s string and %v", n.operator, right)
+		}
+		if n.operator == "+" {
+			return l + r, nil
+		}
+		return compare(n.operator, l < r, l == r)
+
+	case bool:
+		r, ok := right.(bool)
+		if !ok {
+			return nil, fmt.Errorf("cannot %s boolean and %v", n.operator, right)
+		}
+		switch n.operator {
+		case "==":
+			return l == r, nil
+		case "!=":
+			return l != r, nil
+		}
+	}
+	return nil, fmt.Errorf("operator %s not supported for %v", n.operator, left)
+}
+
+func compare(operator string, less bool, equal bool) (interface{}, error) {
+	switch operator {
+	case "==":
+		return equal, nil
+	case "!=":
+		return !equal, nil
+	case "<":
+		return less, nil
+	case "<=":
+		return less || equal, nil
+	case ">":
+		return !less && !equal, nil
+	case ">=":
+		return !less, nil
+	}
+	return nil, fmt.Errorf("operator %s not supported", operator)
+}
+
+// field looks up a possibly nested struct field by case insensitive name
+func field(entity interface{}, path []string) (interface{}, error) {
+	value := reflect.ValueOf(entity)
+	for _, name := range path {
+		for value.Kind() == reflect.Ptr {
+			if value.IsNil() {
+				return nil, fmt.Errorf("field %s of nil value", name)
+			}
+			value = value.Elem()
+		}
+		if value.Kind() != reflect.Struct {
+			return nil, fmt.Errorf("%s has no field %s", value.Type(), name)
+		}
+
+		found := false
+		for i := 0; i < value.NumField(); i++ {
+			structField := value.Type().Field(i)
+			if structField.PkgPath != "" {
+				continue // unexported
+			}
+			if strings.EqualFold(structField.Name, name) {
+				value = value.Field(i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%s has no field %s", value.Type(), name)
+		}
+	}
+
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return value.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if value.Uint() > math.MaxInt64 {
+			return value.Uint(), nil
+		}
+		return int64(value.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), nil
+	case reflect.Bool:
+		return value.Bool(), nil
+	case reflect.String:
+		return value.String(), nil
+	}
+	return nil, fmt.Errorf("field %s has unsupported type %s", strings.Join(path, "."), value.Type())
+}
+
+// toFloat converts a number for arithmetic, numbers are int64, float64 or
+// uint64 for values above math.MaxInt64
+func toFloat(value interface{}) (float64, bool) {
+	switch value := value.(type) {
+	case int64:
+		return float64(value), true
+	case uint64:
+		return float64(value), true
+	case float64:
+		return value, true
+	}
+	return 0, false
+}
+
+// intArithmetic applies +, - or * to integers, ok is false for other operators
+// and if the result overflows int64, the caller falls back to float64 then
+func intArithmetic(operator string, l int64, r int64) (int64, bool) {
+	switch operator {
+	case "+":
+		sum := l + r
+		return sum, (sum > l) == (r > 0)
+	case "-":
+		difference := l - r
+		return difference, (difference < l) == (r > 0)
+	case "*":
+		if l == 0 || r == 0 {
+			return 0, true
+		}
+		if (l == -1 && r == math.MinInt64) || (r == -1 && l == math.MinInt64) {
+			return 0, false
+		}
+		product := l * r
+		return product, product/r == l
+	}
+	return 0, false
+}
+
+func isNaN(value interface{}) bool {
+	f, ok := value.(float64)
+	return ok && math.IsNaN(f)
+}
+
+// compareNumbers returns -1, 0 or 1 as left is less than, equal to or greater
+// than right without rounding either of them. ordered is false if either is NaN.
+func compareNumbers(left interface{}, right interface{}) (order int, ordered bool) {
+	if isNaN(left) || isNaN(right) {
+		return 0, false
+	}
+	return compareOrdered(left, right), true
+}
+
+func compareOrdered(left interface{}, right interface{}) int {
+	switch l := left.(type) {
+	case int64:
+		switch r := right.(type) {
+		case int64:
+			return compareInts(l, r)
+		case uint64:
+			return -1
+		case float64:
+			return compareIntFloat(l, r)
+		}
+	case uint64:
+		switch r := right.(type) {
+		case int64:
+			return 1
+		case uint64:
+			if l < r {
+				return -1
+			}
+			if l > r {
+				return 1
+			}
+			return 0
+		case float64:
+			return compareUintFloat(l, r)
+		}
+	case float64:
+		switch r := right.(type) {
+		case int64:
+			return -compareIntFloat(r, l)
+		case uint64:
+			return -compareUintFloat(r, l)
+		case float64:
+			if l < r {
+				return -1
+			}
+			if l > r {
+				return 1
+			}
+			return 0
+		}
+	}
+	return 0
+}
+
+func compareInts(l int64, r int64) int {
+	if l < r {
+		return -1
+	}
+	if l > r {
+		return 1
+	}
+	return 0
+}
+
+const twoPow63 = float64(1 << 63)
+
+func compareIntFloat(i int64, f float64) int {
+	switch {
+	case f >= twoPow63:
+		return -1
+	case f < -twoPow63:
+		return 1
+	}
+	whole := math.Trunc(f)
+	if order := compareInts(i, int64(whole)); order != 0 {
+		return order
+	}
+	return compareFraction(f, whole)
+}
+
+func compareUintFloat(u uint64, f float64) int {
+	switch {
+	case f < twoPow63:
+		return 1
+	case f >= 2*twoPow63:
+		return -1
+	}
+	whole := math.Trunc(f)
+	if w := uint64(whole); u != w {
+		if u < w {
+			return -1
+		}
+		return 1
+	}
+	return compareFraction(f, whole)
+}
+
+// compareFraction orders an integer equal to whole against f
+func compareFraction(f float64, whole float64) int {
+	if f > whole {
+		return -1
+	}
+	if f < whole {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,165 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package query implements a small filter language for grids, floating objects,
+// characters and players, for example
+//
+//	PCU > 5000 && !IsPowered && OwnerDisplayName == ''
+//	distance(player:76561198000000000) < 2000
+//
+// Field names are the exported fields of the entity and are matched case
+// insensitive, nested fields are separated by dots (Position.X). Besides the
+// usual comparison, boolean and arithmetic operators the functions distance,
+// lower, contains and abs are available. distance takes either x, y, z
+// coordinates or a reference of the form kind:id, where kind is one of player
+// (by SteamID), character, grid, asteroid, planet, floating or entity.
+package query
+
+import (
+	"fmt"
+	"sync"
+
+	"gopkg.in/uranoxyd/govrageremote.v2"
+)
+
+type Filter struct {
+	source   string
+	root     node
+	Resolver Resolver
+}
+
+func (filter *Filter) String() string {
+	return filter.source
+}
+
+// Match evaluates the filter against a single entity
+func (filter *Filter) Match(entity interface{}) (bool, error) {
+	e := &evaluator{entity: entity, resolver: filter.Resolver}
+	value, err := e.eval(filter.root)
+	if err != nil {
+		return false, err
+	}
+	result, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("filter %q does not evaluate to a boolean", filter.source)
+	}
+	return result, nil
+}
+
+// GridFunc adapts the filter to GetNearestGridsIf. Grids failing to evaluate do
+// not match, the second function returns the first of their errors.
+//
+//	match, matchErr := filter.GridFunc()
+//	grids, err := object.GetNearestGridsIf(match)
+//	if err == nil {
+//		err = matchErr()
+//	}
+func (filter *Filter) GridFunc() (func(grid *govrageremote.VRageRemoteGrid) bool, func() error) {
+	var mutex sync.Mutex
+	var firstErr error
+	match := func(grid *govrageremote.VRageRemoteGrid) bool {
+		ok, err := filter.Match(grid)
+		if err != nil {
+			mutex.Lock()
+			if firstErr == nil {
+				firstErr = err
+			}
+			mutex.Unlock()
+			return false
+		}
+		return ok
+	}
+	return match, func() error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return firstErr
+	}
+}
+
+func (filter *Filter) Grids(grids []*govrageremote.VRageRemoteGrid) ([]*govrageremote.VRageRemoteGrid, error) {
+	var matches []*govrageremote.VRageRemoteGrid
+	for _, grid := range grids {
+		ok, err := filter.Match(grid)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matches = append(matches, grid)
+		}
+	}
+	return matches, nil
+}
+
+func (filter *Filter) FloatingObjects(objects []*govrageremote.VRageRemoteFloatingObject) ([]*govrageremote.VRageRemoteFloatingObject, error) {
+	var matches []*govrageremote.VRageRemoteFloatingObject
+	for _, object := range objects {
+		ok, err := filter.Match(object)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matches = append(matches, object)
+		}
+	}
+	return matches, nil
+}
+
+func (filter *Filter) Characters(characters []*govrageremote.VRageRemoteCharacter) ([]*govrageremote.VRageRemoteCharacter, error) {
+	var matches []*govrageremote.VRageRemoteCharacter
+	for _, character := range characters {
+		ok, err := filter.Match(character)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matches = append(matches, character)
+		}
+	}
+	return matches, nil
+}
+
+func (filter *Filter) Players(players []*govrageremote.VRageRemotePlayer) ([]*govrageremote.VRageRemotePlayer, error) {
+	var matches []*govrageremote.VRageRemotePlayer
+	for _, player := range players {
+		ok, err := filter.Match(player)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matches = append(matches, player)
+		}
+	}
+	return matches, nil
+}
+
+// Compile parses a filter expression. References in the expression are resolved
+// with resolver, which may be nil if the expression does not use any.
+func Compile(source string, resolver Resolver) (*Filter, error) {
+	tokens, err := lex(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	root, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Filter{
+		source:   source,
+		root:     root,
+		Resolver: resolver,
+	}, nil
+}
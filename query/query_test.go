@@ -0,0 +1,276 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package query
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"gopkg.in/uranoxyd/govrageremote.v2"
+)
+
+type testEntity struct {
+	Name   string
+	Count  int64
+	Ratio  float64
+	Big    uint64
+	Steam  govrageremote.SteamID
+	Flag   bool
+	Inner  *testInner
+	hidden int64
+}
+
+func (entity *testEntity) GetPosition() govrageremote.VRagePosition {
+	return govrageremote.VRagePosition{}
+}
+
+type testInner struct {
+	Value int64
+}
+
+type testResolver map[string]govrageremote.VRagePosition
+
+func (resolver testResolver) Resolve(kind string, id int64) (govrageremote.VRagePosition, error) {
+	for key, position := range resolver {
+		if key == kind {
+			return position, nil
+		}
+	}
+	return govrageremote.VRagePosition{}, errors.New(kind + " not found")
+}
+
+func evaluate(t *testing.T, source string, entity interface{}) (interface{}, error) {
+	t.Helper()
+	filter, err := Compile(source, testResolver{"player": {X: 3, Y: 4}})
+	if err != nil {
+		return nil, err
+	}
+	e := &evaluator{entity: entity, resolver: filter.Resolver}
+	return e.eval(filter.root)
+}
+
+func TestEval(t *testing.T) {
+	entity := &testEntity{
+		Name:  "Miner",
+		Count: 7,
+		Ratio: 0.5,
+		Big:   math.MaxUint64,
+		Steam: 76561198000000001,
+		Flag:  true,
+		Inner: &testInner{Value: 3},
+	}
+
+	tests := []struct {
+		source string
+		want   interface{}
+	}{
+		// precedence and associativity
+		{"1 + 2 * 3", int64(7)},
+		{"(1 + 2) * 3", int64(9)},
+		{"10 - 4 - 3", int64(3)},
+		{"8 / 4 / 2", 1.0},
+		{"-2 * 3", int64(-6)},
+		{"--2", int64(2)},
+		{"1 + 2 == 3", true},
+		{"true || false && false", true},
+		{"(true || false) && false", false},
+		{"!false && !!true", true},
+		{"1 < 2 == true", nil}, // comparisons do not chain, see TestParseErrors
+
+		// fields
+		{"name", "Miner"},
+		{"Count * 2", int64(14)},
+		{"inner.value + 1", int64(4)},
+		{"Flag == true", true},
+		{"Name + '!'", "Miner!"},
+		{"Name == 'Miner' && Count >= 7", true},
+		{"lower(Name) == 'miner'", true},
+		{"contains(Name, 'IN')", true},
+		{"abs(-5)", int64(5)},
+		{"abs(-2.5)", 2.5},
+		{"distance(player:1)", 5.0},
+		{"distance(3, 4, 0)", 5.0},
+
+		// int/float mixes compare exactly
+		{"Count == 7.0", true},
+		{"Count < 7.5", true},
+		{"Count > 6.999", true},
+		{"0.5 == Ratio", true},
+		{"Steam == 76561198000000001", true},
+		{"Steam == 76561198000000000", false},
+		{"Steam == 76561198000000001.0", false}, // the float rounds to ...000000000
+		{"Steam > 76561198000000001.0", true},
+		{"9007199254740993 > 9007199254740992.0", true},
+		{"Big == 18446744073709551615", true},
+		{"Big > 9223372036854775807", true},
+		{"Big > 1e30", false},
+		{"-1 < Big", true},
+		{"Big * 2 > 1e19", true},
+
+		// int64 arithmetic falls back to float64 instead of wrapping around
+		{"9223372036854775807 + 1", 9223372036854775808.0},
+		{"-9223372036854775807 - 2", -9223372036854775809.0},
+		{"4611686018427387904 * 2", 9223372036854775808.0},
+		{"-4611686018427387904 * 2", int64(math.MinInt64)},
+		{"9223372036854775807 - -1 > 0", true},
+		{"3037000500 * 3037000500 > 0", true},
+
+		// NaN is unordered
+		{"0.0 / 0.0 == 0.0 / 0.0", false},
+		{"0.0 / 0.0 == 1", false},
+		{"0.0 / 0.0 < 1", false},
+		{"0.0 / 0.0 >= 1", false},
+		{"0.0 / 0.0 != 1", true},
+		{"1 / 0 > 9223372036854775807", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.source, func(t *testing.T) {
+			got, err := evaluate(t, test.source, entity)
+			if test.want == nil {
+				if err == nil {
+					t.Errorf("= %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("= %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	tests := map[string]string{
+		"Missing > 1":             "has no field",
+		"hidden > 1":              "has no field",
+		"Name.Length":             "has no field",
+		"Inner.Value.X":           "has no field",
+		"Name > 1":                "cannot > string",
+		"Count + 'x'":             "cannot + number",
+		"Flag < true":             "not supported",
+		"!Count":                  "! expects a boolean",
+		"-Name":                   "- expects a number",
+		"Count && true":           "&& expects booleans",
+		"true && Count":           "&& expects booleans",
+		"lower(Count)":            "lower expects a string",
+		"abs(1, 2)":               "abs expects 1 argument",
+		"distance(grid:1)":        "grid not found",
+		"distance(1, 2)":          "distance expects",
+		"distance('a', 'b', 'c')": "numeric coordinates",
+	}
+
+	for source, want := range tests {
+		t.Run(source, func(t *testing.T) {
+			_, err := evaluate(t, source, &testEntity{Inner: &testInner{}})
+			if err == nil || !strings.Contains(err.Error(), want) {
+				t.Errorf("error = %v, want it to contain %q", err, want)
+			}
+		})
+	}
+
+	_, err := evaluate(t, "Inner.Value > 1", &testEntity{})
+	if err == nil {
+		t.Error("nil nested struct did not fail")
+	}
+	_, err = evaluate(t, "distance(1, 2, 3) > 0", &testInner{})
+	if err == nil || !strings.Contains(err.Error(), "not available") {
+		t.Errorf("distance on an entity without position: %v", err)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := map[string]string{
+		"":              "unexpected end",
+		"1 +":           "unexpected end",
+		"(1 + 2":        "expected )",
+		"1 + 2)":        "unexpected \")\"",
+		"1 < 2 < 3":     "unexpected \"<\"",
+		"'open":         "unterminated string",
+		"a # b":         "unexpected '#'",
+		"foo(1)":        "unknown function",
+		"lower(1 2)":    "expected , or )",
+		"1..2":          "invalid number",
+		"Count == == 1": "unexpected \"==\"",
+	}
+
+	for source, want := range tests {
+		t.Run(source, func(t *testing.T) {
+			_, err := Compile(source, nil)
+			if err == nil || !strings.Contains(err.Error(), want) {
+				t.Errorf("error = %v, want it to contain %q", err, want)
+			}
+		})
+	}
+}
+
+func TestLexStrings(t *testing.T) {
+	tokens, err := lex(`'it\'s' "say \"hi\""`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokens[0].text != "it's" || tokens[1].text != `say "hi"` {
+		t.Errorf("tokens = %v", tokens)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	filter, err := Compile("PCU > 5000 && !IsPowered", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	grids := []*govrageremote.VRageRemoteGrid{
+		{DisplayName: "a", PCU: 6000},
+		{DisplayName: "b", PCU: 6000, IsPowered: true},
+		{DisplayName: "c", PCU: 100},
+	}
+	matches, err := filter.Grids(grids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 1 || matches[0].DisplayName != "a" {
+		t.Errorf("matches = %v", matches)
+	}
+
+	notBool, _ := Compile("PCU + 1", nil)
+	if _, err := notBool.Match(grids[0]); err == nil {
+		t.Error("a non boolean filter matched")
+	}
+}
+
+func TestGridFunc(t *testing.T) {
+	filter, err := Compile("distance(grid:1) < 10", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	match, matchErr := filter.GridFunc()
+	if match(&govrageremote.VRageRemoteGrid{}) {
+		t.Error("a grid failing to evaluate matched")
+	}
+	if err := matchErr(); err == nil || !strings.Contains(err.Error(), "no resolver") {
+		t.Errorf("matchErr() = %v", err)
+	}
+
+	filter, _ = Compile("PCU > 1", nil)
+	match, matchErr = filter.GridFunc()
+	if !match(&govrageremote.VRageRemoteGrid{PCU: 2}) || matchErr() != nil {
+		t.Error("GridFunc failed on a valid grid")
+	}
+}
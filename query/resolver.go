@@ -0,0 +1,165 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package query
+
+import (
+	"fmt"
+	"sync"
+
+	"gopkg.in/uranoxyd/govrageremote.v2"
+)
+
+// Resolver looks up the position of references like player:123 or grid:456
+type Resolver interface {
+	Resolve(kind string, id int64) (govrageremote.VRagePosition, error)
+}
+
+// ClientResolver resolves references by querying the server. Every list is
+// fetched at most once, create a new resolver to see fresh positions.
+type ClientResolver struct {
+	client     *govrageremote.VRageRemoteClient
+	positions  map[string]map[govrageremote.EntityID]govrageremote.VRagePosition
+	characters map[string]govrageremote.VRagePosition
+	players    map[govrageremote.SteamID]string
+	mutex      sync.Mutex
+}
+
+func (resolver *ClientResolver) Resolve(kind string, id int64) (govrageremote.VRagePosition, error) {
+	resolver.mutex.Lock()
+	defer resolver.mutex.Unlock()
+
+	switch kind {
+	case "player":
+		return resolver.resolvePlayer(govrageremote.SteamID(id))
+	case "entity":
+		for _, kind := range []string{"grid", "character", "floating", "asteroid", "planet"} {
+			if position, err := resolver.resolve(kind, govrageremote.EntityID(id)); err == nil {
+				return position, nil
+			}
+		}
+		return govrageremote.VRagePosition{}, fmt.Errorf("entity %d not found", id)
+	}
+	return resolver.resolve(kind, govrageremote.EntityID(id))
+}
+
+// resolvePlayer finds the character of a player, the API links them by display name only
+func (resolver *ClientResolver) resolvePlayer(steamID govrageremote.SteamID) (govrageremote.VRagePosition, error) {
+	if resolver.players == nil {
+		response, err := resolver.client.GetPlayers()
+		if err != nil {
+			return govrageremote.VRagePosition{}, err
+		}
+		resolver.players = make(map[govrageremote.SteamID]string)
+		for _, player := range response.Data.Players {
+			resolver.players[player.SteamID] = player.DisplayName
+		}
+	}
+	name, ok := resolver.players[steamID]
+	if !ok {
+		return govrageremote.VRagePosition{}, fmt.Errorf("player %d is not online", steamID)
+	}
+
+	if resolver.characters == nil {
+		response, err := resolver.client.GetCharacters()
+		if err != nil {
+			return govrageremote.VRagePosition{}, err
+		}
+		resolver.characters = make(map[string]govrageremote.VRagePosition)
+		for _, character := range response.Data.Characters {
+			resolver.characters[character.DisplayName] = character.Position
+		}
+	}
+	position, ok := resolver.characters[name]
+	if !ok {
+		return govrageremote.VRagePosition{}, fmt.Errorf("player %d has no character", steamID)
+	}
+	return position, nil
+}
+
+func (resolver *ClientResolver) resolve(kind string, id govrageremote.EntityID) (govrageremote.VRagePosition, error) {
+	positions, ok := resolver.positions[kind]
+	if !ok {
+		var err error
+		positions, err = resolver.fetch(kind)
+		if err != nil {
+			return govrageremote.VRagePosition{}, err
+		}
+		resolver.positions[kind] = positions
+	}
+
+	position, ok := positions[id]
+	if !ok {
+		return govrageremote.VRagePosition{}, fmt.Errorf("%s %d not found", kind, id)
+	}
+	return position, nil
+}
+
+func (resolver *ClientResolver) fetch(kind string) (map[govrageremote.EntityID]govrageremote.VRagePosition, error) {
+	positions := make(map[govrageremote.EntityID]govrageremote.VRagePosition)
+	client := resolver.client
+
+	switch kind {
+	case "grid":
+		response, err := client.GetGrids()
+		if err != nil {
+			return nil, err
+		}
+		for _, grid := range response.Data.Grids {
+			positions[grid.EntityID] = grid.Position
+		}
+	case "character":
+		response, err := client.GetCharacters()
+		if err != nil {
+			return nil, err
+		}
+		for _, character := range response.Data.Characters {
+			positions[character.EntityID] = character.Position
+		}
+	case "floating":
+		response, err := client.GetFloatingObjects()
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range response.Data.FloatingObjects {
+			positions[object.EntityID] = object.Position
+		}
+	case "asteroid":
+		response, err := client.GetAsteroids()
+		if err != nil {
+			return nil, err
+		}
+		for _, roid := range response.Data.Asteroids {
+			positions[roid.EntityID] = roid.Position
+		}
+	case "planet":
+		response, err := client.GetPlanets()
+		if err != nil {
+			return nil, err
+		}
+		for _, planet := range response.Data.Planets {
+			positions[planet.EntityID] = planet.Position
+		}
+	default:
+		return nil, fmt.Errorf("unknown reference kind %q", kind)
+	}
+	return positions, nil
+}
+
+func NewClientResolver(client *govrageremote.VRageRemoteClient) *ClientResolver {
+	return &ClientResolver{
+		client:    client,
+		positions: make(map[string]map[govrageremote.EntityID]govrageremote.VRagePosition),
+	}
+}
@@ -0,0 +1,245 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package govrageremote
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+//--
+//-- Token Bucket
+//--
+
+// VRageRateLimiter is a token bucket allowing Rate requests per second with bursts
+// of up to Burst requests. A rate of zero does not limit at all.
+type VRageRateLimiter struct {
+	rate   float64
+	burst  float64
+	factor float64
+	tokens float64
+	last   time.Time
+	mutex  sync.Mutex
+}
+
+// Wait blocks until a request may be made or ctx is done
+func (limiter *VRageRateLimiter) Wait(ctx context.Context) error {
+	limiter.mutex.Lock()
+	rate := limiter.effectiveRate()
+	if rate <= 0 {
+		limiter.mutex.Unlock()
+		return nil
+	}
+
+	// the token is reserved before waiting, so later callers queue up behind it
+	limiter.refill()
+	limiter.tokens--
+	if limiter.tokens >= 0 {
+		limiter.mutex.Unlock()
+		return nil
+	}
+	wait := time.Duration(-limiter.tokens / rate * float64(time.Second))
+	limiter.mutex.Unlock()
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		limiter.mutex.Lock()
+		limiter.tokens++
+		limiter.mutex.Unlock()
+		return ctx.Err()
+	}
+}
+
+func (limiter *VRageRateLimiter) SetRate(rate float64) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	limiter.refill()
+	limiter.rate = rate
+}
+
+// Rate returns the configured rate, not taking adaptive throttling into account
+func (limiter *VRageRateLimiter) Rate() float64 {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	return limiter.rate
+}
+
+// EffectiveRate returns the rate after adaptive throttling
+func (limiter *VRageRateLimiter) EffectiveRate() float64 {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	return limiter.effectiveRate()
+}
+
+func (limiter *VRageRateLimiter) setFactor(factor float64) {
+	if factor <= 0 {
+		return // would stop the limiter for good
+	}
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	limiter.refill()
+	limiter.factor = factor
+}
+
+func (limiter *VRageRateLimiter) effectiveRate() float64 {
+	return limiter.rate * limiter.factor
+}
+
+func (limiter *VRageRateLimiter) refill() {
+	now := time.Now()
+	limiter.tokens += now.Sub(limiter.last).Seconds() * limiter.effectiveRate()
+	if limiter.tokens > limiter.burst {
+		limiter.tokens = limiter.burst
+	}
+	limiter.last = now
+}
+
+func NewVRageRateLimiter(rate float64, burst int) *VRageRateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &VRageRateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		factor: 1,
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+//--
+//-- Adaptive Throttling
+//--
+
+// VRageAdaptiveThrottle slows the rate limiters of a client down while the server
+// struggles. The rates are multiplied by BackoffFactor whenever a response took
+// the server longer than MaxQueryTime milliseconds or a server info response
+// reports a SimSpeed below MinSimSpeed, and recover by RecoverStep for every
+// healthy response. The factor never drops below MinFactor, or below
+// minThrottleFactor if MinFactor is not positive.
+type VRageAdaptiveThrottle struct {
+	MinSimSpeed   float64
+	MaxQueryTime  float64
+	BackoffFactor float64
+	RecoverStep   float64
+	MinFactor     float64
+	factor        float64
+	mutex         sync.Mutex
+}
+
+// Factor returns the multiplier currently applied to the rate limiters
+func (throttle *VRageAdaptiveThrottle) Factor() float64 {
+	throttle.mutex.Lock()
+	defer throttle.mutex.Unlock()
+	return throttle.current()
+}
+
+// minThrottleFactor keeps a throttle without MinFactor from stopping all requests
+const minThrottleFactor = 0.01
+
+// current expects the lock to be held, a zero value throttle starts at full speed
+func (throttle *VRageAdaptiveThrottle) current() float64 {
+	if throttle.factor <= 0 {
+		return 1
+	}
+	return throttle.factor
+}
+
+func (throttle *VRageAdaptiveThrottle) observe(request *VRageRequest, response *VRageRawResponse) float64 {
+	throttle.mutex.Lock()
+	defer throttle.mutex.Unlock()
+
+	degraded := response.Meta != nil && throttle.MaxQueryTime > 0 && response.Meta.QueryTime > throttle.MaxQueryTime
+	if request.Method == "GET" && request.Resource == "server" {
+		info := &VRageRemoteServerInfoResponse{}
+		if json.Unmarshal(response.Body, info) == nil && info.Data != nil && info.Data.IsReady {
+			degraded = degraded || info.Data.SimSpeed < throttle.MinSimSpeed
+		}
+	}
+
+	factor := throttle.current()
+	if degraded {
+		factor *= throttle.BackoffFactor
+		minimum := throttle.MinFactor
+		if minimum <= 0 {
+			minimum = minThrottleFactor
+		}
+		if factor < minimum {
+			factor = minimum
+		}
+	} else {
+		factor += throttle.RecoverStep
+		if factor > 1 {
+			factor = 1
+		}
+	}
+	throttle.factor = factor
+	return factor
+}
+
+func NewVRageAdaptiveThrottle() *VRageAdaptiveThrottle {
+	return &VRageAdaptiveThrottle{
+		MinSimSpeed:   0.9,
+		MaxQueryTime:  50,
+		BackoffFactor: 0.5,
+		RecoverStep:   0.05,
+		MinFactor:     0.05,
+		factor:        1,
+	}
+}
+
+//--
+//-- Client
+//--
+
+// SetRateLimits limits the client to reads GET requests and writes other requests
+// per second. A rate of zero disables the limit for that class.
+func (client *VRageRemoteClient) SetRateLimits(reads float64, writes float64) {
+	client.ReadLimiter = nil
+	client.WriteLimiter = nil
+	if reads > 0 {
+		client.ReadLimiter = NewVRageRateLimiter(reads, int(reads)+1)
+	}
+	if writes > 0 {
+		client.WriteLimiter = NewVRageRateLimiter(writes, int(writes)+1)
+	}
+}
+
+func (client *VRageRemoteClient) limiterFor(method string) *VRageRateLimiter {
+	if method == "GET" {
+		return client.ReadLimiter
+	}
+	return client.WriteLimiter
+}
+
+// throttle feeds a response to the adaptive throttle and applies its verdict
+func (client *VRageRemoteClient) throttle(request *VRageRequest, response *VRageRawResponse) {
+	if client.Throttle == nil {
+		return
+	}
+
+	factor := client.Throttle.observe(request, response)
+	for _, limiter := range []*VRageRateLimiter{client.ReadLimiter, client.WriteLimiter} {
+		if limiter != nil {
+			limiter.setFactor(factor)
+		}
+	}
+}
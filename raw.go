@@ -0,0 +1,77 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package govrageremote
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// VRageStatusError is returned by Do when the server answers with a status
+// outside of 2xx, Message is the error message of the response if it has one
+type VRageStatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (err *VRageStatusError) Error() string {
+	if err.Message == "" {
+		return fmt.Sprintf("remote api responded with status %d", err.StatusCode)
+	}
+	return err.Message
+}
+
+type vrageRawDataResponse struct {
+	*VRageRemoteResponse
+	Data json.RawMessage `json:"data"`
+}
+
+// Do calls an arbitrary Remote API resource like "session/grids" with the signing,
+// middlewares, caching and error handling of the wrapped methods. It returns the
+// undecoded data of the response and its meta. If out is not nil the data is
+// decoded into it as well.
+func (client *VRageRemoteClient) Do(ctx context.Context, method string, resource string, query url.Values, body interface{}, out interface{}) (json.RawMessage, *VRageRemoteResponseMeta, error) {
+	response := &vrageRawDataResponse{}
+	raw, err := client.scanResponseContext(ctx, strings.ToUpper(method), strings.Trim(resource, "/"), query, body, response)
+	if err != nil {
+		if raw != nil && (raw.StatusCode < 200 || raw.StatusCode > 299) {
+			return nil, nil, &VRageStatusError{StatusCode: raw.StatusCode}
+		}
+		return nil, nil, err
+	}
+
+	var meta *VRageRemoteResponseMeta
+	if response.VRageRemoteResponse != nil {
+		meta = response.Meta
+		if response.Error != nil {
+			if raw.StatusCode < 200 || raw.StatusCode > 299 {
+				return response.Data, meta, &VRageStatusError{StatusCode: raw.StatusCode, Message: response.Error.Message}
+			}
+			return response.Data, meta, errors.New(response.Error.Message)
+		}
+	}
+
+	if out != nil && len(response.Data) > 0 {
+		if err := json.Unmarshal(response.Data, out); err != nil {
+			return response.Data, meta, err
+		}
+	}
+
+	return response.Data, meta, nil
+}
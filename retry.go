@@ -0,0 +1,117 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package govrageremote
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// VRageRetryPolicy retries requests which failed because the server could not be
+// reached, was too busy (429) or failed internally (5xx). The delay starts at
+// Delay and doubles with every attempt up to MaxDelay, a Retry-After header of
+// the server takes precedence.
+type VRageRetryPolicy struct {
+	MaxAttempts int           // attempts including the first one, below 2 disables retries
+	Delay       time.Duration // delay before the first retry
+	MaxDelay    time.Duration // upper bound of the delay, zero means unbounded
+	RetryWrites bool          // also retry POST, PATCH and DELETE requests, which may then be applied twice
+}
+
+func DefaultVRageRetryPolicy() *VRageRetryPolicy {
+	return &VRageRetryPolicy{
+		MaxAttempts: 3,
+		Delay:       500 * time.Millisecond,
+		MaxDelay:    5 * time.Second,
+	}
+}
+
+func (policy *VRageRetryPolicy) retryable(request *VRageRequest, response *VRageRawResponse, err error) bool {
+	if request.Method != "GET" && !policy.RetryWrites {
+		return false
+	}
+	if err != nil {
+		// the caller gave up, trying again would not help
+		return request.Context == nil || request.Context.Err() == nil
+	}
+	return response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= 500
+}
+
+// delay returns the wait before the given retry, counted from 1
+func (policy *VRageRetryPolicy) delay(retry int, response *VRageRawResponse) time.Duration {
+	if response != nil {
+		if seconds, err := strconv.Atoi(response.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+
+	delay := policy.Delay
+	for i := 1; i < retry; i++ {
+		delay *= 2
+		if policy.MaxDelay > 0 && delay >= policy.MaxDelay {
+			return policy.MaxDelay
+		}
+	}
+	return delay
+}
+
+// SetTimeout limits how long a single attempt of a request may take, zero means no limit
+func (client *VRageRemoteClient) SetTimeout(timeout time.Duration) {
+	client.httpClient.Timeout = timeout
+}
+
+// retry calls send until it succeeds or the retry policy gives up
+func (client *VRageRemoteClient) retry(request *VRageRequest, send func(request *VRageRequest) (*VRageRawResponse, error)) (*VRageRawResponse, error) {
+	policy := client.Retry
+	if policy == nil || policy.MaxAttempts < 2 {
+		return send(request)
+	}
+
+	ctx := request.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	for attempt := 1; ; attempt++ {
+		response, err := send(request)
+		if attempt >= policy.MaxAttempts || !policy.retryable(request, response, err) {
+			return response, err
+		}
+
+		delay := policy.delay(attempt, response)
+		args := []interface{}{
+			"method", request.Method,
+			"resource", request.Resource,
+			"attempt", attempt,
+			"delay", delay,
+		}
+		if err != nil {
+			args = append(args, "error", err.Error())
+		} else {
+			args = append(args, "status", response.StatusCode)
+		}
+		client.log().Warn("retrying remote api request", args...)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return response, err
+		case <-timer.C:
+		}
+	}
+}
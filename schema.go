@@ -0,0 +1,307 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package govrageremote
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+type VRageStrictMode int
+
+const (
+	VRageStrictOff    VRageStrictMode = iota // decode like encoding/json does
+	VRageStrictReport                        // report schema drift to OnSchemaDrift and the logger
+	VRageStrictFail                          // fail requests whose response does not match the schema
+)
+
+type VRageSchemaIssueKind string
+
+const (
+	VRageSchemaUnknownField VRageSchemaIssueKind = "unknown field"
+	VRageSchemaMissingField VRageSchemaIssueKind = "missing field"
+	VRageSchemaTypeMismatch VRageSchemaIssueKind = "type mismatch"
+)
+
+type VRageSchemaIssue struct {
+	Kind     VRageSchemaIssueKind
+	Path     string // like data.Grids[].PCU
+	Expected string
+	Actual   string
+}
+
+func (issue VRageSchemaIssue) String() string {
+	if issue.Kind == VRageSchemaTypeMismatch {
+		return fmt.Sprintf("%s %s: expected %s, got %s", issue.Kind, issue.Path, issue.Expected, issue.Actual)
+	}
+	return fmt.Sprintf("%s %s", issue.Kind, issue.Path)
+}
+
+// VRageSchemaError lists the differences between a response and the type it was decoded into
+type VRageSchemaError struct {
+	Type     string
+	Resource string
+	Issues   []VRageSchemaIssue
+}
+
+func (err *VRageSchemaError) Error() string {
+	issues := make([]string, len(err.Issues))
+	for i, issue := range err.Issues {
+		issues[i] = issue.String()
+	}
+	return fmt.Sprintf("response of %s does not match %s: %s", err.Resource, err.Type, strings.Join(issues, "; "))
+}
+
+var (
+	rawMessageMapType = reflect.TypeOf(map[string]json.RawMessage{})
+	unmarshalerType   = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+)
+
+type vrageSchemaWalker struct {
+	strict bool
+	issues []VRageSchemaIssue
+	seen   map[string]bool
+}
+
+func (walker *vrageSchemaWalker) report(kind VRageSchemaIssueKind, path string, expected string, actual string) {
+	if !walker.strict {
+		return
+	}
+	// array elements share their path, report every issue once
+	key := string(kind) + " " + path
+	if walker.seen[key] {
+		return
+	}
+	walker.seen[key] = true
+	walker.issues = append(walker.issues, VRageSchemaIssue{Kind: kind, Path: path, Expected: expected, Actual: actual})
+}
+
+// walk compares raw with the already decoded value, fills the Extra fields of
+// structs with unknown members and collects schema issues if strict
+func (walker *vrageSchemaWalker) walk(raw json.RawMessage, value reflect.Value, path string) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return
+	}
+
+	for value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return
+		}
+		value = value.Elem()
+	}
+
+	if reflect.PtrTo(value.Type()).Implements(unmarshalerType) {
+		return // custom types decode whatever representation they accept
+	}
+
+	actual := jsonKind(raw)
+	switch value.Kind() {
+	case reflect.Struct:
+		if actual != "object" {
+			walker.report(VRageSchemaTypeMismatch, path, "object", actual)
+			return
+		}
+		walker.walkStruct(raw, value, path)
+
+	case reflect.Slice:
+		if actual != "array" {
+			walker.report(VRageSchemaTypeMismatch, path, "array", actual)
+			return
+		}
+		var elements []json.RawMessage
+		if json.Unmarshal(raw, &elements) != nil {
+			return
+		}
+		for i := 0; i < len(elements) && i < value.Len(); i++ {
+			walker.walk(elements[i], value.Index(i), path+"[]")
+		}
+
+	case reflect.String:
+		if actual != "string" {
+			walker.report(VRageSchemaTypeMismatch, path, "string", actual)
+		}
+	case reflect.Bool:
+		if actual != "boolean" {
+			walker.report(VRageSchemaTypeMismatch, path, "boolean", actual)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		if actual != "number" {
+			walker.report(VRageSchemaTypeMismatch, path, "number", actual)
+		}
+	}
+}
+
+func (walker *vrageSchemaWalker) walkStruct(raw json.RawMessage, value reflect.Value, path string) {
+	var members map[string]json.RawMessage
+	if json.Unmarshal(raw, &members) != nil {
+		return
+	}
+
+	fields := make(map[string]reflect.Value)
+	optional := make(map[string]bool)
+	names := make(map[string]string)
+	var extra reflect.Value
+	collectJSONFields(value, fields, optional, names, &extra)
+
+	for key, member := range members {
+		field, ok := fields[strings.ToLower(key)]
+		if !ok {
+			walker.report(VRageSchemaUnknownField, joinPath(path, key), "", "")
+			if extra.IsValid() {
+				if extra.IsNil() {
+					extra.Set(reflect.MakeMap(rawMessageMapType))
+				}
+				extra.SetMapIndex(reflect.ValueOf(key), reflect.ValueOf(member))
+			}
+			continue
+		}
+		walker.walk(member, field, joinPath(path, names[strings.ToLower(key)]))
+	}
+
+	// error responses carry no data, so only complete responses are checked for missing fields
+	if _, failed := members["error"]; failed {
+		return
+	}
+	for lower, name := range names {
+		if optional[lower] {
+			continue
+		}
+		found := false
+		for key := range members {
+			if strings.ToLower(key) == lower {
+				found = true
+				break
+			}
+		}
+		if !found {
+			walker.report(VRageSchemaMissingField, joinPath(path, name), "", "")
+		}
+	}
+}
+
+// collectJSONFields maps the lower cased json names of the fields of value,
+// including the fields of embedded structs, the way encoding/json matches them
+func collectJSONFields(value reflect.Value, fields map[string]reflect.Value, optional map[string]bool, names map[string]string, extra *reflect.Value) {
+	t := value.Type()
+	for i := 0; i < t.NumField(); i++ {
+		structField := t.Field(i)
+		field := value.Field(i)
+
+		if structField.Anonymous {
+			for field.Kind() == reflect.Ptr {
+				if field.IsNil() {
+					// encoding/json leaves the embedded struct nil if none of its fields were sent
+					field = reflect.New(field.Type().Elem())
+				}
+				field = field.Elem()
+			}
+			if field.Kind() == reflect.Struct {
+				collectJSONFields(field, fields, optional, names, extra)
+			}
+			continue
+		}
+		if structField.PkgPath != "" {
+			continue
+		}
+		if structField.Name == "Extra" && structField.Type == rawMessageMapType {
+			*extra = field
+			continue
+		}
+
+		tag := structField.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := structField.Name
+		parts := strings.Split(tag, ",")
+		if parts[0] != "" {
+			name = parts[0]
+		}
+		lower := strings.ToLower(name)
+		fields[lower] = field
+		names[lower] = name
+		for _, option := range parts[1:] {
+			if option == "omitempty" {
+				optional[lower] = true
+			}
+		}
+	}
+}
+
+func jsonKind(raw json.RawMessage) string {
+	switch raw[0] {
+	case '{':
+		return "object"
+	case '[':
+		return "array"
+	case '"':
+		return "string"
+	case 't', 'f':
+		return "boolean"
+	case 'n':
+		return "null"
+	}
+	return "number"
+}
+
+func joinPath(path string, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// inspectResponse fills the Extra fields of the decoded response and checks it
+// against the schema if strict decoding is enabled
+func (client *VRageRemoteClient) inspectResponse(resource string, body []byte, responseStruct interface{}) error {
+	value := reflect.ValueOf(responseStruct)
+	if value.Kind() != reflect.Ptr || value.IsNil() {
+		return nil
+	}
+
+	walker := &vrageSchemaWalker{
+		strict: client.StrictDecoding != VRageStrictOff,
+		seen:   make(map[string]bool),
+	}
+	walker.walk(body, value, "")
+	if len(walker.issues) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(walker.issues, func(i, j int) bool {
+		return walker.issues[i].Path < walker.issues[j].Path
+	})
+
+	err := &VRageSchemaError{
+		Type:     value.Elem().Type().Name(),
+		Resource: resource,
+		Issues:   walker.issues,
+	}
+	if client.OnSchemaDrift != nil {
+		client.OnSchemaDrift(err)
+	}
+	if client.StrictDecoding == VRageStrictFail {
+		return err
+	}
+	client.log().Warn("remote api schema drift", "resource", resource, "type", err.Type, "issues", len(err.Issues), "error", err.Error())
+	return nil
+}
@@ -0,0 +1,194 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package govrageremote
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type schemaTestInner struct {
+	Name  string
+	Count int `json:"count"`
+	Extra map[string]json.RawMessage
+}
+
+type schemaTestEmbedded struct {
+	Tag string `json:",omitempty"`
+}
+
+type schemaTestData struct {
+	*schemaTestEmbedded
+	ID       EntityID
+	Enabled  bool
+	Inner    schemaTestInner
+	Pointer  *schemaTestInner
+	Items    []schemaTestInner
+	Pointers []*schemaTestInner
+	Optional float64 `json:",omitempty"`
+	Ignored  string  `json:"-"`
+	Extra    map[string]json.RawMessage
+}
+
+type schemaTestResponse struct {
+	Data  schemaTestData            `json:"data"`
+	Meta  VRageRemoteResponseMeta   `json:"meta"`
+	Error *VRageRemoteResponseError `json:"error,omitempty"`
+}
+
+const schemaTestMeta = `"meta":{"apiVersion":"1.0","queryTime":1}`
+
+func TestInspectResponse(t *testing.T) {
+	inner := `{"Name":"a","count":1}`
+	tests := []struct {
+		name   string
+		body   string
+		issues []VRageSchemaIssue
+	}{
+		{
+			"matching",
+			`{"data":{"ID":"5","Enabled":true,"Inner":` + inner + `,"Pointer":` + inner + `,"Items":[` + inner + `],"Pointers":[` + inner + `]},` + schemaTestMeta + `}`,
+			nil,
+		},
+		{
+			"case insensitive names and nulls",
+			`{"data":{"id":5,"enabled":false,"inner":{"name":"a","COUNT":1},"Pointer":null,"Items":null,"Pointers":[null],"Tag":"x"},` + schemaTestMeta + `}`,
+			nil,
+		},
+		{
+			"unknown fields",
+			`{"data":{"ID":5,"Enabled":true,"Inner":{"Name":"a","count":1,"New":1},"Pointer":{"Name":"a","count":1,"Deep":[1]},"Items":[{"Name":"a","count":1,"Later":true}],"Pointers":[],"Top":"x"},` + schemaTestMeta + `,"links":{}}`,
+			[]VRageSchemaIssue{
+				{Kind: VRageSchemaUnknownField, Path: "data.Inner.New"},
+				{Kind: VRageSchemaUnknownField, Path: "data.Items[].Later"},
+				{Kind: VRageSchemaUnknownField, Path: "data.Pointer.Deep"},
+				{Kind: VRageSchemaUnknownField, Path: "data.Top"},
+				{Kind: VRageSchemaUnknownField, Path: "links"},
+			},
+		},
+		{
+			"missing fields",
+			`{"data":{"ID":5,"Inner":{"Name":"a"},"Pointer":{"count":1},"Items":[{"Name":"a"},{"Name":"b"}],"Pointers":[]},` + schemaTestMeta + `}`,
+			[]VRageSchemaIssue{
+				{Kind: VRageSchemaMissingField, Path: "data.Enabled"},
+				{Kind: VRageSchemaMissingField, Path: "data.Inner.count"},
+				{Kind: VRageSchemaMissingField, Path: "data.Items[].count"},
+				{Kind: VRageSchemaMissingField, Path: "data.Pointer.Name"},
+			},
+		},
+		{
+			"type mismatches",
+			`{"data":{"ID":5,"Enabled":"yes","Inner":[],"Pointer":{"Name":1,"count":"1"},"Items":{},"Pointers":[{"Name":"a","count":true}],"Optional":"1.5"},` + schemaTestMeta + `}`,
+			[]VRageSchemaIssue{
+				{Kind: VRageSchemaTypeMismatch, Path: "data.Enabled", Expected: "boolean", Actual: "string"},
+				{Kind: VRageSchemaTypeMismatch, Path: "data.Inner", Expected: "object", Actual: "array"},
+				{Kind: VRageSchemaTypeMismatch, Path: "data.Items", Expected: "array", Actual: "object"},
+				{Kind: VRageSchemaTypeMismatch, Path: "data.Optional", Expected: "number", Actual: "string"},
+				{Kind: VRageSchemaTypeMismatch, Path: "data.Pointer.Name", Expected: "string", Actual: "number"},
+				{Kind: VRageSchemaTypeMismatch, Path: "data.Pointer.count", Expected: "number", Actual: "string"},
+				{Kind: VRageSchemaTypeMismatch, Path: "data.Pointers[].count", Expected: "number", Actual: "boolean"},
+			},
+		},
+		{
+			"error responses are not checked for missing fields",
+			`{"error":{"message":"grid not found"},` + schemaTestMeta + `}`,
+			nil,
+		},
+	}
+
+	for _, test := range tests {
+		client := NewVRageRemoteClient("http://server", "c2VjcmV0")
+		client.StrictDecoding = VRageStrictFail
+
+		// decode the way the client does, type errors are left to the walker
+		var response schemaTestResponse
+		json.Unmarshal([]byte(test.body), &response)
+
+		err := client.inspectResponse("session/test", []byte(test.body), &response)
+		if test.issues == nil {
+			if err != nil {
+				t.Errorf("%s: %v", test.name, err)
+			}
+			continue
+		}
+		var schemaErr *VRageSchemaError
+		if !errors.As(err, &schemaErr) {
+			t.Errorf("%s: got %v, want a schema error", test.name, err)
+			continue
+		}
+		if schemaErr.Type != "schemaTestResponse" || schemaErr.Resource != "session/test" {
+			t.Errorf("%s: error for %s of %s", test.name, schemaErr.Type, schemaErr.Resource)
+		}
+		if !reflect.DeepEqual(schemaErr.Issues, test.issues) {
+			t.Errorf("%s: issues\n%v\nwant\n%v", test.name, schemaErr.Issues, test.issues)
+		}
+	}
+}
+
+func TestInspectResponseExtra(t *testing.T) {
+	body := `{"data":{"ID":5,"Enabled":true,"Inner":{"Name":"a","count":1,"New":[1,2]},"Pointer":{"Name":"a","count":1,"Deep":{"x":1}},"Items":[{"Name":"a","count":1},{"Name":"b","count":2,"Later":true}],"Pointers":[],"Top":"x"},` + schemaTestMeta + `}`
+
+	// Extra is filled whatever the strict mode is, and the mode decides about the error
+	for _, mode := range []VRageStrictMode{VRageStrictOff, VRageStrictReport, VRageStrictFail} {
+		client := NewVRageRemoteClient("http://server", "c2VjcmV0")
+		client.StrictDecoding = mode
+		var drift *VRageSchemaError
+		client.OnSchemaDrift = func(err *VRageSchemaError) {
+			drift = err
+		}
+
+		var response schemaTestResponse
+		if err := json.Unmarshal([]byte(body), &response); err != nil {
+			t.Fatal(err)
+		}
+		err := client.inspectResponse("session/test", []byte(body), &response)
+
+		if (err != nil) != (mode == VRageStrictFail) {
+			t.Errorf("mode %d: got error %v", mode, err)
+		}
+		if (drift != nil) != (mode != VRageStrictOff) {
+			t.Errorf("mode %d: OnSchemaDrift got %v", mode, drift)
+		}
+
+		data := response.Data
+		extras := []struct {
+			extra map[string]json.RawMessage
+			want  map[string]string
+		}{
+			{data.Extra, map[string]string{"Top": `"x"`}},
+			{data.Inner.Extra, map[string]string{"New": `[1,2]`}},
+			{data.Pointer.Extra, map[string]string{"Deep": `{"x":1}`}},
+			{data.Items[0].Extra, nil},
+			{data.Items[1].Extra, map[string]string{"Later": `true`}},
+		}
+		for i, extra := range extras {
+			got := make(map[string]string)
+			for key, value := range extra.extra {
+				got[key] = string(value)
+			}
+			if len(got) != len(extra.want) {
+				t.Errorf("mode %d: extra %d = %v, want %v", mode, i, got, extra.want)
+				continue
+			}
+			for key, value := range extra.want {
+				if got[key] != value {
+					t.Errorf("mode %d: extra %d = %v, want %v", mode, i, got, extra.want)
+				}
+			}
+		}
+	}
+}
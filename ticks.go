@@ -0,0 +1,137 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package govrageremote
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+const (
+	ticksPerSecond = 10000000
+	nanosPerTick   = 100
+	// seconds between 0001-01-01 and 1970-01-01
+	unixEpochSeconds = 62135596800
+
+	// DateTime.ToBinary keeps the DateTimeKind in the two highest bits
+	binaryTicksMask    = 0x3FFFFFFFFFFFFFFF
+	binaryKindUTC      = 0x4000000000000000
+	binaryKindLocal    = -0x8000000000000000
+	binaryTicksCeiling = 0x4000000000000000
+)
+
+// DotNetTicks counts 100 nanosecond intervals since 0001-01-01 00:00:00 UTC like
+// the .NET DateTime.Ticks and DateTimeOffset.UtcTicks properties. It decodes from
+// JSON numbers, numeric strings, ISO 8601 DateTimeOffset strings and the legacy
+// "/Date(ms+hhmm)/" format.
+type DotNetTicks int64
+
+func DotNetTicksFromTime(value time.Time) DotNetTicks {
+	return DotNetTicks((value.Unix()+unixEpochSeconds)*ticksPerSecond + int64(value.Nanosecond()/nanosPerTick))
+}
+
+// DotNetTicksFromBinary decodes the result of DateTime.ToBinary. UTC and
+// Unspecified values keep their ticks, Local values are stored by .NET as UTC
+// ticks already, so the result is UTC for both.
+func DotNetTicksFromBinary(data int64) DotNetTicks {
+	ticks := data & binaryTicksMask
+	if data&binaryKindLocal != 0 && ticks > binaryTicksCeiling-24*3600*ticksPerSecond {
+		// a local time shortly after 0001-01-01 whose UTC ticks wrapped around
+		ticks -= binaryTicksCeiling
+	}
+	return DotNetTicks(ticks)
+}
+
+// Time returns the UTC time of the ticks
+func (ticks DotNetTicks) Time() time.Time {
+	seconds := int64(ticks) / ticksPerSecond
+	remainder := int64(ticks) % ticksPerSecond
+	if remainder < 0 {
+		seconds--
+		remainder += ticksPerSecond
+	}
+	return time.Unix(seconds-unixEpochSeconds, remainder*nanosPerTick).UTC()
+}
+
+// TimeIn interprets the ticks as wall clock time in location, which is what
+// .NET DateTime values of kind Local hold
+func (ticks DotNetTicks) TimeIn(location *time.Location) time.Time {
+	t := ticks.Time()
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), location)
+}
+
+func (ticks DotNetTicks) String() string {
+	return strconv.FormatInt(int64(ticks), 10)
+}
+
+func (ticks DotNetTicks) MarshalJSON() ([]byte, error) {
+	return []byte(ticks.String()), nil
+}
+
+var legacyDatePattern = regexp.MustCompile(`^/Date\((-?\d+)([+-]\d{4})?\)/$`)
+
+func (ticks *DotNetTicks) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+
+	if len(data) > 0 && data[0] != '"' {
+		value, err := strconv.ParseInt(string(data), 10, 64)
+		if err != nil {
+			return errors.New("invalid .NET ticks: " + string(data))
+		}
+		*ticks = DotNetTicks(value)
+		return nil
+	}
+
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+	if text == "" {
+		*ticks = 0
+		return nil
+	}
+
+	if value, err := strconv.ParseInt(text, 10, 64); err == nil {
+		*ticks = DotNetTicks(value)
+		return nil
+	}
+
+	// the offset of the legacy format is informational, the milliseconds are UTC
+	if match := legacyDatePattern.FindStringSubmatch(text); match != nil {
+		ms, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return err
+		}
+		*ticks = DotNetTicksFromTime(time.Unix(0, 0).Add(time.Duration(ms) * time.Millisecond))
+		return nil
+	}
+
+	value, err := time.Parse(time.RFC3339Nano, text)
+	if err != nil {
+		// DateTime values of kind Unspecified are serialized without an offset
+		value, err = time.Parse("2006-01-02T15:04:05.9999999", text)
+		if err != nil {
+			return errors.New("invalid .NET timestamp: " + text)
+		}
+	}
+	*ticks = DotNetTicksFromTime(value)
+	return nil
+}
@@ -0,0 +1,187 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package govrageremote
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+const (
+	ticks1900 DotNetTicks = 599266080000000000
+	ticks1970 DotNetTicks = 621355968000000000
+	ticks2021 DotNetTicks = 637450560000000000
+)
+
+func TestDotNetTicksTime(t *testing.T) {
+	tests := []struct {
+		name  string
+		ticks DotNetTicks
+		time  time.Time
+	}{
+		{"zero", 0, time.Date(1, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"unix epoch", ticks1970, time.Unix(0, 0).UTC()},
+		{"pre epoch", ticks1900, time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"2021", ticks2021, time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"one tick", ticks2021 + 1, time.Date(2021, 1, 1, 0, 0, 0, 100, time.UTC)},
+		{"sub second", ticks2021 + 1234567, time.Date(2021, 1, 1, 0, 0, 0, 123456700, time.UTC)},
+		{"pre epoch sub second", ticks1900 - 1, time.Date(1899, 12, 31, 23, 59, 59, 999999900, time.UTC)},
+		{"negative", -1, time.Date(0, 12, 31, 23, 59, 59, 999999900, time.UTC)},
+		{"negative seconds", -10000001, time.Date(0, 12, 31, 23, 59, 58, 999999900, time.UTC)},
+		{"max", 3155378975999999999, time.Date(9999, 12, 31, 23, 59, 59, 999999900, time.UTC)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.ticks.Time(); !got.Equal(test.time) {
+				t.Errorf("Time() = %s, want %s", got, test.time)
+			}
+			if got := DotNetTicksFromTime(test.time); got != test.ticks {
+				t.Errorf("DotNetTicksFromTime() = %d, want %d", got, test.ticks)
+			}
+		})
+	}
+}
+
+func TestDotNetTicksRoundTrip(t *testing.T) {
+	berlin := time.FixedZone("CET", 3600)
+	tests := []time.Time{
+		time.Date(2021, 6, 15, 12, 34, 56, 123456700, time.UTC),
+		time.Date(2021, 6, 15, 13, 34, 56, 123456700, berlin),
+		time.Date(1955, 11, 5, 6, 15, 0, 100, time.UTC),
+		time.Date(1, 1, 1, 0, 0, 0, 100, time.UTC),
+	}
+
+	for _, value := range tests {
+		got := DotNetTicksFromTime(value).Time()
+		if !got.Equal(value) {
+			t.Errorf("round trip of %s = %s", value, got)
+		}
+		if got.Location() != time.UTC {
+			t.Errorf("round trip of %s is in %s, want UTC", value, got.Location())
+		}
+	}
+
+	// precision beyond 100ns is cut off, not rounded
+	value := time.Date(2021, 1, 1, 0, 0, 0, 199, time.UTC)
+	if got := DotNetTicksFromTime(value); got != ticks2021+1 {
+		t.Errorf("DotNetTicksFromTime(%s) = %d, want %d", value, got, ticks2021+1)
+	}
+}
+
+func TestDotNetTicksTimeIn(t *testing.T) {
+	berlin := time.FixedZone("CET", 3600)
+	got := ticks2021.TimeIn(berlin)
+	want := time.Date(2021, 1, 1, 0, 0, 0, 0, berlin)
+	if !got.Equal(want) {
+		t.Errorf("TimeIn() = %s, want %s", got, want)
+	}
+}
+
+func TestDotNetTicksFromBinary(t *testing.T) {
+	tests := []struct {
+		name   string
+		binary int64
+		ticks  DotNetTicks
+	}{
+		{"unspecified", int64(ticks2021), ticks2021},
+		{"utc", int64(ticks2021) | binaryKindUTC, ticks2021},
+		{"local", int64(ticks2021) | binaryKindLocal, ticks2021},
+		{"utc pre epoch", int64(ticks1900) | binaryKindUTC, ticks1900},
+		// 0001-01-01 00:30 at +01:00 is 30 minutes before the first tick in UTC
+		{"local wrapped", (binaryTicksCeiling - 30*60*ticksPerSecond) | binaryKindLocal, -30 * 60 * ticksPerSecond},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := DotNetTicksFromBinary(test.binary); got != test.ticks {
+				t.Errorf("DotNetTicksFromBinary(%#x) = %d, want %d", test.binary, got, test.ticks)
+			}
+		})
+	}
+}
+
+func TestDotNetTicksUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		json  string
+		ticks DotNetTicks
+	}{
+		{"number", `637450560000000000`, ticks2021},
+		{"negative number", `-1`, -1},
+		{"numeric string", `"637450560000000000"`, ticks2021},
+		{"empty string", `""`, 0},
+		{"utc", `"2021-01-01T00:00:00Z"`, ticks2021},
+		{"date time offset", `"2021-01-01T02:00:00+02:00"`, ticks2021},
+		{"date time offset west", `"2020-12-31T19:00:00.0000001-05:00"`, ticks2021 + 1},
+		{"seven digit fraction", `"2021-01-01T00:00:00.1234567+00:00"`, ticks2021 + 1234567},
+		{"unspecified kind", `"2021-01-01T00:00:00.1234567"`, ticks2021 + 1234567},
+		{"pre epoch", `"1900-01-01T00:00:00Z"`, ticks1900},
+		{"legacy", `"/Date(1609459200000)/"`, ticks2021},
+		{"legacy with offset", `"/Date(1609459200000+0100)/"`, ticks2021},
+		{"legacy pre epoch", `"/Date(-2208988800000)/"`, ticks1900},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var ticks DotNetTicks
+			if err := json.Unmarshal([]byte(test.json), &ticks); err != nil {
+				t.Fatal(err)
+			}
+			if ticks != test.ticks {
+				t.Errorf("got %d, want %d", ticks, test.ticks)
+			}
+		})
+	}
+}
+
+func TestDotNetTicksUnmarshalJSONKeepsNull(t *testing.T) {
+	ticks := ticks2021
+	if err := json.Unmarshal([]byte(`null`), &ticks); err != nil {
+		t.Fatal(err)
+	}
+	if ticks != ticks2021 {
+		t.Errorf("null changed the value to %d", ticks)
+	}
+}
+
+func TestDotNetTicksUnmarshalJSONInvalid(t *testing.T) {
+	for _, input := range []string{`1.5`, `"yesterday"`, `"2021-13-01T00:00:00Z"`, `true`} {
+		var ticks DotNetTicks
+		if err := json.Unmarshal([]byte(input), &ticks); err == nil {
+			t.Errorf("%s decoded to %d, want an error", input, ticks)
+		}
+	}
+}
+
+func TestDotNetTicksMarshalJSON(t *testing.T) {
+	message := &VRageChatMessage{Timestamp: ticks2021 + 1}
+	data, err := json.Marshal(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := &VRageChatMessage{}
+	if err := json.Unmarshal(data, decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Timestamp != message.Timestamp {
+		t.Errorf("round trip through %s gave %d", data, decoded.Timestamp)
+	}
+	if want := time.Date(2021, 1, 1, 0, 0, 0, 100, time.UTC); !decoded.Time().Equal(want) {
+		t.Errorf("Time() = %s, want %s", decoded.Time(), want)
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package govrageremote
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The client talks to /vrageremote/v1 and was written against API version 1.0.
+// Every 1.x version is accepted since minor versions only add to the API, servers
+// reporting an older or a new major version are handled according to the
+// VersionPolicy.
+const (
+	VRageMinAPIVersion   = "1.0"
+	VRageAPIMajorVersion = 1
+)
+
+type VRageVersionPolicy int
+
+const (
+	VRageVersionIgnore VRageVersionPolicy = iota // use the server whatever it reports
+	VRageVersionWarn                             // log a warning through the client logger
+	VRageVersionFail                             // refuse all further requests
+)
+
+type VRageUnsupportedAPIVersionError struct {
+	Version  string
+	Required string
+}
+
+func (err *VRageUnsupportedAPIVersionError) Error() string {
+	if err.Required != "" {
+		return fmt.Sprintf("remote api version %s required, server reports %s", err.Required, err.Version)
+	}
+	return fmt.Sprintf("remote api version %s is not supported, supported are %s and later %d.x versions", err.Version, VRageMinAPIVersion, VRageAPIMajorVersion)
+}
+
+// APIVersion returns the API version reported by the server, or an empty string
+// before the first response
+func (client *VRageRemoteClient) APIVersion() string {
+	client.versionMutex.Lock()
+	defer client.versionMutex.Unlock()
+	return client.apiVersion
+}
+
+// NegotiateAPIVersion pings the server if its API version is not known yet and
+// checks the version against the supported range
+func (client *VRageRemoteClient) NegotiateAPIVersion(ctx context.Context) (string, error) {
+	if client.APIVersion() == "" {
+		if _, _, err := client.Do(ctx, "GET", "server/ping", nil, nil, nil); err != nil {
+			return "", err
+		}
+	}
+
+	version := client.APIVersion()
+	if !IsSupportedAPIVersion(version) {
+		return version, &VRageUnsupportedAPIVersionError{Version: version}
+	}
+	return version, nil
+}
+
+// SupportsAPIVersion reports whether the server is known to run at least version
+// min. All endpoints of the client exist since 1.0, use it to guard features of
+// later API versions.
+func (client *VRageRemoteClient) SupportsAPIVersion(min string) bool {
+	version := client.APIVersion()
+	return version != "" && CompareAPIVersions(version, min) >= 0
+}
+
+// RequireAPIVersion returns an error unless the server is known to run at least version min
+func (client *VRageRemoteClient) RequireAPIVersion(min string) error {
+	if !client.SupportsAPIVersion(min) {
+		return &VRageUnsupportedAPIVersionError{Version: client.APIVersion(), Required: min}
+	}
+	return nil
+}
+
+// checkAPIVersion rejects all requests to a server running an unsupported
+// version if the VersionPolicy says so
+func (client *VRageRemoteClient) checkAPIVersion() error {
+	version := client.APIVersion()
+	if version == "" {
+		return nil
+	}
+
+	if client.VersionPolicy == VRageVersionFail && !IsSupportedAPIVersion(version) {
+		return &VRageUnsupportedAPIVersionError{Version: version}
+	}
+	return nil
+}
+
+// discoverAPIVersion remembers the version of the first response and every change
+// afterwards, a server may be updated while the client keeps running
+func (client *VRageRemoteClient) discoverAPIVersion(response *VRageRawResponse) error {
+	if response == nil || response.Meta == nil || response.Meta.ApiVersion == "" {
+		return nil
+	}
+	version := response.Meta.ApiVersion
+
+	client.versionMutex.Lock()
+	changed := client.apiVersion != version
+	client.apiVersion = version
+	client.versionMutex.Unlock()
+
+	if !changed || IsSupportedAPIVersion(version) {
+		return nil
+	}
+
+	switch client.VersionPolicy {
+	case VRageVersionWarn:
+		client.log().Warn("unsupported remote api version", "apiVersion", version, "min", VRageMinAPIVersion, "major", VRageAPIMajorVersion)
+	case VRageVersionFail:
+		return &VRageUnsupportedAPIVersionError{Version: version}
+	}
+	return nil
+}
+
+// IsSupportedAPIVersion reports whether version is at least VRageMinAPIVersion
+// and has the major version VRageAPIMajorVersion
+func IsSupportedAPIVersion(version string) bool {
+	major, _ := strconv.Atoi(strings.SplitN(version, ".", 2)[0])
+	return major == VRageAPIMajorVersion && CompareAPIVersions(version, VRageMinAPIVersion) >= 0
+}
+
+// CompareAPIVersions compares dotted version numbers like 1.0 and 1.2.3 and
+// returns -1, 0 or 1. Missing or non numeric parts count as zero.
+func CompareAPIVersions(a string, b string) int {
+	as := strings.Split(a, ".")
+	bs := strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x < y {
+			return -1
+		}
+		if x > y {
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,186 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package govrageremote
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// versionServer answers every request with the API version in *version and
+// records the requests it got
+type versionServer struct {
+	*httptest.Server
+	mutex    sync.Mutex
+	version  string
+	requests []string
+}
+
+func newVersionServer(t *testing.T, version string) *versionServer {
+	server := &versionServer{version: version}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		server.mutex.Lock()
+		server.requests = append(server.requests, request.Method+" "+request.URL.Path)
+		version := server.version
+		server.mutex.Unlock()
+		fmt.Fprintf(writer, `{"data":{"ServerName":"test"},"meta":{"apiVersion":%q,"queryTime":1}}`, version)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (server *versionServer) setVersion(version string) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.version = version
+}
+
+func (server *versionServer) sent() []string {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return append([]string(nil), server.requests...)
+}
+
+type warnRecorder struct {
+	vrageNopLogger
+	mutex    sync.Mutex
+	warnings []string
+}
+
+func (logger *warnRecorder) Warn(msg string, args ...interface{}) {
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+	logger.warnings = append(logger.warnings, msg)
+}
+
+func TestIsSupportedAPIVersion(t *testing.T) {
+	tests := map[string]bool{
+		"1.0":   true,
+		"1.1":   true,
+		"1.2.3": true,
+		"0.9":   false,
+		"2.0":   false,
+		"":      false,
+		"x":     false,
+	}
+	for version, want := range tests {
+		if got := IsSupportedAPIVersion(version); got != want {
+			t.Errorf("IsSupportedAPIVersion(%q) = %t, want %t", version, got, want)
+		}
+	}
+}
+
+func TestVersionPolicyWarn(t *testing.T) {
+	server := newVersionServer(t, "2.0")
+	client := NewVRageRemoteClient(server.URL, "c2VjcmV0")
+	logger := &warnRecorder{}
+	client.SetLogger(logger, 0)
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.GetServerInfo(); err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+	}
+	if err := client.DeleteGrid(1); err != nil {
+		t.Fatal(err)
+	}
+	if client.APIVersion() != "2.0" {
+		t.Errorf("APIVersion() = %q", client.APIVersion())
+	}
+	// the warning is logged once per version, not per request
+	if len(logger.warnings) != 1 {
+		t.Errorf("got warnings %v, want one", logger.warnings)
+	}
+	if got := len(server.sent()); got != 3 {
+		t.Errorf("server got %d requests, want 3", got)
+	}
+}
+
+func TestVersionPolicyFail(t *testing.T) {
+	server := newVersionServer(t, "2.0")
+	client := NewVRageRemoteClient(server.URL, "c2VjcmV0")
+	client.VersionPolicy = VRageVersionFail
+
+	// the first write negotiates the version and never reaches the server
+	var versionErr *VRageUnsupportedAPIVersionError
+	if err := client.DeleteGrid(1); !errors.As(err, &versionErr) {
+		t.Fatalf("DeleteGrid() error = %v, want VRageUnsupportedAPIVersionError", err)
+	}
+	if _, err := client.GetServerInfo(); !errors.As(err, &versionErr) {
+		t.Fatalf("GetServerInfo() error = %v, want VRageUnsupportedAPIVersionError", err)
+	}
+
+	sent := server.sent()
+	if len(sent) != 1 || sent[0] != "GET /vrageremote/v1/server/ping" {
+		t.Errorf("server got %v, want only the ping", sent)
+	}
+}
+
+func TestVersionPolicyFailSupported(t *testing.T) {
+	server := newVersionServer(t, "1.0")
+	client := NewVRageRemoteClient(server.URL, "c2VjcmV0")
+	client.VersionPolicy = VRageVersionFail
+
+	if err := client.DeleteGrid(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.DeleteGrid(2); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"GET /vrageremote/v1/server/ping", "DELETE /vrageremote/v1/session/grids/1", "DELETE /vrageremote/v1/session/grids/2"}
+	if sent := server.sent(); fmt.Sprint(sent) != fmt.Sprint(want) {
+		t.Errorf("server got %v, want %v", sent, want)
+	}
+}
+
+func TestVersionChangeMidSession(t *testing.T) {
+	server := newVersionServer(t, "1.0")
+	client := NewVRageRemoteClient(server.URL, "c2VjcmV0")
+	client.VersionPolicy = VRageVersionFail
+
+	if _, err := client.GetServerInfo(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a compatible update is picked up
+	server.setVersion("1.2")
+	if _, err := client.GetServerInfo(); err != nil {
+		t.Fatal(err)
+	}
+	if client.APIVersion() != "1.2" {
+		t.Errorf("APIVersion() = %q, want 1.2", client.APIVersion())
+	}
+	if !client.SupportsAPIVersion("1.1") || client.RequireAPIVersion("1.3") == nil {
+		t.Error("SupportsAPIVersion and RequireAPIVersion do not follow the new version")
+	}
+
+	// the response reporting the new major version fails, later requests are not sent
+	server.setVersion("2.0")
+	var versionErr *VRageUnsupportedAPIVersionError
+	if _, err := client.GetServerInfo(); !errors.As(err, &versionErr) || versionErr.Version != "2.0" {
+		t.Fatalf("GetServerInfo() error = %v, want VRageUnsupportedAPIVersionError for 2.0", err)
+	}
+	before := len(server.sent())
+	if err := client.StopServer(); !errors.As(err, &versionErr) {
+		t.Fatalf("StopServer() error = %v, want VRageUnsupportedAPIVersionError", err)
+	}
+	if after := len(server.sent()); after != before {
+		t.Errorf("StopServer reached the server")
+	}
+}
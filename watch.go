@@ -0,0 +1,188 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package govrageremote
+
+import (
+	"fmt"
+	"sync"
+)
+
+//--
+//-- Chat
+//--
+
+// VRageChatWatcher reports chat messages which were not seen by a previous Poll
+type VRageChatWatcher struct {
+	client    *VRageRemoteClient
+	primed    bool
+	lastTicks int64
+	lastSeen  map[string]bool
+	mutex     sync.Mutex
+}
+
+// Poll returns the messages written since the last call, oldest first. The first
+// call only remembers the current chat history and returns nothing.
+func (watcher *VRageChatWatcher) Poll() ([]*VRageChatMessage, error) {
+	response, err := watcher.client.GetChat()
+	if err != nil {
+		return nil, err
+	}
+
+	if response.Data == nil {
+		return nil, nil
+	}
+
+	watcher.mutex.Lock()
+	defer watcher.mutex.Unlock()
+
+	var messages []*VRageChatMessage
+	for _, message := range response.Data.Messages {
+		ticks := int64(message.Timestamp)
+		key := chatMessageKey(message)
+
+		if ticks < watcher.lastTicks || (ticks == watcher.lastTicks && watcher.lastSeen[key]) {
+			continue
+		}
+		if ticks > watcher.lastTicks {
+			watcher.lastTicks = ticks
+			watcher.lastSeen = make(map[string]bool)
+		}
+		watcher.lastSeen[key] = true
+
+		if watcher.primed {
+			messages = append(messages, message)
+		}
+	}
+	watcher.primed = true
+
+	return messages, nil
+}
+
+func chatMessageKey(message *VRageChatMessage) string {
+	return fmt.Sprintf("%d\x00%d\x00%s", message.Timestamp, message.SteamID, message.Content)
+}
+
+func NewVRageChatWatcher(client *VRageRemoteClient) *VRageChatWatcher {
+	return &VRageChatWatcher{
+		client:   client,
+		lastSeen: make(map[string]bool),
+	}
+}
+
+//--
+//-- Players
+//--
+
+// VRagePlayerWatcher reports players joining and leaving between two polls
+type VRagePlayerWatcher struct {
+	client  *VRageRemoteClient
+	primed  bool
+	players map[SteamID]*VRageRemotePlayer
+	mutex   sync.Mutex
+}
+
+// Poll returns the players which joined and left since the last call. The first
+// call only remembers who is online and returns nothing.
+func (watcher *VRagePlayerWatcher) Poll() (joined []*VRageRemotePlayer, left []*VRageRemotePlayer, err error) {
+	response, err := watcher.client.GetPlayers()
+	if err != nil {
+		return nil, nil, err
+	}
+	if response.Data == nil {
+		return nil, nil, nil
+	}
+
+	watcher.mutex.Lock()
+	defer watcher.mutex.Unlock()
+
+	current := make(map[SteamID]*VRageRemotePlayer, len(response.Data.Players))
+	for _, player := range response.Data.Players {
+		current[player.SteamID] = player
+		if _, ok := watcher.players[player.SteamID]; !ok && watcher.primed {
+			joined = append(joined, player)
+		}
+	}
+	if watcher.primed {
+		for steamID, player := range watcher.players {
+			if _, ok := current[steamID]; !ok {
+				left = append(left, player)
+			}
+		}
+	}
+	watcher.players = current
+	watcher.primed = true
+
+	return joined, left, nil
+}
+
+func NewVRagePlayerWatcher(client *VRageRemoteClient) *VRagePlayerWatcher {
+	return &VRagePlayerWatcher{
+		client:  client,
+		players: make(map[SteamID]*VRageRemotePlayer),
+	}
+}
+
+//--
+//-- Grids
+//--
+
+// VRageGridWatcher reports grids appearing and disappearing between two polls
+type VRageGridWatcher struct {
+	client *VRageRemoteClient
+	primed bool
+	grids  map[EntityID]*VRageRemoteGrid
+	mutex  sync.Mutex
+}
+
+// Poll returns the grids which were added and removed since the last call. The
+// first call only remembers the current grids and returns nothing.
+func (watcher *VRageGridWatcher) Poll() (added []*VRageRemoteGrid, removed []*VRageRemoteGrid, err error) {
+	response, err := watcher.client.GetGrids()
+	if err != nil {
+		return nil, nil, err
+	}
+	if response.Data == nil {
+		return nil, nil, nil
+	}
+
+	watcher.mutex.Lock()
+	defer watcher.mutex.Unlock()
+
+	current := make(map[EntityID]*VRageRemoteGrid, len(response.Data.Grids))
+	for _, grid := range response.Data.Grids {
+		current[grid.EntityID] = grid
+		if _, ok := watcher.grids[grid.EntityID]; !ok && watcher.primed {
+			added = append(added, grid)
+		}
+	}
+	if watcher.primed {
+		for entityID, grid := range watcher.grids {
+			if _, ok := current[entityID]; !ok {
+				removed = append(removed, grid)
+			}
+		}
+	}
+	watcher.grids = current
+	watcher.primed = true
+
+	return added, removed, nil
+}
+
+func NewVRageGridWatcher(client *VRageRemoteClient) *VRageGridWatcher {
+	return &VRageGridWatcher{
+		client: client,
+		grids:  make(map[EntityID]*VRageRemoteGrid),
+	}
+}
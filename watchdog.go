@@ -0,0 +1,357 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package govrageremote
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+//--
+//-- Alerts
+//--
+
+type VRageAlertKind string
+
+const (
+	VRageAlertSimSpeed    VRageAlertKind = "simspeed"
+	VRageAlertCPULoad     VRageAlertKind = "cpuload"
+	VRageAlertNotReady    VRageAlertKind = "notready"
+	VRageAlertLatency     VRageAlertKind = "latency"
+	VRageAlertUnreachable VRageAlertKind = "unreachable"
+)
+
+type VRageAlertState string
+
+const (
+	VRageAlertRaised   VRageAlertState = "raised"
+	VRageAlertResolved VRageAlertState = "resolved"
+)
+
+type VRageAlert struct {
+	Kind      VRageAlertKind
+	State     VRageAlertState
+	Message   string
+	Value     float64
+	Threshold float64
+	Since     time.Time
+	Time      time.Time
+}
+
+func (alert *VRageAlert) String() string {
+	return fmt.Sprintf("[%s] %s: %s", alert.State, alert.Kind, alert.Message)
+}
+
+type VRageAlertNotifier interface {
+	Notify(alert *VRageAlert) error
+}
+
+// VRageAlertNotifierFunc adapts a callback to a VRageAlertNotifier
+type VRageAlertNotifierFunc func(alert *VRageAlert) error
+
+func (fnc VRageAlertNotifierFunc) Notify(alert *VRageAlert) error {
+	return fnc(alert)
+}
+
+// VRageWriterNotifier writes one line per alert
+type VRageWriterNotifier struct {
+	Writer io.Writer
+}
+
+func (notifier *VRageWriterNotifier) Notify(alert *VRageAlert) error {
+	_, err := fmt.Fprintf(notifier.Writer, "%s %s\n", alert.Time.Format(time.RFC3339), alert)
+	return err
+}
+
+func NewVRageStdoutNotifier() *VRageWriterNotifier {
+	return &VRageWriterNotifier{Writer: os.Stdout}
+}
+
+// defaultWebhookClient is used by webhook notifiers created without NewVRageWebhookNotifier
+var defaultWebhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// VRageWebhookNotifier posts every alert as JSON to URL
+type VRageWebhookNotifier struct {
+	URL        string
+	httpClient *http.Client
+}
+
+func (notifier *VRageWebhookNotifier) Notify(alert *VRageAlert) error {
+	data, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+
+	httpClient := notifier.httpClient
+	if httpClient == nil {
+		httpClient = defaultWebhookClient
+	}
+	response, err := httpClient.Post(notifier.URL, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with %s", response.Status)
+	}
+	return nil
+}
+
+func NewVRageWebhookNotifier(url string) *VRageWebhookNotifier {
+	return &VRageWebhookNotifier{
+		URL:        url,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+//--
+//-- Watchdog
+//--
+
+// VRageWatchdogCheck describes when an alert is raised and resolved. An alert is
+// raised once the value crossed Threshold for at least For and is resolved once
+// the value crossed Recover for at least RecoverFor. Keeping Recover apart from
+// Threshold avoids flapping alerts.
+type VRageWatchdogCheck struct {
+	Enabled    bool
+	Threshold  float64
+	Recover    float64
+	For        time.Duration
+	RecoverFor time.Duration
+}
+
+type VRageWatchdogConfig struct {
+	Interval    time.Duration
+	SimSpeed    VRageWatchdogCheck // raised when SimSpeed falls below Threshold
+	CPULoad     VRageWatchdogCheck // raised when SimulationCPULoad rises above Threshold
+	Latency     VRageWatchdogCheck // raised when the ping takes longer than Threshold milliseconds
+	NotReady    VRageWatchdogCheck // raised when IsReady is false, thresholds are unused
+	Unreachable VRageWatchdogCheck // raised when the server does not answer, thresholds are unused
+}
+
+func DefaultVRageWatchdogConfig() VRageWatchdogConfig {
+	return VRageWatchdogConfig{
+		Interval:    10 * time.Second,
+		SimSpeed:    VRageWatchdogCheck{Enabled: true, Threshold: 0.7, Recover: 0.85, For: 30 * time.Second, RecoverFor: 30 * time.Second},
+		CPULoad:     VRageWatchdogCheck{Enabled: true, Threshold: 90, Recover: 75, For: 30 * time.Second, RecoverFor: 30 * time.Second},
+		Latency:     VRageWatchdogCheck{Enabled: true, Threshold: 1000, Recover: 500, For: 30 * time.Second, RecoverFor: 30 * time.Second},
+		NotReady:    VRageWatchdogCheck{Enabled: true, For: 30 * time.Second, RecoverFor: 10 * time.Second},
+		Unreachable: VRageWatchdogCheck{Enabled: true, For: 15 * time.Second, RecoverFor: 10 * time.Second},
+	}
+}
+
+type watchdogCheckState struct {
+	raised     bool
+	badSince   time.Time
+	goodSince  time.Time
+	raisedTime time.Time
+}
+
+// update returns the new alert state if the check changed its state
+func (state *watchdogCheckState) update(check *VRageWatchdogCheck, now time.Time, bad bool, good bool) (VRageAlertState, bool) {
+	if !state.raised {
+		if !bad {
+			state.badSince = time.Time{}
+			return "", false
+		}
+		if state.badSince.IsZero() {
+			state.badSince = now
+		}
+		if now.Sub(state.badSince) >= check.For {
+			state.raised = true
+			state.raisedTime = state.badSince
+			state.goodSince = time.Time{}
+			return VRageAlertRaised, true
+		}
+		return "", false
+	}
+
+	if !good {
+		state.goodSince = time.Time{}
+		return "", false
+	}
+	if state.goodSince.IsZero() {
+		state.goodSince = now
+	}
+	if now.Sub(state.goodSince) >= check.RecoverFor {
+		state.raised = false
+		state.badSince = time.Time{}
+		return VRageAlertResolved, true
+	}
+	return "", false
+}
+
+// interrupt forgets a pending raise or resolve while the value can not be
+// measured, so the next sample has to hold for the full duration again
+func (state *watchdogCheckState) interrupt() {
+	state.badSince = time.Time{}
+	state.goodSince = time.Time{}
+}
+
+type VRageWatchdog struct {
+	client    *VRageRemoteClient
+	Config    VRageWatchdogConfig
+	notifiers []VRageAlertNotifier
+	states    map[VRageAlertKind]*watchdogCheckState
+	mutex     sync.Mutex
+	OnError   func(err error)
+}
+
+func (watchdog *VRageWatchdog) AddNotifier(notifier VRageAlertNotifier) {
+	watchdog.mutex.Lock()
+	defer watchdog.mutex.Unlock()
+	watchdog.notifiers = append(watchdog.notifiers, notifier)
+}
+
+// Raised returns the kinds of all currently raised alerts
+func (watchdog *VRageWatchdog) Raised() []VRageAlertKind {
+	watchdog.mutex.Lock()
+	defer watchdog.mutex.Unlock()
+
+	var kinds []VRageAlertKind
+	for kind, state := range watchdog.states {
+		if state.raised {
+			kinds = append(kinds, kind)
+		}
+	}
+	return kinds
+}
+
+// Run polls the server every Config.Interval until stop is closed
+func (watchdog *VRageWatchdog) Run(stop <-chan struct{}) {
+	interval := watchdog.Config.Interval
+	if interval <= 0 {
+		interval = DefaultVRageWatchdogConfig().Interval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	watchdog.Poll()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			watchdog.Poll()
+		}
+	}
+}
+
+// Poll queries the server once, evaluates all checks and notifies about changed alerts
+func (watchdog *VRageWatchdog) Poll() []*VRageAlert {
+	now := time.Now()
+
+	var info *VRageRemoteServerInfo
+	latency, err := watchdog.client.Ping()
+	if err == nil {
+		var response *VRageRemoteServerInfoResponse
+		response, err = watchdog.client.GetServerInfo()
+		if err == nil {
+			info = response.Data
+			if info == nil {
+				err = errors.New("server info response without data")
+			}
+		}
+	}
+
+	watchdog.mutex.Lock()
+
+	var alerts []*VRageAlert
+	evaluate := func(kind VRageAlertKind, check *VRageWatchdogCheck, value float64, bad bool, good bool, message string) {
+		if !check.Enabled {
+			return
+		}
+		state, ok := watchdog.states[kind]
+		if !ok {
+			state = &watchdogCheckState{}
+			watchdog.states[kind] = state
+		}
+		if alertState, changed := state.update(check, now, bad, good); changed {
+			alerts = append(alerts, &VRageAlert{
+				Kind:      kind,
+				State:     alertState,
+				Message:   message,
+				Value:     value,
+				Threshold: check.Threshold,
+				Since:     state.raisedTime,
+				Time:      now,
+			})
+		}
+	}
+
+	interrupt := func(kinds ...VRageAlertKind) {
+		for _, kind := range kinds {
+			if state, ok := watchdog.states[kind]; ok {
+				state.interrupt()
+			}
+		}
+	}
+
+	config := &watchdog.Config
+	if err != nil {
+		evaluate(VRageAlertUnreachable, &config.Unreachable, 0, true, false, "server is not answering: "+err.Error())
+		interrupt(VRageAlertLatency, VRageAlertNotReady, VRageAlertSimSpeed, VRageAlertCPULoad)
+	} else {
+		evaluate(VRageAlertUnreachable, &config.Unreachable, 0, false, true, "server is answering again")
+
+		ms := float64(latency) / float64(time.Millisecond)
+		evaluate(VRageAlertLatency, &config.Latency, ms, ms > config.Latency.Threshold, ms <= config.Latency.Recover,
+			fmt.Sprintf("ping took %.0fms", ms))
+
+		evaluate(VRageAlertNotReady, &config.NotReady, 0, !info.IsReady, info.IsReady,
+			fmt.Sprintf("server ready: %t", info.IsReady))
+
+		// SimSpeed and CPU load are meaningless while the server is still loading
+		if info.IsReady {
+			evaluate(VRageAlertSimSpeed, &config.SimSpeed, info.SimSpeed, info.SimSpeed < config.SimSpeed.Threshold, info.SimSpeed >= config.SimSpeed.Recover,
+				fmt.Sprintf("sim speed is %.2f", info.SimSpeed))
+			evaluate(VRageAlertCPULoad, &config.CPULoad, info.SimulationCPULoad, info.SimulationCPULoad > config.CPULoad.Threshold, info.SimulationCPULoad <= config.CPULoad.Recover,
+				fmt.Sprintf("simulation cpu load is %.1f%%", info.SimulationCPULoad))
+		} else {
+			interrupt(VRageAlertSimSpeed, VRageAlertCPULoad)
+		}
+	}
+
+	notifiers := make([]VRageAlertNotifier, len(watchdog.notifiers))
+	copy(notifiers, watchdog.notifiers)
+	watchdog.mutex.Unlock()
+
+	for _, alert := range alerts {
+		for _, notifier := range notifiers {
+			if err := notifier.Notify(alert); err != nil && watchdog.OnError != nil {
+				watchdog.OnError(err)
+			}
+		}
+	}
+
+	return alerts
+}
+
+func NewVRageWatchdog(client *VRageRemoteClient, config VRageWatchdogConfig, notifiers ...VRageAlertNotifier) *VRageWatchdog {
+	return &VRageWatchdog{
+		client:    client,
+		Config:    config,
+		notifiers: notifiers,
+		states:    make(map[VRageAlertKind]*watchdogCheckState),
+	}
+}
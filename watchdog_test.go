@@ -0,0 +1,121 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package govrageremote
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWatchdogCheckState(t *testing.T) {
+	type step struct {
+		at     int    // seconds since the start
+		sample string // bad, good, neutral (between Threshold and Recover) or interrupt
+		want   VRageAlertState
+	}
+	tests := []struct {
+		name  string
+		check VRageWatchdogCheck
+		steps []step
+	}{
+		{
+			"raised once bad for For",
+			VRageWatchdogCheck{For: 30 * time.Second, RecoverFor: 30 * time.Second},
+			[]step{{0, "bad", ""}, {10, "bad", ""}, {29, "bad", ""}, {30, "bad", VRageAlertRaised}, {40, "bad", ""}},
+		},
+		{
+			"raised at once without For",
+			VRageWatchdogCheck{},
+			[]step{{0, "neutral", ""}, {10, "bad", VRageAlertRaised}, {20, "bad", ""}},
+		},
+		{
+			"a sample which is not bad starts over",
+			VRageWatchdogCheck{For: 30 * time.Second, RecoverFor: 30 * time.Second},
+			[]step{{0, "bad", ""}, {20, "neutral", ""}, {30, "bad", ""}, {50, "bad", ""}, {60, "bad", VRageAlertRaised}},
+		},
+		{
+			"an interruption starts over",
+			VRageWatchdogCheck{For: 30 * time.Second, RecoverFor: 30 * time.Second},
+			[]step{{0, "bad", ""}, {15, "interrupt", ""}, {20, "bad", ""}, {45, "bad", ""}, {50, "bad", VRageAlertRaised}},
+		},
+		{
+			"resolved once good for RecoverFor",
+			VRageWatchdogCheck{For: 0, RecoverFor: 30 * time.Second},
+			[]step{{0, "bad", VRageAlertRaised}, {10, "good", ""}, {39, "good", ""}, {40, "good", VRageAlertResolved}, {50, "good", ""}},
+		},
+		{
+			"resolved at once without RecoverFor",
+			VRageWatchdogCheck{},
+			[]step{{0, "bad", VRageAlertRaised}, {10, "neutral", ""}, {20, "good", VRageAlertResolved}},
+		},
+		{
+			"staying between the thresholds keeps the alert",
+			VRageWatchdogCheck{For: 0, RecoverFor: 30 * time.Second},
+			[]step{{0, "bad", VRageAlertRaised}, {10, "good", ""}, {30, "neutral", ""}, {40, "good", ""}, {60, "neutral", ""}, {100, "neutral", ""}},
+		},
+		{
+			"an interruption restarts the recovery",
+			VRageWatchdogCheck{For: 0, RecoverFor: 30 * time.Second},
+			[]step{{0, "bad", VRageAlertRaised}, {10, "good", ""}, {20, "interrupt", ""}, {30, "good", ""}, {50, "good", ""}, {60, "good", VRageAlertResolved}},
+		},
+		{
+			"a new alert needs For again",
+			VRageWatchdogCheck{For: 20 * time.Second, RecoverFor: 10 * time.Second},
+			[]step{{0, "bad", ""}, {20, "bad", VRageAlertRaised}, {30, "good", ""}, {40, "good", VRageAlertResolved}, {50, "bad", ""}, {60, "bad", ""}, {70, "bad", VRageAlertRaised}},
+		},
+	}
+
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, test := range tests {
+		state := &watchdogCheckState{}
+		raised := false
+		for _, step := range test.steps {
+			now := start.Add(time.Duration(step.at) * time.Second)
+			if step.sample == "interrupt" {
+				state.interrupt()
+				continue
+			}
+			got, changed := state.update(&test.check, now, step.sample == "bad", step.sample == "good")
+			if changed != (step.want != "") || got != step.want {
+				t.Errorf("%s: at %ds got %q, %t, want %q", test.name, step.at, got, changed, step.want)
+			}
+			if got == VRageAlertRaised && now.Sub(state.raisedTime) < test.check.For {
+				t.Errorf("%s: raised at %ds with a bad value since %s", test.name, step.at, state.raisedTime)
+			}
+			if step.want != "" {
+				raised = step.want == VRageAlertRaised
+			}
+			if state.raised != raised {
+				t.Errorf("%s: at %ds raised is %t", test.name, step.at, state.raised)
+			}
+		}
+	}
+}
+
+func TestWatchdogCheckStateSince(t *testing.T) {
+	check := &VRageWatchdogCheck{For: 30 * time.Second}
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	state := &watchdogCheckState{}
+
+	state.update(check, start, false, true)
+	state.update(check, start.Add(10*time.Second), true, false)
+	if _, changed := state.update(check, start.Add(40*time.Second), true, false); !changed || !state.raised {
+		t.Fatal("alert not raised")
+	}
+	// the alert counts from the first bad sample, not from when it was raised
+	if !state.raisedTime.Equal(start.Add(10 * time.Second)) {
+		t.Errorf("raised since %s", state.raisedTime)
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package webadmin
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"gopkg.in/uranoxyd/govrageremote.v2"
+	"gopkg.in/uranoxyd/govrageremote.v2/access"
+)
+
+type action struct {
+	remote string // the Remote API call made, like "DELETE session/grids/*", it decides the required role
+	run    func(client *govrageremote.VRageRemoteClient, form url.Values) error
+}
+
+func (action *action) rule() access.Rule {
+	parts := strings.SplitN(action.remote, " ", 2)
+	return access.LookupPattern(parts[0], parts[1])
+}
+
+func playerAction(remote string, fnc func(client *govrageremote.VRageRemoteClient, id govrageremote.SteamID) error) *action {
+	return &action{remote: remote, run: func(client *govrageremote.VRageRemoteClient, form url.Values) error {
+		id, err := govrageremote.ParseSteamID(form.Get("id"))
+		if err != nil {
+			return err
+		}
+		return fnc(client, id)
+	}}
+}
+
+func gridAction(remote string, fnc func(client *govrageremote.VRageRemoteClient, id govrageremote.EntityID) error) *action {
+	return &action{remote: remote, run: func(client *govrageremote.VRageRemoteClient, form url.Values) error {
+		id, err := govrageremote.ParseEntityID(form.Get("id"))
+		if err != nil {
+			return err
+		}
+		return fnc(client, id)
+	}}
+}
+
+// actions are posted to /servers/<name>/action with the action name in the form
+var actions = map[string]*action{
+	"kick":     playerAction("POST admin/kickedPlayers/*", (*govrageremote.VRageRemoteClient).KickPlayer),
+	"unkick":   playerAction("DELETE admin/kickedPlayers/*", (*govrageremote.VRageRemoteClient).UnkickPlayer),
+	"ban":      playerAction("POST admin/bannedPlayers/*", (*govrageremote.VRageRemoteClient).BanPlayer),
+	"unban":    playerAction("DELETE admin/bannedPlayers/*", (*govrageremote.VRageRemoteClient).UnbanPlayer),
+	"promote":  playerAction("POST admin/promotedPlayers/*", (*govrageremote.VRageRemoteClient).PromotePlayer),
+	"demote":   playerAction("DELETE admin/promotedPlayers/*", (*govrageremote.VRageRemoteClient).DemotePlayer),
+	"stop":     gridAction("PATCH session/grids/*", (*govrageremote.VRageRemoteClient).StopGrid),
+	"delete":   gridAction("DELETE session/grids/*", (*govrageremote.VRageRemoteClient).DeleteGrid),
+	"poweron":  gridAction("POST session/poweredGrids/*", (*govrageremote.VRageRemoteClient).PowerUpGrid),
+	"poweroff": gridAction("DELETE session/poweredGrids/*", (*govrageremote.VRageRemoteClient).PowerDownGrid),
+
+	"save": {remote: "PATCH session", run: func(client *govrageremote.VRageRemoteClient, form url.Values) error {
+		if name := strings.TrimSpace(form.Get("name")); name != "" {
+			return client.SaveAs(name)
+		}
+		return client.Save()
+	}},
+	"shutdown": {remote: "DELETE server", run: func(client *govrageremote.VRageRemoteClient, form url.Values) error {
+		return client.StopServer()
+	}},
+	"chat": {remote: "POST session/chat", run: func(client *govrageremote.VRageRemoteClient, form url.Values) error {
+		message := strings.TrimSpace(form.Get("message"))
+		if message == "" {
+			return errors.New("message must not be empty")
+		}
+		return client.SendChat(message)
+	}},
+}
+
+// allowedActions tells the templates which buttons to show
+func allowedActions(role access.Role) map[string]bool {
+	allowed := make(map[string]bool, len(actions))
+	for name, action := range actions {
+		allowed[name] = role.Includes(action.rule().Role)
+	}
+	return allowed
+}
+
+func (panel *Panel) serveAction(writer http.ResponseWriter, request *http.Request, session *session, server *Server) {
+	if request.Method != http.MethodPost {
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !panel.checkCSRF(session, request) {
+		http.Error(writer, "invalid form, reload the page", http.StatusForbidden)
+		return
+	}
+
+	back := request.PostFormValue("back")
+	if !strings.HasPrefix(back, "/servers/"+server.Name+"/") {
+		back = "/servers/" + server.Name + "/"
+	}
+
+	name := request.PostFormValue("action")
+	action, ok := actions[name]
+	if !ok {
+		http.Error(writer, "unknown action", http.StatusBadRequest)
+		return
+	}
+
+	user := session.user
+	rule := action.rule()
+	target := request.PostFormValue("id") + request.PostFormValue("name")
+	if !user.Role.Includes(rule.Role) {
+		panel.logf("denied %s (%s) %s %s on %s", user.Name, user.Role, rule.Action, target, server.Name)
+		panel.setFlash(session, rule.Action+" requires the "+string(rule.Role)+" role")
+		http.Redirect(writer, request, back, http.StatusSeeOther)
+		return
+	}
+
+	err := action.run(server.client, request.PostForm)
+	if err != nil {
+		panel.logf("%s (%s) %s %s on %s failed: %s", user.Name, user.Role, rule.Action, target, server.Name, err)
+		panel.setFlash(session, rule.Action+" failed: "+err.Error())
+	} else {
+		panel.logf("%s (%s) %s %s on %s", user.Name, user.Role, rule.Action, target, server.Name)
+		panel.setFlash(session, rule.Action+" done")
+	}
+	http.Redirect(writer, request, back, http.StatusSeeOther)
+}
@@ -0,0 +1,224 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package webadmin
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/uranoxyd/govrageremote.v2"
+	"gopkg.in/uranoxyd/govrageremote.v2/query"
+)
+
+var templateFuncs = template.FuncMap{
+	"ticks": func(ticks govrageremote.DotNetTicks) string {
+		return ticks.Time().Local().Format("2006-01-02 15:04:05")
+	},
+	"duration": func(duration time.Duration) string {
+		return duration.Round(time.Millisecond).String()
+	},
+}
+
+// render executes the layout of a page, data is merged into the common page data
+func (panel *Panel) render(writer http.ResponseWriter, page string, session *session, data map[string]interface{}) {
+	values := map[string]interface{}{
+		"Page":    page,
+		"Servers": panel.serverNames(),
+	}
+	if session != nil {
+		values["User"] = session.user
+		values["CSRF"] = session.csrf
+		values["Can"] = allowedActions(session.user.Role)
+		values["Flash"] = panel.takeFlash(session)
+	}
+	for key, value := range data {
+		values[key] = value
+	}
+
+	writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := panel.pages[page].ExecuteTemplate(writer, "layout", values); err != nil {
+		panel.logf("rendering %s failed: %s", page, err)
+	}
+}
+
+func (panel *Panel) serveDashboard(writer http.ResponseWriter, request *http.Request, session *session, server *Server) {
+	data := map[string]interface{}{"Server": server.Name}
+
+	latency, err := server.client.Ping()
+	if err != nil {
+		data["Error"] = err.Error()
+	} else {
+		data["Latency"] = latency
+		response, err := server.client.GetServerInfo()
+		if err != nil {
+			data["Error"] = err.Error()
+		} else {
+			data["Info"] = response.Data
+		}
+	}
+
+	panel.render(writer, "dashboard", session, data)
+}
+
+func (panel *Panel) servePlayers(writer http.ResponseWriter, request *http.Request, session *session, server *Server) {
+	data := map[string]interface{}{"Server": server.Name}
+	var errs []string
+
+	if response, err := server.client.GetPlayers(); err != nil {
+		errs = append(errs, err.Error())
+	} else if response.Data != nil {
+		data["Players"] = response.Data.Players
+	}
+	if response, err := server.client.GetBannedPlayers(); err != nil {
+		errs = append(errs, err.Error())
+	} else if response.Data != nil {
+		data["Banned"] = response.Data.BannedPlayers
+	}
+	if response, err := server.client.GetKickedPlayers(); err != nil {
+		errs = append(errs, err.Error())
+	} else if response.Data != nil {
+		data["Kicked"] = response.Data.KickedPlayers
+	}
+	if errs != nil {
+		data["Error"] = strings.Join(errs, "; ")
+	}
+
+	panel.render(writer, "players", session, data)
+}
+
+// gridColumns are the sortable columns of the grid table
+var gridColumns = map[string]func(a *govrageremote.VRageRemoteGrid, b *govrageremote.VRageRemoteGrid) bool{
+	"name": func(a, b *govrageremote.VRageRemoteGrid) bool {
+		return strings.ToLower(a.DisplayName) < strings.ToLower(b.DisplayName)
+	},
+	"owner": func(a, b *govrageremote.VRageRemoteGrid) bool {
+		return strings.ToLower(a.OwnerDisplayName) < strings.ToLower(b.OwnerDisplayName)
+	},
+	"pcu": func(a, b *govrageremote.VRageRemoteGrid) bool {
+		return a.PCU < b.PCU
+	},
+	"mass": func(a, b *govrageremote.VRageRemoteGrid) bool {
+		return a.Mass < b.Mass
+	},
+	"blocks": func(a, b *govrageremote.VRageRemoteGrid) bool {
+		return a.BlocksCount < b.BlocksCount
+	},
+	"speed": func(a, b *govrageremote.VRageRemoteGrid) bool {
+		return a.LinearSpeed < b.LinearSpeed
+	},
+	"player": func(a, b *govrageremote.VRageRemoteGrid) bool {
+		return a.DistanceToPlayer < b.DistanceToPlayer
+	},
+}
+
+// serveGrids lists the grids, ?search= matches name and owner, ?filter= takes a
+// query expression and ?sort= and ?order= sort the table
+func (panel *Panel) serveGrids(writer http.ResponseWriter, request *http.Request, session *session, server *Server) {
+	params := request.URL.Query()
+	search := strings.ToLower(strings.TrimSpace(params.Get("search")))
+	filterSource := strings.TrimSpace(params.Get("filter"))
+	sortBy := params.Get("sort")
+	if _, ok := gridColumns[sortBy]; !ok {
+		sortBy = "pcu"
+	}
+	descending := params.Get("order") != "asc"
+
+	data := map[string]interface{}{
+		"Server":     server.Name,
+		"Search":     params.Get("search"),
+		"Filter":     filterSource,
+		"Sort":       sortBy,
+		"Descending": descending,
+	}
+
+	response, err := server.client.GetGrids()
+	if err != nil {
+		data["Error"] = err.Error()
+		panel.render(writer, "grids", session, data)
+		return
+	}
+	var grids []*govrageremote.VRageRemoteGrid
+	if response.Data != nil {
+		grids = response.Data.Grids
+	}
+	total := len(grids)
+
+	if search != "" {
+		var matches []*govrageremote.VRageRemoteGrid
+		for _, grid := range grids {
+			if strings.Contains(strings.ToLower(grid.DisplayName), search) || strings.Contains(strings.ToLower(grid.OwnerDisplayName), search) {
+				matches = append(matches, grid)
+			}
+		}
+		grids = matches
+	}
+
+	if filterSource != "" {
+		filter, err := query.Compile(filterSource, query.NewClientResolver(server.client))
+		if err == nil {
+			grids, err = filter.Grids(grids)
+		}
+		if err != nil {
+			data["Error"] = "filter: " + err.Error()
+			grids = nil
+		}
+	}
+
+	less := gridColumns[sortBy]
+	sort.SliceStable(grids, func(i, j int) bool {
+		if descending {
+			return less(grids[j], grids[i])
+		}
+		return less(grids[i], grids[j])
+	})
+
+	// clicking the sorted column again reverses the order
+	links := make(map[string]string, len(gridColumns))
+	for column := range gridColumns {
+		link := url.Values{"sort": {column}, "order": {"desc"}}
+		if column == sortBy && descending {
+			link.Set("order", "asc")
+		}
+		if search != "" {
+			link.Set("search", params.Get("search"))
+		}
+		if filterSource != "" {
+			link.Set("filter", filterSource)
+		}
+		links[column] = "?" + link.Encode()
+	}
+
+	data["Grids"] = grids
+	data["Total"] = total
+	data["SortLinks"] = links
+	panel.render(writer, "grids", session, data)
+}
+
+func (panel *Panel) serveChat(writer http.ResponseWriter, request *http.Request, session *session, server *Server) {
+	data := map[string]interface{}{"Server": server.Name}
+
+	response, err := server.client.GetChat()
+	if err != nil {
+		data["Error"] = err.Error()
+	} else if response.Data != nil {
+		data["Messages"] = response.Data.Messages
+	}
+
+	panel.render(writer, "chat", session, data)
+}
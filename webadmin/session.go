@@ -0,0 +1,188 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package webadmin
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"time"
+
+	"gopkg.in/uranoxyd/govrageremote.v2/access"
+)
+
+const sessionCookie = "vrage_session"
+
+type session struct {
+	id      string
+	user    *access.User
+	csrf    string // sent with every form, so other sites can not post actions
+	flash   string // message shown once on the next page
+	expires time.Time
+}
+
+func randomToken() string {
+	buffer := make([]byte, 24)
+	if _, err := rand.Read(buffer); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buffer)
+}
+
+// session returns the session of the request or nil if the user is not logged in
+func (panel *Panel) session(request *http.Request) *session {
+	cookie, err := request.Cookie(sessionCookie)
+	if err != nil {
+		return nil
+	}
+
+	panel.mutex.Lock()
+	defer panel.mutex.Unlock()
+
+	now := time.Now()
+	for id, other := range panel.sessions {
+		if now.After(other.expires) {
+			delete(panel.sessions, id)
+		}
+	}
+	return panel.sessions[cookie.Value]
+}
+
+func (panel *Panel) checkCSRF(session *session, request *http.Request) bool {
+	return subtle.ConstantTimeCompare([]byte(session.csrf), []byte(request.PostFormValue("csrf"))) == 1
+}
+
+// takeFlash returns the flash message of the session and clears it
+func (panel *Panel) takeFlash(session *session) string {
+	panel.mutex.Lock()
+	defer panel.mutex.Unlock()
+	flash := session.flash
+	session.flash = ""
+	return flash
+}
+
+func (panel *Panel) setFlash(session *session, message string) {
+	panel.mutex.Lock()
+	defer panel.mutex.Unlock()
+	session.flash = message
+}
+
+// loginFailures counts the failed logins from one address
+type loginFailures struct {
+	count int
+	last  time.Time
+}
+
+// loginAddress returns the address failed logins are counted for, the port
+// changes with every connection
+func loginAddress(request *http.Request) string {
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		return request.RemoteAddr
+	}
+	return host
+}
+
+// lockedOut reports whether address failed to log in LoginAttempts times, the
+// failures are forgotten LoginLockout after the last one
+func (panel *Panel) lockedOut(address string, now time.Time) bool {
+	panel.mutex.Lock()
+	defer panel.mutex.Unlock()
+
+	for other, failures := range panel.failures {
+		if now.Sub(failures.last) >= panel.LoginLockout {
+			delete(panel.failures, other)
+		}
+	}
+	failures, ok := panel.failures[address]
+	return ok && panel.LoginAttempts > 0 && failures.count >= panel.LoginAttempts
+}
+
+func (panel *Panel) loginFailed(address string, now time.Time) {
+	panel.mutex.Lock()
+	defer panel.mutex.Unlock()
+
+	failures, ok := panel.failures[address]
+	if !ok {
+		failures = &loginFailures{}
+		panel.failures[address] = failures
+	}
+	failures.count++
+	failures.last = now
+}
+
+func (panel *Panel) serveLogin(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		panel.render(writer, "login", nil, nil)
+		return
+	}
+
+	// guessing tokens is slowed down by locking out addresses failing too often
+	address := loginAddress(request)
+	if panel.lockedOut(address, time.Now()) {
+		panel.logf("locked out login from %s", request.RemoteAddr)
+		writer.WriteHeader(http.StatusTooManyRequests)
+		panel.render(writer, "login", nil, map[string]interface{}{"Error": "too many failed logins, try again later"})
+		return
+	}
+
+	user := panel.users.ByToken(request.PostFormValue("token"))
+	if user == nil {
+		panel.loginFailed(address, time.Now())
+		panel.logf("failed login from %s", request.RemoteAddr)
+		writer.WriteHeader(http.StatusUnauthorized)
+		panel.render(writer, "login", nil, map[string]interface{}{"Error": "invalid token"})
+		return
+	}
+
+	session := &session{
+		id:      randomToken(),
+		user:    user,
+		csrf:    randomToken(),
+		expires: time.Now().Add(panel.SessionTTL),
+	}
+	panel.mutex.Lock()
+	panel.sessions[session.id] = session
+	delete(panel.failures, address)
+	panel.mutex.Unlock()
+
+	http.SetCookie(writer, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    session.id,
+		Path:     "/",
+		Expires:  session.expires,
+		HttpOnly: true,
+		Secure:   request.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+	panel.logf("%s (%s) logged in from %s", user.Name, user.Role, request.RemoteAddr)
+	http.Redirect(writer, request, "/", http.StatusSeeOther)
+}
+
+func (panel *Panel) serveLogout(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if session := panel.session(request); session != nil && panel.checkCSRF(session, request) {
+		panel.mutex.Lock()
+		delete(panel.sessions, session.id)
+		panel.mutex.Unlock()
+	}
+	http.SetCookie(writer, &http.Cookie{Name: sessionCookie, Value: "", Path: "/", MaxAge: -1})
+	http.Redirect(writer, request, "/login", http.StatusSeeOther)
+}
@@ -0,0 +1,193 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package webadmin is a browser admin panel for one or more servers. Templates
+// and styles are embedded, so the panel is a single http.Handler:
+//
+//	panel, err := webadmin.New(users)
+//	panel.AddServer("main", client)
+//	http.ListenAndServe(":8084", panel)
+//
+// Users log in with their access token, what they may do is decided by their
+// role just like in the proxy and the gateway. An address failing to log in
+// LoginAttempts times in a row is locked out for LoginLockout.
+package webadmin
+
+import (
+	"embed"
+	"html/template"
+	"io/fs"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/uranoxyd/govrageremote.v2"
+	"gopkg.in/uranoxyd/govrageremote.v2/access"
+)
+
+//go:embed templates/*.html
+var templateFiles embed.FS
+
+//go:embed static
+var staticFiles embed.FS
+
+// Server is one of the game servers managed by the panel
+type Server struct {
+	Name   string
+	client *govrageremote.VRageRemoteClient
+}
+
+type Panel struct {
+	users         access.Users
+	servers       []*Server
+	sessions      map[string]*session
+	failures      map[string]*loginFailures
+	pages         map[string]*template.Template
+	static        http.Handler
+	SessionTTL    time.Duration
+	LoginAttempts int           // failed logins from one address before it is locked out, zero disables the lockout
+	LoginLockout  time.Duration // how long an address is locked out, counted from its last failed login
+	Logger        *log.Logger   // logs every action if not nil
+	mutex         sync.Mutex
+}
+
+func (panel *Panel) AddServer(name string, client *govrageremote.VRageRemoteClient) {
+	panel.mutex.Lock()
+	defer panel.mutex.Unlock()
+	panel.servers = append(panel.servers, &Server{Name: name, client: client})
+}
+
+func (panel *Panel) server(name string) *Server {
+	panel.mutex.Lock()
+	defer panel.mutex.Unlock()
+	for _, server := range panel.servers {
+		if server.Name == name {
+			return server
+		}
+	}
+	return nil
+}
+
+func (panel *Panel) serverNames() []string {
+	panel.mutex.Lock()
+	defer panel.mutex.Unlock()
+	names := make([]string, len(panel.servers))
+	for i, server := range panel.servers {
+		names[i] = server.Name
+	}
+	return names
+}
+
+// ServeHTTP routes /login, /logout, /static/ and /servers/<name>/<page>
+func (panel *Panel) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	path := request.URL.Path
+	switch {
+	case strings.HasPrefix(path, "/static/"):
+		panel.static.ServeHTTP(writer, request)
+		return
+	case path == "/login":
+		panel.serveLogin(writer, request)
+		return
+	case path == "/logout":
+		panel.serveLogout(writer, request)
+		return
+	}
+
+	session := panel.session(request)
+	if session == nil {
+		http.Redirect(writer, request, "/login", http.StatusSeeOther)
+		return
+	}
+
+	if path == "/" {
+		names := panel.serverNames()
+		if len(names) == 0 {
+			http.Error(writer, "no servers configured", http.StatusNotFound)
+			return
+		}
+		http.Redirect(writer, request, "/servers/"+names[0]+"/", http.StatusSeeOther)
+		return
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(path, "/servers/"), "/", 2)
+	if !strings.HasPrefix(path, "/servers/") || len(parts) != 2 {
+		http.NotFound(writer, request)
+		return
+	}
+	server := panel.server(parts[0])
+	if server == nil {
+		http.NotFound(writer, request)
+		return
+	}
+
+	page := parts[1]
+	if page == "action" {
+		panel.serveAction(writer, request, session, server)
+		return
+	}
+	if request.Method != http.MethodGet {
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	switch page {
+	case "":
+		panel.serveDashboard(writer, request, session, server)
+	case "players":
+		panel.servePlayers(writer, request, session, server)
+	case "grids":
+		panel.serveGrids(writer, request, session, server)
+	case "chat":
+		panel.serveChat(writer, request, session, server)
+	default:
+		http.NotFound(writer, request)
+	}
+}
+
+func (panel *Panel) logf(format string, args ...interface{}) {
+	if panel.Logger != nil {
+		panel.Logger.Printf(format, args...)
+	}
+}
+
+// New creates a panel for users, servers are added with AddServer
+func New(users access.Users) (*Panel, error) {
+	panel := &Panel{
+		users:         users,
+		sessions:      make(map[string]*session),
+		failures:      make(map[string]*loginFailures),
+		pages:         make(map[string]*template.Template),
+		SessionTTL:    12 * time.Hour,
+		LoginAttempts: 5,
+		LoginLockout:  5 * time.Minute,
+	}
+
+	// every page is parsed together with the layout, so each can define its own content
+	for _, page := range []string{"login", "dashboard", "players", "grids", "chat"} {
+		tmpl, err := template.New(page).Funcs(templateFuncs).ParseFS(templateFiles, "templates/layout.html", "templates/"+page+".html")
+		if err != nil {
+			return nil, err
+		}
+		panel.pages[page] = tmpl
+	}
+
+	static, err := fs.Sub(staticFiles, "static")
+	if err != nil {
+		return nil, err
+	}
+	panel.static = http.StripPrefix("/static/", http.FileServer(http.FS(static)))
+
+	return panel, nil
+}
@@ -0,0 +1,290 @@
+// Copyright 2021 David Ewelt <uranoxyd@gmail.com>
+//   This program is free software; you can redistribute it and/or modify
+//   it under the terms of the GNU General Public License as published by
+//   the Free Software Foundation; either version 3 of the License, or
+//   (at your option) any later version.
+//
+//   This program is distributed in the hope that it will be useful, but
+//   WITHOUT ANY WARRANTY; without even the implied warranty of
+//   MERCHANTIBILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+//   General Public License for more details.
+//
+//   You should have received a copy of the GNU General Public License
+//   along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package webadmin
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/uranoxyd/govrageremote.v2"
+	"gopkg.in/uranoxyd/govrageremote.v2/access"
+)
+
+// newTestPanel serves a panel for the server "main" in front of a stand-in
+// Remote API which records the calls it got
+func newTestPanel(t *testing.T) (*Panel, func() []string) {
+	var mutex sync.Mutex
+	var calls []string
+	remote := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		mutex.Lock()
+		calls = append(calls, request.Method+" "+strings.TrimPrefix(request.URL.Path, "/vrageremote/v1/"))
+		mutex.Unlock()
+		fmt.Fprint(writer, `{"meta":{"apiVersion":"1.0","queryTime":1}}`)
+	}))
+	t.Cleanup(remote.Close)
+
+	panel, err := New(access.Users{
+		{Name: "admin", Role: access.RoleAdmin, Token: "admin-token"},
+		{Name: "mod", Role: access.RoleModerator, Token: "mod-token"},
+		{Name: "reader", Role: access.RoleReadOnly, Token: "read-token"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	panel.AddServer("main", govrageremote.NewVRageRemoteClient(remote.URL, "c2VjcmV0"))
+	return panel, func() []string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return append([]string(nil), calls...)
+	}
+}
+
+// postLogin posts token to /login from address
+func postLogin(panel *Panel, address string, token string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest("POST", "/login", strings.NewReader(url.Values{"token": {token}}.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.RemoteAddr = address
+	recorder := httptest.NewRecorder()
+	panel.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// login logs in with token and returns the new session
+func login(t *testing.T, panel *Panel, token string) *session {
+	recorder := postLogin(panel, "192.0.2.1:1234", token)
+	if recorder.Code != http.StatusSeeOther {
+		t.Fatalf("login with %s: got status %d", token, recorder.Code)
+	}
+	for _, cookie := range recorder.Result().Cookies() {
+		if cookie.Name == sessionCookie {
+			panel.mutex.Lock()
+			defer panel.mutex.Unlock()
+			return panel.sessions[cookie.Value]
+		}
+	}
+	t.Fatalf("login with %s: no session cookie", token)
+	return nil
+}
+
+// serve sends a request with the cookie of session, form is posted if not nil
+func serve(panel *Panel, session *session, path string, form url.Values) *httptest.ResponseRecorder {
+	var request *http.Request
+	if form != nil {
+		request = httptest.NewRequest("POST", path, strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		request = httptest.NewRequest("GET", path, nil)
+	}
+	if session != nil {
+		request.AddCookie(&http.Cookie{Name: sessionCookie, Value: session.id})
+	}
+	recorder := httptest.NewRecorder()
+	panel.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestLogin(t *testing.T) {
+	panel, _ := newTestPanel(t)
+
+	if recorder := serve(panel, nil, "/servers/main/", nil); recorder.Code != http.StatusSeeOther || recorder.Header().Get("Location") != "/login" {
+		t.Errorf("without session: got %d to %q, want a redirect to /login", recorder.Code, recorder.Header().Get("Location"))
+	}
+	if recorder := serve(panel, nil, "/login", nil); recorder.Code != http.StatusOK {
+		t.Errorf("login page: got status %d", recorder.Code)
+	}
+
+	recorder := postLogin(panel, "192.0.2.1:1234", "nope")
+	if recorder.Code != http.StatusUnauthorized || !strings.Contains(recorder.Body.String(), "invalid token") {
+		t.Errorf("invalid token: got %d %q", recorder.Code, recorder.Body.String())
+	}
+	if len(recorder.Result().Cookies()) != 0 {
+		t.Error("invalid token: got a cookie")
+	}
+
+	recorder = postLogin(panel, "192.0.2.1:1234", "mod-token")
+	if recorder.Code != http.StatusSeeOther || recorder.Header().Get("Location") != "/" {
+		t.Fatalf("valid token: got %d to %q", recorder.Code, recorder.Header().Get("Location"))
+	}
+	cookies := recorder.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != sessionCookie || !cookies[0].HttpOnly || cookies[0].SameSite != http.SameSiteStrictMode {
+		t.Fatalf("valid token: got cookies %v", cookies)
+	}
+	session := panel.sessions[cookies[0].Value]
+	if session == nil || session.user.Name != "mod" || session.csrf == "" {
+		t.Fatalf("valid token: got session %+v", session)
+	}
+
+	if recorder := serve(panel, session, "/", nil); recorder.Code != http.StatusSeeOther || recorder.Header().Get("Location") != "/servers/main/" {
+		t.Errorf("with session: got %d to %q", recorder.Code, recorder.Header().Get("Location"))
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	panel, _ := newTestPanel(t)
+
+	for i := 0; i < panel.LoginAttempts; i++ {
+		if recorder := postLogin(panel, "192.0.2.1:1234", "nope"); recorder.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: got status %d", i+1, recorder.Code)
+		}
+	}
+
+	// the port changes with every connection, the address stays locked out
+	recorder := postLogin(panel, "192.0.2.1:5678", "admin-token")
+	if recorder.Code != http.StatusTooManyRequests || len(recorder.Result().Cookies()) != 0 {
+		t.Errorf("locked out: got status %d and cookies %v", recorder.Code, recorder.Result().Cookies())
+	}
+	if recorder := postLogin(panel, "192.0.2.2:1234", "admin-token"); recorder.Code != http.StatusSeeOther {
+		t.Errorf("other address: got status %d", recorder.Code)
+	}
+
+	panel.LoginLockout = 10 * time.Millisecond
+	time.Sleep(20 * time.Millisecond)
+	if recorder := postLogin(panel, "192.0.2.1:1234", "admin-token"); recorder.Code != http.StatusSeeOther {
+		t.Errorf("after the lockout: got status %d", recorder.Code)
+	}
+}
+
+func TestLoginLockoutReset(t *testing.T) {
+	panel, _ := newTestPanel(t)
+
+	// a successful login forgets the failures before it
+	for round := 0; round < 2; round++ {
+		for i := 0; i < panel.LoginAttempts-1; i++ {
+			postLogin(panel, "192.0.2.1:1234", "nope")
+		}
+		if recorder := postLogin(panel, "192.0.2.1:1234", "read-token"); recorder.Code != http.StatusSeeOther {
+			t.Fatalf("round %d: got status %d", round, recorder.Code)
+		}
+	}
+
+	panel.LoginAttempts = 0
+	for i := 0; i < 10; i++ {
+		postLogin(panel, "192.0.2.1:1234", "nope")
+	}
+	if recorder := postLogin(panel, "192.0.2.1:1234", "read-token"); recorder.Code != http.StatusSeeOther {
+		t.Errorf("lockout disabled: got status %d", recorder.Code)
+	}
+}
+
+func TestSessionExpiry(t *testing.T) {
+	panel, _ := newTestPanel(t)
+	session := login(t, panel, "read-token")
+
+	panel.mutex.Lock()
+	session.expires = time.Now().Add(-time.Second)
+	panel.mutex.Unlock()
+
+	if recorder := serve(panel, session, "/servers/main/", nil); recorder.Code != http.StatusSeeOther || recorder.Header().Get("Location") != "/login" {
+		t.Errorf("expired session: got %d to %q, want a redirect to /login", recorder.Code, recorder.Header().Get("Location"))
+	}
+	if _, ok := panel.sessions[session.id]; ok {
+		t.Error("expired session was not removed")
+	}
+}
+
+func TestCSRF(t *testing.T) {
+	panel, calls := newTestPanel(t)
+	session := login(t, panel, "admin-token")
+
+	for _, csrf := range []string{"", "wrong"} {
+		form := url.Values{"action": {"save"}}
+		if csrf != "" {
+			form.Set("csrf", csrf)
+		}
+		if recorder := serve(panel, session, "/servers/main/action", form); recorder.Code != http.StatusForbidden {
+			t.Errorf("action with csrf %q: got status %d", csrf, recorder.Code)
+		}
+		// a forged logout only clears the cookie of the browser, the session stays valid
+		serve(panel, session, "/logout", form)
+		if panel.sessions[session.id] == nil {
+			t.Fatalf("logout with csrf %q ended the session", csrf)
+		}
+	}
+	if got := calls(); len(got) != 0 {
+		t.Errorf("got remote calls %v", got)
+	}
+
+	recorder := serve(panel, session, "/logout", url.Values{"csrf": {session.csrf}})
+	if recorder.Code != http.StatusSeeOther || panel.sessions[session.id] != nil {
+		t.Errorf("logout: got status %d, session removed %v", recorder.Code, panel.sessions[session.id] == nil)
+	}
+}
+
+func TestActions(t *testing.T) {
+	tests := []struct {
+		name   string
+		token  string
+		form   url.Values
+		status int
+		flash  string
+		remote string // the Remote API call made, empty if none
+	}{
+		{"read-only kick", "read-token", url.Values{"action": {"kick"}, "id": {"76561198000000001"}}, 303, "kick player requires the moderator role", ""},
+		{"moderator kick", "mod-token", url.Values{"action": {"kick"}, "id": {"STEAM_0:1:19867136"}}, 303, "kick player done", "POST admin/kickedPlayers/76561198000000001"},
+		{"moderator delete", "mod-token", url.Values{"action": {"delete"}, "id": {"5"}}, 303, "delete grid requires the admin role", ""},
+		{"admin delete", "admin-token", url.Values{"action": {"delete"}, "id": {"5"}}, 303, "delete grid done", "DELETE session/grids/5"},
+		{"moderator shutdown", "mod-token", url.Values{"action": {"shutdown"}}, 303, "stop server requires the admin role", ""},
+		{"invalid id", "admin-token", url.Values{"action": {"stop"}, "id": {"abc"}}, 303, "stop grid failed: ", ""},
+		{"unknown action", "admin-token", url.Values{"action": {"explode"}}, 400, "", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			panel, calls := newTestPanel(t)
+			session := login(t, panel, test.token)
+			test.form.Set("csrf", session.csrf)
+
+			recorder := serve(panel, session, "/servers/main/action", test.form)
+			if recorder.Code != test.status {
+				t.Fatalf("got status %d, want %d", recorder.Code, test.status)
+			}
+			if flash := panel.takeFlash(session); !strings.HasPrefix(flash, test.flash) || (test.flash == "") != (flash == "") {
+				t.Errorf("got flash %q, want %q", flash, test.flash)
+			}
+			got := calls()
+			if test.remote == "" && len(got) != 0 || test.remote != "" && (len(got) != 1 || got[0] != test.remote) {
+				t.Errorf("got remote calls %v, want %q", got, test.remote)
+			}
+		})
+	}
+}
+
+func TestActionBack(t *testing.T) {
+	panel, _ := newTestPanel(t)
+	session := login(t, panel, "admin-token")
+
+	tests := []struct {
+		back string
+		want string
+	}{
+		{"/servers/main/players", "/servers/main/players"},
+		{"", "/servers/main/"},
+		{"https://example.com/", "/servers/main/"},
+		{"/servers/other/players", "/servers/main/"},
+	}
+	for _, test := range tests {
+		form := url.Values{"action": {"save"}, "csrf": {session.csrf}, "back": {test.back}}
+		recorder := serve(panel, session, "/servers/main/action", form)
+		if location := recorder.Header().Get("Location"); location != test.want {
+			t.Errorf("back %q: got redirect to %q, want %q", test.back, location, test.want)
+		}
+	}
+}